@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/jaeger"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/logging"
+)
+
+// rescanBatchSize is the number of accounts read at a time by a rescan.
+const rescanBatchSize = 100
+
+// rescanDerivations periodically derives further addresses for the
+// accounts whose derived addresses got used. Accounts changed in the
+// meantime are picked up on the next round. It runs until the process
+// exits.
+func rescanDerivations(log *slog.Logger, accounts domain.AccountRepository,
+	src domain.ChainSource, every time.Duration) {
+	for range time.Tick(every) {
+		ctx, span := jaeger.StartJob(context.Background(),
+			"rescan derivations")
+		var after *domain.AccountPosition
+		for {
+			as, err := accounts.ListDerivedAccounts(ctx, after,
+				rescanBatchSize)
+			if err != nil {
+				log.WarnContext(ctx, "Failed to list derived accounts",
+					"error", err)
+				break
+			}
+			for _, a := range as {
+				rescan(ctx, log, accounts, src, a)
+			}
+			if len(as) < rescanBatchSize {
+				break
+			}
+			after = as[len(as)-1].Position()
+		}
+		span.End()
+	}
+}
+
+// rescan stores the further addresses derived for account a, if any.
+func rescan(ctx context.Context, log *slog.Logger,
+	accounts domain.AccountRepository, src domain.ChainSource,
+	a domain.Account) {
+	now := time.Now()
+	b, grown, err := a.Rescan(ctx, src, now)
+	if err == nil && grown {
+		e := domain.NewAuditEntry(a.ID, domain.AuditUpdate,
+			domain.SystemActor, logging.TraceID(ctx),
+			domain.AccountChanges(&a, b), now)
+		err = accounts.UpdateAccount(ctx, b, a.Version, e)
+	}
+	if err != nil {
+		log.WarnContext(ctx, "Failed to rescan derived addresses",
+			"account", a.ID, "error", err)
+		return
+	}
+	if !grown {
+		return
+	}
+	log.InfoContext(ctx, "Derived further addresses", "account", a.ID,
+		"count", len(b.Addresses)-len(a.Addresses))
+}
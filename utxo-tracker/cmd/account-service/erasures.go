@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/jaeger"
+)
+
+// resumeErasures runs the erasures left pending by the process that
+// accepted them, and takes over the ones whose lease ran out, at start
+// and then periodically. It runs until the process exits.
+func resumeErasures(log *slog.Logger, st storage, every time.Duration) {
+	tick := time.Tick(every)
+	for {
+		ctx, span := jaeger.StartJob(context.Background(),
+			"resume erasures")
+		es, err := st.erasures.ListUnfinishedErasures(ctx)
+		if err != nil {
+			log.WarnContext(ctx, "Failed to list unfinished erasures",
+				"error", err)
+		}
+		for _, e := range es {
+			e, ok, err := domain.RunErasure(ctx, st.erasures, st.userData, e)
+			if err != nil {
+				log.ErrorContext(ctx, "Failed to erase user data",
+					"erasure", e.ID, "status", e.Status, "error", err)
+			} else if ok {
+				log.InfoContext(ctx, "Resumed erasure", "erasure", e.ID)
+			}
+		}
+		span.End()
+		<-tick
+	}
+}
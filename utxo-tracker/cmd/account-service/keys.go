@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// rotateKeys runs account-service rotate-keys, which wraps the data keys
+// of all records with the current key-encryption key and encrypts the
+// records written in plaintext. It waits for the schema to be migrated
+// first and exits the process if it fails.
+func rotateKeys(log *slog.Logger, st storage) {
+	if st.rotate == nil {
+		log.Error("Key rotation needs a database and a key file")
+		os.Exit(1)
+	}
+	awaitSchema(log, st)
+	n, err := st.rotate(context.Background())
+	if err != nil {
+		log.Error("Key rotation failed", "error", err, "count", n)
+		os.Exit(1)
+	}
+	log.Info("Rotated data keys", "count", n)
+}
+
+// signAuditHeads runs account-service sign-audit-heads, which signs the
+// heads of all audit chains with the audit signing key. It is run once
+// the key is set or changed, while the database can be trusted, as
+// chains whose heads are not signed with the key fail verification. It
+// exits the process if it fails.
+func signAuditHeads(log *slog.Logger, st storage) {
+	if st.signAudit == nil {
+		log.Error("Signing audit heads needs a database and " +
+			"an audit signing key")
+		os.Exit(1)
+	}
+	awaitSchema(log, st)
+	n, err := st.signAudit(context.Background())
+	if err != nil {
+		log.Error("Signing audit heads failed", "error", err, "count", n)
+		os.Exit(1)
+	}
+	log.Info("Signed audit heads", "count", n)
+}
+
+// awaitSchema waits for the schema to be migrated and exits the process
+// if that takes too long.
+func awaitSchema(log *slog.Logger, st storage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	for st.ready(ctx) != nil {
+		select {
+		case <-ctx.Done():
+			log.Error("Database schema was not migrated in time")
+			os.Exit(1)
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/hannesdejager/utxo-tracker/internal/domain"
 	"github.com/hannesdejager/utxo-tracker/internal/infra/api/restv1"
 	"github.com/hannesdejager/utxo-tracker/internal/infra/env"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/esplora"
 	"github.com/hannesdejager/utxo-tracker/internal/infra/httpsvr"
 	"github.com/hannesdejager/utxo-tracker/internal/infra/jaeger"
 	"github.com/hannesdejager/utxo-tracker/internal/infra/k8s"
@@ -31,21 +32,77 @@ func main() {
 		"subject", inf.Version.CommitSubject,
 	)
 
-	tp, err := jaeger.InitTracing(env.TracingConfig(), inf)
+	chainConf := env.ChainConfig()
+	tp, err := jaeger.InitTracing(env.TracingConfig(), chainConf, inf)
 	if err != nil {
 		log.Error("Failed to initialize tracing", "error", err)
 		os.Exit(1)
 	}
 	defer func() { _ = tp.Shutdown(context.Background()) }()
 
+	encConf := env.EncryptionConfig()
+	keys := openKMS(log, encConf)
+	st := openStorage(log, env.DatabaseConfig(), keys,
+		domain.AuditKey(encConf.AuditSigningKey))
+	defer st.close()
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys(log, st)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sign-audit-heads" {
+		signAuditHeads(log, st)
+		return
+	}
+	apiConf := env.APIConfig()
+	go func() {
+		awaitReady(st)
+		go purgeExpired(log, st, apiConf.AccountRetention, time.Hour)
+		resumeErasures(log, st, time.Minute)
+	}()
+	// The API and the rescan job share the enforcer, so that the writes
+	// of an owner are serialized across both
+	accounts := domain.NewQuotaEnforcer(st.accounts, apiConf.Quota)
+
+	apiOpts := []restv1.Option{
+		restv1.WithIdempotency(st.idempotency, apiConf.IdempotencyTTL),
+		restv1.WithRetention(apiConf.AccountRetention),
+		restv1.WithQuota(apiConf.Quota),
+		restv1.WithMembers(st.members),
+		restv1.WithUserData(st.userData, st.erasures),
+		restv1.WithAudit(st.audit, st.auditKey),
+	}
+	if len(chainConf.EsploraURLs) == 0 {
+		log.Warn("No Esplora URL set, portfolio balances are not reported")
+	}
+	chain := esplora.NewClient(chainConf.EsploraURLs, chainConf.Timeout)
+	apiOpts = append(apiOpts, restv1.WithPortfolios(st.portfolios, chain))
+	if every := chainConf.RescanInterval; every > 0 {
+		go func() {
+			awaitReady(st)
+			rescanDerivations(log, accounts, chain, every)
+		}()
+	}
+	if key := apiConf.CursorSigningKey; key != "" {
+		apiOpts = append(apiOpts, restv1.WithCursorKey([]byte(key)))
+	} else {
+		log.Warn("No cursor signing key set, pagination cursors " +
+			"will not work across replicas or restarts")
+	}
+	if key := apiConf.ReceiptSigningKey; key != "" {
+		apiOpts = append(apiOpts, restv1.WithReceiptKey([]byte(key)))
+	} else {
+		log.Warn("No receipt signing key set, erasure receipts " +
+			"cannot be verified across replicas or restarts")
+	}
+
 	svr := httpsvr.StartAsync(
 		env.HTTPConfig(),
-		restv1.NewHandler(log, "/rest/v1"),
+		restv1.NewHandler(log, "/rest/v1", accounts, apiOpts...),
 	)
 
 	_ = httpsvr.StartAsync(
 		env.MonitoringServerConfig(),
-		monitoringRoutes(inf),
+		monitoringRoutes(inf, st),
 	)
 
 	sys.AwaitTermination()
@@ -54,10 +111,11 @@ func main() {
 	log.Info("Bye!")
 }
 
-func monitoringRoutes(inf domain.ServiceInstance) http.Handler {
+func monitoringRoutes(inf domain.ServiceInstance, st storage,
+) http.Handler {
 	r := chi.NewRouter()
-	r.Get("/metrics", prometheus.NewHandler(inf).ServeHTTP)
-	r.Get("/readyz", k8s.ReadinessProbe())
+	r.Get("/metrics", prometheus.NewHandler(inf, st.metrics...).ServeHTTP)
+	r.Get("/readyz", k8s.ReadinessProbe(st.ready))
 	r.Get("/livez", k8s.LivenessProbe())
 	return r
 }
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/app/config"
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/k8s"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/kms"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/memory"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/postgres"
+	infraprom "github.com/hannesdejager/utxo-tracker/internal/infra/prometheus"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/sqldb"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/sqlite"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// storage is the account storage backend selected at startup.
+type storage struct {
+	accounts    domain.AccountRepository
+	idempotency domain.IdempotencyRepository
+	portfolios  domain.PortfolioRepository
+	members     domain.MemberRepository
+	userData    domain.UserDataRepository
+	erasures    domain.ErasureRepository
+	audit       domain.AuditRepository
+	// auditKey signs the heads of the audit chains. It is nil unless
+	// they are stored in a database.
+	auditKey domain.AuditKey
+	// ready fails while the backend cannot serve requests
+	ready k8s.Check
+	// metrics are extra collectors exposed by the backend
+	metrics []prometheus.Collector
+	// rotate wraps the data keys of all records with the current
+	// key-encryption key. It is nil unless records are encrypted.
+	rotate func(context.Context) (int, error)
+	// signAudit signs the heads of all audit chains with auditKey. It
+	// is nil unless there is a key.
+	signAudit func(context.Context) (int, error)
+	close     func()
+}
+
+// openKMS opens the key-encryption keys of the key file, or returns nil
+// if none is configured.
+func openKMS(log *slog.Logger, c config.Encryption) kms.Service {
+	if c.KeyFile == "" {
+		log.Warn("No key file set, extended keys and descriptors " +
+			"are stored in plaintext")
+		return nil
+	}
+	f, err := kms.OpenFile(c.KeyFile)
+	if err != nil {
+		log.Error("Failed to open key file", "error", err)
+		os.Exit(1)
+	}
+	log.Info("Encrypting sensitive fields at rest", "version", f.Version())
+	return f
+}
+
+// openStorage selects PostgreSQL when a DSN is configured, otherwise
+// SQLite when a file path is configured and memory as a last resort.
+// The SQL backends encrypt sensitive fields when keys is set and sign
+// the heads of audit chains when auditKey is set.
+func openStorage(log *slog.Logger, c config.Database, keys kms.Service,
+	auditKey domain.AuditKey) storage {
+	var opts []sqldb.Option
+	if keys != nil {
+		opts = append(opts, sqldb.WithKMS(keys))
+	}
+	if len(auditKey) > 0 {
+		opts = append(opts, sqldb.WithAuditKey(auditKey))
+	} else if c.PostgresDSN != "" || c.SQLitePath != "" {
+		log.Warn("No audit signing key set, removing the latest audit " +
+			"entries from the database is not noticed")
+	}
+	switch {
+	case c.PostgresDSN != "":
+		pool, db, err := postgres.Open(context.Background(), c)
+		if err != nil {
+			log.Error("Failed to open PostgreSQL", "error", err)
+			os.Exit(1)
+		}
+		log.Info("Storing accounts in PostgreSQL")
+		store := sqldb.NewStore(db, postgres.Dialect, opts...)
+		st := storage{
+			accounts:    store,
+			idempotency: store,
+			portfolios:  store,
+			members:     store,
+			userData:    store,
+			erasures:    store,
+			audit:       store,
+			ready:       migrateAsync(log, db, postgres.Migrate),
+			metrics:     []prometheus.Collector{infraprom.NewDBPoolCollector(pool)},
+			close: func() {
+				_ = db.Close()
+				pool.Close()
+			},
+		}
+		return withKeys(st, store, keys, auditKey)
+	case c.SQLitePath != "":
+		db, err := sqlite.Open(c.SQLitePath)
+		if err != nil {
+			log.Error("Failed to open SQLite", "error", err)
+			os.Exit(1)
+		}
+		log.Info("Storing accounts in SQLite", "path", c.SQLitePath)
+		store := sqldb.NewStore(db, sqlite.Dialect, opts...)
+		st := storage{
+			accounts:    store,
+			idempotency: store,
+			portfolios:  store,
+			members:     store,
+			userData:    store,
+			erasures:    store,
+			audit:       store,
+			ready:       migrateAsync(log, db, sqlite.Migrate),
+			close:       func() { _ = db.Close() },
+		}
+		return withKeys(st, store, keys, auditKey)
+	}
+	log.Warn("No database configured, accounts are kept in memory")
+	store := memory.NewStore()
+	return storage{
+		accounts:    store,
+		idempotency: store,
+		portfolios:  store,
+		members:     store,
+		userData:    store,
+		erasures:    store,
+		audit:       store,
+		ready:       func(context.Context) error { return nil },
+		close:       func() {},
+	}
+}
+
+// withKeys adds the key rotation and its metric to an SQL backend that
+// encrypts with keys, and the signing of audit heads to one that signs
+// them with auditKey.
+func withKeys(st storage, store *sqldb.Store, keys kms.Service,
+	auditKey domain.AuditKey) storage {
+	if len(auditKey) > 0 {
+		st.auditKey = auditKey
+		st.signAudit = store.SignAuditHeads
+	}
+	if keys == nil {
+		return st
+	}
+	st.rotate = store.RotateDataKeys
+	st.metrics = append(st.metrics,
+		infraprom.NewStaleKeysCollector(store.StaleRecords))
+	return st
+}
+
+// migrateAsync migrates the schema in the background, retrying until it
+// succeeds. The returned check fails until then, so a schema that could
+// not be migrated keeps the pod out of service instead of crashing it.
+func migrateAsync(log *slog.Logger, db *sql.DB,
+	migrate func(context.Context, *sql.DB) error) k8s.Check {
+	var (
+		mu  sync.Mutex
+		err = errors.New("database schema is not migrated yet")
+	)
+	go func() {
+		for {
+			e := migrate(context.Background(), db)
+			mu.Lock()
+			err = e
+			mu.Unlock()
+			if e == nil {
+				log.Info("Database schema is up to date")
+				return
+			}
+			log.Error("Database migration failed", "error", e)
+			time.Sleep(10 * time.Second)
+		}
+	}()
+	return func(ctx context.Context) error {
+		mu.Lock()
+		e := err
+		mu.Unlock()
+		if e != nil {
+			return e
+		}
+		return db.PingContext(ctx)
+	}
+}
+
+// awaitReady blocks until the storage can serve requests, so that the
+// background jobs do not run against a schema that is still being
+// migrated.
+func awaitReady(st storage) {
+	for st.ready(context.Background()) != nil {
+		time.Sleep(time.Second)
+	}
+}
+
+// purgeExpired periodically deletes expired idempotency records and the
+// accounts deleted longer than retention ago. A zero retention keeps
+// deleted accounts for good, as it lets them be restored at any time. It
+// runs until the process exits.
+func purgeExpired(log *slog.Logger, st storage, retention,
+	every time.Duration) {
+	for range time.Tick(every) {
+		ctx, now := context.Background(), time.Now()
+		err := st.idempotency.DeleteExpiredIdempotencyKeys(ctx, now)
+		if err != nil {
+			log.Warn("Failed to purge idempotency keys", "error", err)
+		}
+		if retention == 0 {
+			continue
+		}
+		n, err := st.accounts.PurgeDeletedAccounts(ctx, now.Add(-retention))
+		if err != nil {
+			log.Warn("Failed to purge deleted accounts", "error", err)
+		}
+		if n > 0 {
+			infraprom.AccountsPurged(n)
+			log.Info("Purged deleted accounts", "count", n)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+// API holds settings for the public REST API.
+type API struct {
+	// CursorSigningKey signs pagination cursors. All replicas must use
+	// the same key for cursors to work across them.
+	CursorSigningKey string
+	// ReceiptSigningKey signs the receipts of erased user data. All
+	// replicas must use the same key for receipts to verify across them.
+	ReceiptSigningKey string
+	// IdempotencyTTL is how long responses are kept for replay to
+	// requests with the same Idempotency-Key.
+	IdempotencyTTL time.Duration
+	// Quota limits what each user may store and request.
+	Quota domain.Quota
+	// AccountRetention is how long deleted accounts can be restored
+	// before they are purged. Zero keeps them for good.
+	AccountRetention time.Duration
+}
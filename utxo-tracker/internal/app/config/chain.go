@@ -0,0 +1,19 @@
+package config
+
+import (
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// Chain holds settings for reading address state from the networks.
+type Chain struct {
+	// EsploraURLs holds the Esplora API base URL per network of each
+	// chain. Balances are not reported for networks without one.
+	EsploraURLs map[address.Chain]map[address.Network]string
+	// Timeout bounds each request to an Esplora API.
+	Timeout time.Duration
+	// RescanInterval is how often accounts that derive addresses are
+	// checked for newly used ones. Zero disables rescanning.
+	RescanInterval time.Duration
+}
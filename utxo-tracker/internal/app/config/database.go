@@ -0,0 +1,23 @@
+package config
+
+import "time"
+
+// Database holds settings for the account database.
+type Database struct {
+	// PostgresDSN is the connection string of the PostgreSQL database.
+	// It takes precedence over SQLitePath when set.
+	PostgresDSN string
+	// SQLitePath is the file the SQLite database is stored in. When it
+	// and PostgresDSN are empty the service keeps its data in memory.
+	SQLitePath string
+	// Pool holds the PostgreSQL connection pool settings.
+	Pool DatabasePool
+}
+
+// DatabasePool holds connection pool settings.
+type DatabasePool struct {
+	MaxConns        int
+	MinConns        int
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+}
@@ -0,0 +1,13 @@
+package config
+
+// Encryption holds settings for the encryption of sensitive fields at
+// rest.
+type Encryption struct {
+	// KeyFile is the file the key-encryption keys are read from. When it
+	// is empty sensitive fields are stored in plaintext.
+	KeyFile string
+	// AuditSigningKey signs the heads of the audit chains, so that
+	// entries removed from the database are noticed. It must be kept
+	// outside of the database, and all replicas must use the same key.
+	AuditSigningKey string
+}
@@ -0,0 +1,470 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/label"
+)
+
+// Limits applied when validating account input.
+const (
+	MaxAccountNameLength = 100
+	MaxAddressLength     = 128
+	MaxTags              = 20
+	MaxTagLength         = 50
+	MaxLabels            = 10000
+)
+
+// Account is a named collection of Bitcoin addresses owned by a user.
+type Account struct {
+	ID        string
+	OwnerID   string
+	Name      string
+	Addresses []string
+	// Chain is the chain the addresses belong to.
+	Chain address.Chain
+	// Network is the network the addresses belong to. It is inferred
+	// from the addresses when not chosen, in which case the test
+	// networks, whose addresses are encoded alike, are reported as
+	// testnet.
+	Network address.Network
+	// Tags are free-form keywords for grouping accounts
+	Tags []string
+	// Labels are BIP329 wallet labels. Labels of type addr that refer to
+	// one of the account's addresses are its address labels.
+	Labels []label.Label
+	// Version is incremented on every modification and guards against
+	// concurrent updates overwriting each other.
+	Version   int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// DeletedAt is set while a deleted account can still be restored.
+	// Such accounts are hidden from everything but restoring and keep
+	// their name reserved.
+	DeletedAt *time.Time
+	// Derivation is set on accounts that derive addresses from an
+	// extended public key. The derived addresses are part of Addresses.
+	Derivation *Derivation
+	// Descriptors are the output descriptors the account expands into
+	// addresses, which are part of Addresses.
+	Descriptors []AccountDescriptor
+}
+
+// AccountSpec holds the user editable fields of an account.
+type AccountSpec struct {
+	Name      string
+	Addresses []string
+	// Chain is the chain every address must belong to. When empty, new
+	// accounts are Bitcoin accounts and updated ones keep their chain.
+	Chain address.Chain
+	// Network is the network every address must belong to. When empty,
+	// new accounts get the network of their addresses and updated ones
+	// keep theirs.
+	Network address.Network
+	Tags    []string
+	// AddressLabels maps addresses of the account to their label
+	AddressLabels map[string]string
+	// Derivation derives addresses from an extended public key. It is
+	// only read when creating accounts, derived addresses are kept on
+	// updates.
+	Derivation *DerivationSpec
+	// Descriptors are expanded into addresses. Like Derivation they are
+	// only read when creating accounts.
+	Descriptors []DescriptorSpec
+	// Multisig adds the descriptor of a multisig script to Descriptors
+	Multisig *MultisigSpec
+}
+
+// NewAccount validates the given input and returns a new Account owned by
+// the given user.
+func NewAccount(ownerID string, spec AccountSpec, now time.Time,
+) (Account, error) {
+	now = timestamp(now)
+	a := Account{
+		ID:        NewID(),
+		OwnerID:   ownerID,
+		Chain:     address.Bitcoin,
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return a.apply(spec, true)
+}
+
+// Update returns a copy of the account with the given fields and the
+// next version. Labels other than the address labels are kept.
+func (a Account) Update(spec AccountSpec, now time.Time,
+) (Account, error) {
+	a.Version++
+	a.UpdatedAt = timestamp(now)
+	return a.apply(spec, false)
+}
+
+// Relabel returns a copy of the account with its labels replaced and the
+// next version.
+func (a Account) Relabel(ls []label.Label, now time.Time,
+) (Account, error) {
+	a.Labels = slices.Clone(ls)
+	a.Version++
+	a.UpdatedAt = timestamp(now)
+	if err := a.Validate(); err != nil {
+		return Account{}, err
+	}
+	return a, nil
+}
+
+// Delete returns a copy of the account marked deleted at now.
+func (a Account) Delete(now time.Time) Account {
+	t := timestamp(now)
+	a.Version++
+	a.UpdatedAt = t
+	a.DeletedAt = &t
+	return a
+}
+
+// Restore returns a copy of a deleted account that is no longer marked
+// deleted. Accounts deleted longer than retention ago cannot be
+// restored and are reported as not found. A zero retention does not
+// limit restoring.
+func (a Account) Restore(now time.Time, retention time.Duration,
+) (Account, error) {
+	if a.DeletedAt == nil ||
+		retention > 0 && now.Sub(*a.DeletedAt) > retention {
+		return Account{}, ErrAccountNotFound
+	}
+	a.Version++
+	a.UpdatedAt = timestamp(now)
+	a.DeletedAt = nil
+	return a, nil
+}
+
+// apply sets the fields of spec. The derivation and descriptors are
+// only set on create.
+func (a Account) apply(spec AccountSpec, create bool,
+) (Account, error) {
+	a.Name = strings.TrimSpace(spec.Name)
+	if spec.Chain != "" {
+		a.Chain = spec.Chain
+	}
+	a.Tags = normalizeTags(spec.Tags)
+	if spec.Network != "" {
+		a.Network = spec.Network
+	}
+	var v ValidationError
+	known := slices.Contains(address.Chains, a.Chain)
+	if d := spec.Derivation; create && d != nil && known {
+		a.Derivation, a.Network = newDerivation(&v, a.Chain, a.Network, *d)
+		for _, branch := range []uint32{ReceiveBranch, ChangeBranch} {
+			if len(v.Violations) > 0 {
+				break
+			}
+			err := a.Derivation.derive(a.Chain, a.Network, branch,
+				a.Derivation.GapLimit)
+			if err != nil {
+				v.Add("derivation.extendedKey",
+					a.Derivation.ExtendedKey, err.Error())
+			}
+		}
+	}
+	if ds := spec.Descriptors; create && len(ds) > 0 && known {
+		a.Descriptors, a.Network = newDescriptors(&v, "descriptors",
+			a.Chain, a.Network, ds)
+	}
+	if m := spec.Multisig; create && m != nil && known {
+		// A placeholder keeps invalid specs from counting as missing
+		ds := []AccountDescriptor{{}}
+		if d := multisigDescriptor(&v, a.Chain, *m); d.Descriptor != "" {
+			ds, a.Network = newDescriptors(&v, "multisig", a.Chain,
+				a.Network, []DescriptorSpec{d})
+		}
+		a.Descriptors = append(a.Descriptors, ds...)
+	}
+	a.Addresses = a.withDerived(normalizeAddresses(a.Chain, spec.Addresses))
+	a.Labels = setAddressLabels(&v, a.Labels, a.Chain, a.Addresses,
+		spec.AddressLabels)
+	a.validate(&v)
+	if err := v.OrNil(); err != nil {
+		return Account{}, err
+	}
+	if a.Network == "" {
+		a.Network = inferNetwork(a.Chain, a.Addresses)
+	}
+	return a, nil
+}
+
+// AddressLabels returns the labels of the account's addresses.
+func (a Account) AddressLabels() map[string]string {
+	m := make(map[string]string)
+	for _, l := range a.Labels {
+		if l.Type == label.Addr && slices.Contains(a.Addresses, l.Ref) {
+			m[l.Ref] = l.Label
+		}
+	}
+	return m
+}
+
+// setAddressLabels returns ls with the addr labels of addrs replaced by
+// the ones in m. Existing records keep their extra fields.
+func setAddressLabels(v *ValidationError, ls []label.Label,
+	c address.Chain, addrs []string, m map[string]string) []label.Label {
+	byRef := make(map[string]string, len(m))
+	for ref, text := range m {
+		ref = strings.TrimSpace(ref)
+		if pa, err := address.ParseOn(c, ref); err == nil {
+			ref = pa.Encoded
+		}
+		if !slices.Contains(addrs, ref) {
+			v.Add("addressLabels", ref, "is not an address of the account")
+			continue
+		}
+		byRef[ref] = strings.TrimSpace(text)
+	}
+	out := make([]label.Label, 0, len(ls)+len(byRef))
+	for _, l := range ls {
+		if l.Type != label.Addr || !slices.Contains(addrs, l.Ref) {
+			out = append(out, l)
+			continue
+		}
+		if text, ok := byRef[l.Ref]; ok && text != "" {
+			l.Label = text
+			out = append(out, l)
+		}
+		delete(byRef, l.Ref)
+	}
+	// Labels for addresses that had none are added in address order
+	for _, ref := range addrs {
+		if text := byRef[ref]; text != "" {
+			out = append(out, label.New(label.Addr, ref, text))
+		}
+	}
+	return out
+}
+
+// timestamp normalises a time to UTC with microsecond precision, the
+// finest precision all storage backends keep.
+func timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// inferNetwork returns the network of a validated address list.
+func inferNetwork(c address.Chain, addrs []string) address.Network {
+	parsed := make([]address.Address, 0, len(addrs))
+	for _, s := range addrs {
+		if a, err := address.ParseOn(c, s); err == nil {
+			parsed = append(parsed, a)
+		}
+	}
+	n, _ := address.CommonNetwork(parsed)
+	return n
+}
+
+// Validate checks the account invariants.
+func (a Account) Validate() error {
+	var v ValidationError
+	a.validate(&v)
+	return v.OrNil()
+}
+
+func (a Account) validate(v *ValidationError) {
+	if strings.TrimSpace(a.OwnerID) == "" {
+		v.Add("ownerId", "", "must not be empty")
+	}
+	switch n := utf8.RuneCountInString(a.Name); {
+	case n == 0:
+		v.Add("name", a.Name, "must not be empty")
+	case n > MaxAccountNameLength:
+		v.Add("name", a.Name, fmt.Sprintf(
+			"must not be longer than %d characters",
+			MaxAccountNameLength))
+	}
+	if len(a.Addresses) == 0 && a.Derivation == nil &&
+		len(a.Descriptors) == 0 {
+		v.Add("addresses", "", "must contain at least one address")
+	}
+	if slices.Contains(address.Chains, a.Chain) {
+		validateAddresses(v, a.Chain, a.Addresses, a.Network)
+	} else {
+		v.Add("chain", string(a.Chain), "is not a known chain")
+	}
+	validateTags(v, a.Tags)
+	validateLabels(v, a.Labels)
+}
+
+func validateTags(v *ValidationError, tags []string) {
+	if len(tags) > MaxTags {
+		v.Add("tags", "", fmt.Sprintf(
+			"must not hold more than %d tags", MaxTags))
+	}
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		switch {
+		case t == "":
+			v.Add("tags", t, "must not be empty")
+		case utf8.RuneCountInString(t) > MaxTagLength:
+			v.Add("tags", t, fmt.Sprintf(
+				"must not be longer than %d characters", MaxTagLength))
+		case seen[t]:
+			v.Add("tags", t, "is listed more than once")
+		}
+		seen[t] = true
+	}
+}
+
+func validateLabels(v *ValidationError, ls []label.Label) {
+	if len(ls) > MaxLabels {
+		v.Add("labels", "", fmt.Sprintf(
+			"must not hold more than %d labels", MaxLabels))
+	}
+	for _, l := range ls {
+		if err := l.Validate(); err != nil {
+			v.Add("labels", l.Key(), err.Error())
+		}
+	}
+}
+
+// validateAddresses checks that every address decodes on chain c, is
+// listed once and that all of them belong to network n, or to the same
+// network if n is empty.
+func validateAddresses(v *ValidationError, c address.Chain,
+	addrs []string, n address.Network) {
+	seen := make(map[string]bool, len(addrs))
+	parsed := make([]address.Address, 0, len(addrs))
+	for _, addr := range addrs {
+		switch {
+		case addr == "":
+			v.Add("addresses", addr, "must not be empty")
+			continue
+		case len(addr) > MaxAddressLength:
+			v.Add("addresses", addr, "is too long")
+			continue
+		case seen[addr]:
+			v.Add("addresses", addr, "is listed more than once")
+			continue
+		}
+		seen[addr] = true
+		pa, err := address.ParseOn(c, addr)
+		if err != nil {
+			v.Add("addresses", addr, err.Error())
+			continue
+		}
+		parsed = append(parsed, pa)
+	}
+	if n != "" {
+		if !slices.Contains(address.ChainNetworks(c), n) {
+			v.Add("network", string(n),
+				"is not a known network of "+string(c))
+			return
+		}
+		for _, pa := range parsed {
+			if !pa.ValidOn(n) {
+				v.Add("addresses", pa.Encoded, fmt.Sprintf(
+					"is a %s address, not %s",
+					joinNetworks(pa.Networks), n))
+			}
+		}
+		return
+	}
+	net, odd := address.CommonNetwork(parsed)
+	for _, pa := range odd {
+		v.Add("addresses", pa.Encoded, fmt.Sprintf(
+			"is a %s address but the other addresses are %s",
+			joinNetworks(pa.Networks), net))
+	}
+}
+
+func joinNetworks(ns []address.Network) string {
+	s := make([]string, 0, len(ns))
+	for _, n := range ns {
+		s = append(s, string(n))
+	}
+	return strings.Join(s, "/")
+}
+
+// NewID returns a new UUIDv7 identifier. Its random bits make it safe to
+// generate concurrently on every replica, and its time prefix keeps IDs
+// roughly sortable by creation.
+func NewID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// normalizeTags trims the tags. A nil list becomes empty.
+func normalizeTags(in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, t := range in {
+		out = append(out, strings.TrimSpace(t))
+	}
+	return out
+}
+
+// normalizeAddresses trims the addresses and puts the valid ones of
+// chain c in their canonical form so that equal addresses compare equal.
+func normalizeAddresses(c address.Chain, in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, a := range in {
+		a = strings.TrimSpace(a)
+		if pa, err := address.ParseOn(c, a); err == nil {
+			a = pa.Encoded
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// AccountRepository persists accounts. Implementations must be safe for
+// concurrent use and scope every lookup to the owning user. Every change
+// comes with the AuditEntry recording it, which is appended to the
+// audit chain of the account along with the change or not at all.
+type AccountRepository interface {
+	// CreateAccount stores a new account. It returns ErrDuplicateAccount
+	// when the ID or the owner's account name is already taken.
+	CreateAccount(ctx context.Context, a Account, e AuditEntry) error
+	// GetAccount returns ErrAccountNotFound if the owner has no account
+	// with the given ID.
+	GetAccount(ctx context.Context, ownerID, id string) (Account, error)
+	// ListAccounts returns the accounts selected by the query in the
+	// requested order.
+	ListAccounts(ctx context.Context, q AccountQuery) ([]Account, error)
+	// UpdateAccount replaces the stored account if its stored version
+	// still equals version, and returns ErrVersionMismatch otherwise.
+	UpdateAccount(ctx context.Context, a Account, version int64,
+		e AuditEntry) error
+	// DeleteAccount stores an account marked deleted by Account.Delete
+	// if its stored version still equals version, and returns
+	// ErrVersionMismatch otherwise. The account is removed from the
+	// portfolios holding it.
+	DeleteAccount(ctx context.Context, a Account, version int64,
+		e AuditEntry) error
+	// GetDeletedAccount returns ErrAccountNotFound if the owner has no
+	// deleted account with the given ID.
+	GetDeletedAccount(ctx context.Context, ownerID, id string,
+	) (Account, error)
+	// RestoreAccount stores an account restored by Account.Restore if
+	// its stored version still equals version.
+	RestoreAccount(ctx context.Context, a Account, version int64,
+		e AuditEntry) error
+	// PurgeDeletedAccounts removes the accounts deleted before the given
+	// time for good and returns how many there were. Their audit chains
+	// are kept and end with an AuditPurge entry by the SystemActor.
+	PurgeDeletedAccounts(ctx context.Context, before time.Time,
+	) (int, error)
+	// ListDerivedAccounts returns up to limit accounts of any owner
+	// that derive addresses from an extended key, by creation and then
+	// ID. Only accounts past after are returned when it is not nil.
+	ListDerivedAccounts(ctx context.Context, after *AccountPosition,
+		limit int) ([]Account, error)
+	// FindAddresses returns an entry for every account of the owner
+	// that holds one of the given canonical addresses, ordered by
+	// address and then account creation.
+	FindAddresses(ctx context.Context, ownerID string,
+		addrs ...string) ([]AddressMatch, error)
+	// AccountUsage counts the accounts of the owner and the addresses
+	// they hold.
+	AccountUsage(ctx context.Context, ownerID string) (Usage, error)
+}
@@ -0,0 +1,244 @@
+// Package address decodes and validates the addresses of the supported
+// UTXO chains. It supports Base58Check (P2PKH, P2SH), Bech32 (P2WPKH,
+// P2WSH), Bech32m (P2TR) and CashAddr encodings and reports the networks
+// an address is valid on. The parameters of every chain are kept in a
+// registry, see ChainParams.
+package address
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ScriptType is the kind of output script an address pays to.
+type ScriptType string
+
+const (
+	P2PKH  ScriptType = "p2pkh"
+	P2SH   ScriptType = "p2sh"
+	P2WPKH ScriptType = "p2wpkh"
+	P2WSH  ScriptType = "p2wsh"
+	P2TR   ScriptType = "p2tr"
+	// WitnessUnknown is a valid segwit address for a witness version that
+	// has no defined meaning yet.
+	WitnessUnknown ScriptType = "witness_unknown"
+)
+
+// ErrUnknownFormat is returned for strings that are not addresses of a
+// known chain.
+var ErrUnknownFormat = errors.New("is not a recognised address")
+
+// Address is a decoded Bitcoin address.
+type Address struct {
+	// Encoded is the canonical string form. Bech32 addresses are
+	// lower-cased and legacy addresses of chains with CashAddr are
+	// converted to it.
+	Encoded string
+	Type    ScriptType
+	// Chain is the chain the address was decoded for.
+	Chain Chain
+	// Networks lists every network of the chain the address is valid
+	// on. Test networks share some encodings so this can hold more than
+	// one network.
+	Networks []Network
+	// WitnessVersion is -1 for non-segwit addresses.
+	WitnessVersion int
+	// Program is the hash or witness program the address commits to.
+	Program []byte
+}
+
+func (a Address) String() string {
+	return a.Encoded
+}
+
+// ValidOn reports whether the address can be used on network n.
+func (a Address) ValidOn(n Network) bool {
+	return slices.Contains(a.Networks, n)
+}
+
+// Parse decodes and validates s as a Bitcoin address.
+func Parse(s string) (Address, error) {
+	return ParseOn(Bitcoin, s)
+}
+
+// ParseOn decodes and validates s as an address of chain c.
+func ParseOn(c Chain, s string) (Address, error) {
+	ps := chainParams(c)
+	if s == "" || len(ps) == 0 {
+		return Address{}, ErrUnknownFormat
+	}
+	lower := strings.ToLower(s)
+	if prefix, payload, ok := strings.Cut(lower, ":"); ok {
+		return parseCashAddr(ps, prefix, payload, s)
+	}
+	// CashAddr addresses may leave out their prefix
+	for _, p := range ps {
+		if p.CashAddrPrefix == "" {
+			continue
+		}
+		a, err := parseCashAddr(ps, p.CashAddrPrefix, lower, s)
+		if err == nil {
+			return a, nil
+		}
+	}
+	if hrp, _, ok := strings.Cut(lower, "1"); ok && hasHRP(ps, hrp) {
+		return parseSegwit(ps, s)
+	}
+	return parseBase58(ps, s)
+}
+
+// ParseAny decodes s as an address of the first chain, in the order of
+// Chains, it is valid on. Errors are the ones of Bitcoin.
+func ParseAny(s string) (Address, error) {
+	a, err := Parse(s)
+	if err == nil {
+		return a, nil
+	}
+	for _, c := range Chains[1:] {
+		if a, err := ParseOn(c, s); err == nil {
+			return a, nil
+		}
+	}
+	return Address{}, err
+}
+
+func hasHRP(ps []ChainParams, hrp string) bool {
+	for _, p := range ps {
+		if p.HRP != "" && p.HRP == hrp {
+			return true
+		}
+	}
+	return false
+}
+
+func parseBase58(ps []ChainParams, s string) (Address, error) {
+	ver, payload, err := base58CheckDecode(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if len(payload) != 20 {
+		return Address{}, fmt.Errorf(
+			"has a %d byte hash, expected 20", len(payload))
+	}
+	a := Address{Encoded: s, Chain: ps[0].Chain, WitnessVersion: -1,
+		Program: payload}
+	prefix := ""
+	for _, p := range ps {
+		switch ver {
+		case p.PubKeyHash:
+			a.Type = P2PKH
+		case p.ScriptHash:
+			a.Type = P2SH
+		default:
+			continue
+		}
+		if len(a.Networks) == 0 {
+			prefix = p.CashAddrPrefix
+		}
+		a.Networks = append(a.Networks, p.Network)
+	}
+	if len(a.Networks) == 0 {
+		return Address{}, fmt.Errorf(
+			"has unknown version byte 0x%02x", ver)
+	}
+	// Legacy addresses of chains with CashAddr are stored as CashAddr,
+	// so that both forms of an address are the same. Test networks share
+	// their version bytes, the prefix of the first one is used.
+	if prefix != "" {
+		a.Encoded = encodeCashAddr(prefix, a.Type, payload)
+	}
+	return a, nil
+}
+
+func parseSegwit(ps []ChainParams, s string) (Address, error) {
+	hrp, data, variant, err := bech32Decode(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if len(data) < 1 {
+		return Address{}, errBech32Length
+	}
+	ver := int(data[0])
+	prog, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return Address{}, err
+	}
+	if ver > 16 {
+		return Address{}, fmt.Errorf("has invalid witness version %d", ver)
+	}
+	if len(prog) < 2 || len(prog) > 40 {
+		return Address{}, fmt.Errorf(
+			"has a %d byte witness program, expected 2 to 40",
+			len(prog))
+	}
+	switch {
+	case ver == 0 && variant != bech32:
+		return Address{}, errors.New(
+			"is a version 0 witness address not encoded as bech32")
+	case ver != 0 && variant != bech32m:
+		return Address{}, errors.New(
+			"is a version 1+ witness address not encoded as bech32m")
+	}
+
+	a := Address{
+		Encoded:        strings.ToLower(s),
+		Chain:          ps[0].Chain,
+		WitnessVersion: ver,
+		Program:        prog,
+	}
+	switch {
+	case ver == 0 && len(prog) == 20:
+		a.Type = P2WPKH
+	case ver == 0 && len(prog) == 32:
+		a.Type = P2WSH
+	case ver == 0:
+		return Address{}, fmt.Errorf(
+			"has a %d byte version 0 witness program, "+
+				"expected 20 or 32", len(prog))
+	case ver == 1 && len(prog) == 32:
+		a.Type = P2TR
+	default:
+		a.Type = WitnessUnknown
+	}
+	for _, p := range ps {
+		if p.HRP == hrp {
+			a.Networks = append(a.Networks, p.Network)
+		}
+	}
+	return a, nil
+}
+
+// CommonNetwork returns the network shared by the most addresses along
+// with the addresses that are not valid on it. Ties are broken in favour
+// of the first address. It returns an empty network for an empty list.
+func CommonNetwork(as []Address) (Network, []Address) {
+	var (
+		best  Network
+		count int
+	)
+	if len(as) > 0 {
+		// Prefer the networks of the first address on ties
+		order := append(slices.Clone(as[0].Networks),
+			ChainNetworks(as[0].Chain)...)
+		for _, n := range order {
+			c := 0
+			for _, a := range as {
+				if a.ValidOn(n) {
+					c++
+				}
+			}
+			if c > count {
+				best, count = n, c
+			}
+		}
+	}
+	var odd []Address
+	for _, a := range as {
+		if !a.ValidOn(best) {
+			odd = append(odd, a)
+		}
+	}
+	return best, odd
+}
@@ -0,0 +1,357 @@
+package address
+
+import (
+	"encoding/hex"
+	"slices"
+	"testing"
+)
+
+// The vectors of chains without test vectors of their own were encoded
+// with the reference implementations of BIP173, BIP350 and CashAddr from
+// the key hash 751e76e8… of BIP173 and the script hash b472a266… of
+// 3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy.
+
+var (
+	testnets = []Network{Testnet, Testnet4, Signet}
+	// Bitcoin shares its legacy test version bytes with regtest
+	bitcoinTestnets = []Network{Testnet, Testnet4, Signet, Regtest}
+)
+
+func TestParseOnValid(t *testing.T) {
+	tests := []struct {
+		chain    Chain
+		in       string
+		encoded  string
+		typ      ScriptType
+		networks []Network
+		version  int
+		program  string
+	}{
+		// BIP173 and BIP350
+		{Bitcoin, "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4",
+			"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", P2WPKH,
+			[]Network{Mainnet}, 0,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Bitcoin, "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7",
+			"", P2WSH, testnets, 0,
+			"1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{Bitcoin, "bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y",
+			"", WitnessUnknown, []Network{Mainnet}, 1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6" +
+				"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Bitcoin, "BC1SW50QGDZ25J", "bc1sw50qgdz25j", WitnessUnknown,
+			[]Network{Mainnet}, 16, "751e"},
+		{Bitcoin, "bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", "",
+			WitnessUnknown, []Network{Mainnet}, 2,
+			"751e76e8199196d454941c45d1b3a323"},
+		{Bitcoin, "tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy",
+			"", P2WSH, testnets, 0,
+			"000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{Bitcoin, "tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c",
+			"", P2TR, testnets, 1,
+			"000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{Bitcoin, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0",
+			"", P2TR, []Network{Mainnet}, 1,
+			"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{Bitcoin, "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", "",
+			P2WPKH, []Network{Regtest}, 0,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		// Base58Check
+		{Bitcoin, "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", "", P2PKH,
+			[]Network{Mainnet}, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Bitcoin, "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", "", P2SH,
+			[]Network{Mainnet}, -1,
+			"b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"},
+		{Bitcoin, "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r", "", P2PKH,
+			bitcoinTestnets, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Bitcoin, "2N9hLwkSqr1cPQAPxbrGVUjxyjD11G2e1he", "", P2SH,
+			bitcoinTestnets, -1,
+			"b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"},
+
+		{Litecoin, "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n9", "",
+			P2WPKH, []Network{Mainnet}, 0,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Litecoin, "ltc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qmu8tk5",
+			"", P2WSH, []Network{Mainnet}, 0,
+			"1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{Litecoin, "ltc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqpj6zg2",
+			"", P2TR, []Network{Mainnet}, 1,
+			"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{Litecoin, "tltc1qw508d6qejxtdg4y5r3zarvary0c5xw7klfsuq0", "",
+			P2WPKH, []Network{Testnet}, 0,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Litecoin, "rltc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqsyzyjh",
+			"", P2TR, []Network{Regtest}, 1,
+			"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{Litecoin, "LVuDpNCSSj6pQ7t9Pv6d6sUkLKoqDEVUnJ", "", P2PKH,
+			[]Network{Mainnet}, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Litecoin, "MQMHBtvnBfxTzt3K2bdxgSE7qZPHSXWsGM", "", P2SH,
+			[]Network{Mainnet}, -1,
+			"b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"},
+		{Litecoin, "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r", "", P2PKH,
+			[]Network{Testnet, Regtest}, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Litecoin, "Qd474mK5s7fUYMA1DxJWZSQQsbSq6maeug", "", P2SH,
+			[]Network{Testnet, Regtest}, -1,
+			"b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"},
+
+		// The examples of the CashAddr specification
+		{BitcoinCash, "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			"", P2PKH, []Network{Mainnet}, -1,
+			"76a04053bda0a88bda5177b86a15c3b29f559873"},
+		{BitcoinCash, "bitcoincash:ppm2qsznhks23z7629mms6s4cwef74vcwvn0h829pq",
+			"", P2SH, []Network{Mainnet}, -1,
+			"76a04053bda0a88bda5177b86a15c3b29f559873"},
+		{BitcoinCash, "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu",
+			"bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			P2PKH, []Network{Mainnet}, -1,
+			"76a04053bda0a88bda5177b86a15c3b29f559873"},
+		{BitcoinCash, "3CWFddi6m4ndiGyKqzYvsFYagqDLPVMTzC",
+			"bitcoincash:ppm2qsznhks23z7629mms6s4cwef74vcwvn0h829pq",
+			P2SH, []Network{Mainnet}, -1,
+			"76a04053bda0a88bda5177b86a15c3b29f559873"},
+		{BitcoinCash, "BITCOINCASH:QP63UAHGRXGED4Z5JSWYT5DN5V3LZSEM6CY4SPDC2H",
+			"bitcoincash:qp63uahgrxged4z5jswyt5dn5v3lzsem6cy4spdc2h",
+			P2PKH, []Network{Mainnet}, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{BitcoinCash, "qp63uahgrxged4z5jswyt5dn5v3lzsem6cy4spdc2h",
+			"bitcoincash:qp63uahgrxged4z5jswyt5dn5v3lzsem6cy4spdc2h",
+			P2PKH, []Network{Mainnet}, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{BitcoinCash, "bchtest:qp63uahgrxged4z5jswyt5dn5v3lzsem6cq85x00dt",
+			"", P2PKH, []Network{Testnet}, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{BitcoinCash, "bchreg:pz689gnx6z7cnsfhq6jpxtx0k9hhcwulev2kn66dj4",
+			"", P2SH, []Network{Regtest}, -1,
+			"b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"},
+		{BitcoinCash, "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r",
+			"bchtest:qp63uahgrxged4z5jswyt5dn5v3lzsem6cq85x00dt",
+			P2PKH, []Network{Testnet, Regtest}, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+
+		{Dogecoin, "DFpN6QqFfUm3gKNaxN6tNcab1FArL9cZLE", "", P2PKH,
+			[]Network{Mainnet}, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Dogecoin, "A8tPcraiJcyw6k8tLrK36vc6DSAsXwu8f7", "", P2SH,
+			[]Network{Mainnet}, -1,
+			"b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"},
+		{Dogecoin, "nesRpRaAbTDmZHwmzBkLd2AtF7Z9L9z5S2", "", P2PKH,
+			[]Network{Testnet}, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{Dogecoin, "2N9hLwkSqr1cPQAPxbrGVUjxyjD11G2e1he", "", P2SH,
+			[]Network{Testnet, Regtest}, -1,
+			"b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"},
+		{Dogecoin, "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r", "", P2PKH,
+			[]Network{Regtest}, -1,
+			"751e76e8199196d454941c45d1b3a323f1433bd6"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.chain)+"/"+tt.in, func(t *testing.T) {
+			a, err := ParseOn(tt.chain, tt.in)
+			if err != nil {
+				t.Fatalf("ParseOn: %v", err)
+			}
+			encoded := tt.encoded
+			if encoded == "" {
+				encoded = tt.in
+			}
+			if a.Encoded != encoded {
+				t.Errorf("Encoded = %q, want %q", a.Encoded, encoded)
+			}
+			if a.Chain != tt.chain || a.Type != tt.typ {
+				t.Errorf("got %s %s, want %s %s",
+					a.Chain, a.Type, tt.chain, tt.typ)
+			}
+			if !slices.Equal(a.Networks, tt.networks) {
+				t.Errorf("Networks = %v, want %v", a.Networks, tt.networks)
+			}
+			if a.WitnessVersion != tt.version {
+				t.Errorf("WitnessVersion = %d, want %d",
+					a.WitnessVersion, tt.version)
+			}
+			if p := hex.EncodeToString(a.Program); p != tt.program {
+				t.Errorf("Program = %s, want %s", p, tt.program)
+			}
+		})
+	}
+}
+
+func TestParseOnInvalid(t *testing.T) {
+	tests := []struct {
+		chain Chain
+		in    string
+		why   string
+	}{
+		// BIP173 and BIP350
+		{Bitcoin, "tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut",
+			"unknown HRP"},
+		{Bitcoin, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd",
+			"version 1 with a bech32 checksum"},
+		{Bitcoin, "tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf",
+			"version 2 with a bech32 checksum"},
+		{Bitcoin, "BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL",
+			"version 16 with a bech32 checksum"},
+		{Bitcoin, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh",
+			"version 0 with a bech32m checksum"},
+		{Bitcoin, "tb1q0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq24jc47",
+			"version 0 with a bech32m checksum"},
+		{Bitcoin, "bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4",
+			"invalid character"},
+		{Bitcoin, "BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7ZWS8R",
+			"witness version 17"},
+		{Bitcoin, "bc1pw5dgrnzv", "1 byte program"},
+		{Bitcoin, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v8n0nx0muaewav253zgeav",
+			"41 byte program"},
+		{Bitcoin, "BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P",
+			"16 byte version 0 program"},
+		{Bitcoin, "tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq47Zagq",
+			"mixed case"},
+		{Bitcoin, "bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du",
+			"more than 4 padding bits"},
+		{Bitcoin, "tb1pw508d6qejxtdg4y5r3zarqfsj6c3", "non-zero padding"},
+		{Bitcoin, "bc1gmk9yu", "empty data"},
+		{Litecoin, "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n8",
+			"bad checksum"},
+		{Litecoin, "ltc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0",
+			"checksum of another HRP"},
+		// Base58Check
+		{Bitcoin, "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMJ", "bad checksum"},
+		{Bitcoin, "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAM0", "invalid character"},
+		{Bitcoin, "1p8KevEo5z2dqhHVZQ6v6D6s8PRnAtbespV", "21 byte hash"},
+		{Litecoin, "LVuDpNCSSj6pQ7t9Pv6d6sUkLKoqDEVUnK", "bad checksum"},
+		{BitcoinCash, "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMJ", "bad checksum"},
+		{Dogecoin, "DFpN6QqFfUm3gKNaxN6tNcab1FArL9cZLF", "bad checksum"},
+		{Dogecoin, "3n3aKu58rVwqe15teTz4wHfskZDAp5dDK", "19 byte hash"},
+		// CashAddr
+		{BitcoinCash, "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6b",
+			"bad checksum"},
+		{BitcoinCash, "bchtest:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			"checksum of another prefix"},
+		{BitcoinCash, "bitcoincash:Qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			"mixed case"},
+		{BitcoinCash, "bitcoincash:zp63uahgrxged4z5jswyt5dn5v3lzsem6crlrlr74y",
+			"unknown type"},
+		{BitcoinCash, "bitcoincash:q963uahgrxged4z5jswyt5dn5v3lzsem6ctv4y2whh",
+			"hash shorter than its size bits"},
+		{BitcoinCash, "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwv",
+			"too short"},
+		{BitcoinCash, "ecash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			"unknown prefix"},
+		{Dogecoin, "", "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.chain)+"/"+tt.why, func(t *testing.T) {
+			if a, err := ParseOn(tt.chain, tt.in); err == nil {
+				t.Errorf("ParseOn(%q) = %v, want an error", tt.in, a)
+			}
+		})
+	}
+}
+
+func TestParseOnOtherChains(t *testing.T) {
+	own := map[Chain][]string{
+		Bitcoin: {
+			"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+			"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0",
+			"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7",
+			"bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080",
+		},
+		Litecoin: {
+			"ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n9",
+			"tltc1qw508d6qejxtdg4y5r3zarvary0c5xw7klfsuq0",
+			"LVuDpNCSSj6pQ7t9Pv6d6sUkLKoqDEVUnJ",
+			"MQMHBtvnBfxTzt3K2bdxgSE7qZPHSXWsGM",
+			"Qd474mK5s7fUYMA1DxJWZSQQsbSq6maeug",
+		},
+		BitcoinCash: {
+			"bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			"qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			"bchtest:qp63uahgrxged4z5jswyt5dn5v3lzsem6cq85x00dt",
+		},
+		Dogecoin: {
+			"DFpN6QqFfUm3gKNaxN6tNcab1FArL9cZLE",
+			"A8tPcraiJcyw6k8tLrK36vc6DSAsXwu8f7",
+			"nesRpRaAbTDmZHwmzBkLd2AtF7Z9L9z5S2",
+		},
+	}
+	for owner, as := range own {
+		for _, s := range as {
+			if _, err := ParseOn(owner, s); err != nil {
+				t.Errorf("ParseOn(%s, %q): %v", owner, s, err)
+			}
+			for _, c := range Chains {
+				if c == owner {
+					continue
+				}
+				if a, err := ParseOn(c, s); err == nil {
+					t.Errorf("ParseOn(%s, %q) = %v, want an error",
+						c, s, a)
+				}
+			}
+		}
+	}
+}
+
+func TestParseOnSharedLegacy(t *testing.T) {
+	// Bitcoin Cash kept the legacy version bytes of Bitcoin
+	for _, s := range []string{
+		"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH",
+		"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+	} {
+		btc, err := ParseOn(Bitcoin, s)
+		if err != nil {
+			t.Fatalf("ParseOn(bitcoin, %q): %v", s, err)
+		}
+		bch, err := ParseOn(BitcoinCash, s)
+		if err != nil {
+			t.Fatalf("ParseOn(bitcoincash, %q): %v", s, err)
+		}
+		if !slices.Equal(btc.Program, bch.Program) || btc.Type != bch.Type {
+			t.Errorf("%q decodes differently on the two chains", s)
+		}
+	}
+}
+
+func TestCommonNetwork(t *testing.T) {
+	parse := func(ss ...string) []Address {
+		var as []Address
+		for _, s := range ss {
+			a, err := Parse(s)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", s, err)
+			}
+			as = append(as, a)
+		}
+		return as
+	}
+	tests := []struct {
+		name string
+		in   []Address
+		want Network
+		odd  int
+	}{
+		{"empty", nil, "", 0},
+		{"mainnet", parse(
+			"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH",
+			"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"), Mainnet, 0},
+		{"legacy and regtest", parse(
+			"mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r",
+			"bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080"), Regtest, 0},
+		{"mixed", parse(
+			"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7",
+			"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH",
+			"2N9hLwkSqr1cPQAPxbrGVUjxyjD11G2e1he"), Testnet, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, odd := CommonNetwork(tt.in)
+			if n != tt.want || len(odd) != tt.odd {
+				t.Errorf("CommonNetwork = %s, %d odd, want %s, %d odd",
+					n, len(odd), tt.want, tt.odd)
+			}
+		})
+	}
+}
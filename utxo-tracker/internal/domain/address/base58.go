@@ -0,0 +1,118 @@
+package address
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"slices"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var base58Index = func() [256]int8 {
+	var idx [256]int8
+	for i := range idx {
+		idx[i] = -1
+	}
+	for i := 0; i < len(base58Alphabet); i++ {
+		idx[base58Alphabet[i]] = int8(i)
+	}
+	return idx
+}()
+
+var (
+	errBase58Char     = errors.New("contains a character outside the base58 alphabet")
+	errBase58Checksum = errors.New("has an invalid base58check checksum")
+)
+
+// base58Decode decodes a base58 string into bytes.
+func base58Decode(s string) ([]byte, error) {
+	// Every input character contributes log(58)/log(256) < 0.74 bytes.
+	out := make([]byte, 0, len(s)*3/4+1)
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	for i := zeros; i < len(s); i++ {
+		d := base58Index[s[i]]
+		if d < 0 {
+			return nil, errBase58Char
+		}
+		carry := int(d)
+		// out holds the little endian value decoded so far
+		for j := range out {
+			carry += int(out[j]) * 58
+			out[j] = byte(carry)
+			carry >>= 8
+		}
+		for carry > 0 {
+			out = append(out, byte(carry))
+			carry >>= 8
+		}
+	}
+	res := make([]byte, zeros+len(out))
+	for i, b := range out {
+		res[len(res)-1-i] = b
+	}
+	return res, nil
+}
+
+// checksum returns the first four bytes of the double SHA-256 of b.
+func checksum(b []byte) []byte {
+	h := sha256.Sum256(b)
+	h = sha256.Sum256(h[:])
+	return h[:4]
+}
+
+// base58CheckDecode decodes s and verifies its checksum. It returns the
+// version byte and the payload.
+func base58CheckDecode(s string) (byte, []byte, error) {
+	b, err := base58Decode(s)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(b) < 5 {
+		return 0, nil, errBase58Checksum
+	}
+	data, sum := b[:len(b)-4], b[len(b)-4:]
+	if !bytes.Equal(checksum(data), sum) {
+		return 0, nil, errBase58Checksum
+	}
+	return data[0], data[1:], nil
+}
+
+// base58Encode encodes b in base58.
+func base58Encode(b []byte) string {
+	zeros := 0
+	for zeros < len(b) && b[zeros] == 0 {
+		zeros++
+	}
+	// Every input byte contributes log(256)/log(58) < 1.37 digits.
+	digits := make([]byte, 0, len(b)*138/100+1)
+	for _, v := range b[zeros:] {
+		carry := int(v)
+		// digits holds the little endian base58 value encoded so far
+		for j := range digits {
+			carry += int(digits[j]) << 8
+			digits[j] = byte(carry % 58)
+			carry /= 58
+		}
+		for carry > 0 {
+			digits = append(digits, byte(carry%58))
+			carry /= 58
+		}
+	}
+	out := make([]byte, zeros+len(digits))
+	for i := 0; i < zeros; i++ {
+		out[i] = '1'
+	}
+	for i, d := range digits {
+		out[len(out)-1-i] = base58Alphabet[d]
+	}
+	return string(out)
+}
+
+// base58CheckEncode encodes data followed by its checksum.
+func base58CheckEncode(data []byte) string {
+	return base58Encode(append(slices.Clone(data), checksum(data)...))
+}
@@ -0,0 +1,147 @@
+package address
+
+import (
+	"errors"
+	"strings"
+)
+
+// Bech32 as specified by BIP173 and its Bech32m variant from BIP350.
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+type bech32Variant int
+
+const (
+	bech32  bech32Variant = 1
+	bech32m bech32Variant = 0x2bc830a3
+)
+
+var (
+	errBech32Case     = errors.New("mixes upper and lower case characters")
+	errBech32Length   = errors.New("has an invalid bech32 length")
+	errBech32Char     = errors.New("contains a character outside the bech32 alphabet")
+	errBech32Checksum = errors.New("has an invalid bech32 checksum")
+	errBech32Padding  = errors.New("has invalid bech32 padding")
+)
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{
+		0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// bech32Decode splits s into its human readable part and 5-bit data
+// values, verifies the checksum and reports which variant it matched.
+func bech32Decode(s string) (string, []byte, bech32Variant, error) {
+	if len(s) > 90 {
+		return "", nil, 0, errBech32Length
+	}
+	lower := strings.ToLower(s)
+	if lower != s && strings.ToUpper(s) != s {
+		return "", nil, 0, errBech32Case
+	}
+	s = lower
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, 0, errBech32Length
+	}
+	hrp := s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, errBech32Char
+		}
+	}
+	data := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		d := strings.IndexByte(bech32Charset, s[i])
+		if d < 0 {
+			return "", nil, 0, errBech32Char
+		}
+		data = append(data, byte(d))
+	}
+	var v bech32Variant
+	switch bech32Polymod(append(bech32HRPExpand(hrp), data...)) {
+	case uint32(bech32):
+		v = bech32
+	case uint32(bech32m):
+		v = bech32m
+	default:
+		return "", nil, 0, errBech32Checksum
+	}
+	return hrp, data[:len(data)-6], v, nil
+}
+
+// bech32Encode encodes the 5-bit data values with the checksum of the
+// given variant.
+func bech32Encode(hrp string, data []byte, v bech32Variant) string {
+	values := append(bech32HRPExpand(hrp), data...)
+	chk := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ uint32(v)
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, d := range data {
+		b.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[chk>>uint(5*(5-i))&31])
+	}
+	return b.String()
+}
+
+// encodeSegwit returns the address of a witness program.
+func encodeSegwit(hrp string, ver int, prog []byte) string {
+	data, _ := convertBits(prog, 8, 5, true)
+	v := bech32m
+	if ver == 0 {
+		v = bech32
+	}
+	return bech32Encode(hrp, append([]byte{byte(ver)}, data...), v)
+}
+
+// convertBits regroups a slice of from-bit values into to-bit values.
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	acc, bits := uint(0), uint(0)
+	maxv := uint(1)<<to - 1
+	out := make([]byte, 0, len(data)*int(from)/int(to)+1)
+	for _, v := range data {
+		if uint(v)>>from != 0 {
+			return nil, errBech32Char
+		}
+		acc = acc<<from | uint(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, errBech32Padding
+	}
+	return out, nil
+}
@@ -0,0 +1,133 @@
+package address
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CashAddr as specified for Bitcoin Cash. It shares its alphabet with
+// Bech32 but uses a 40 bit checksum and a version byte that encodes the
+// address type and hash size.
+
+var (
+	errCashAddrLength   = errors.New("has an invalid CashAddr length")
+	errCashAddrChecksum = errors.New("has an invalid CashAddr checksum")
+)
+
+// cashAddrHashSizes maps the size bits of the version byte to the hash
+// length in bytes.
+var cashAddrHashSizes = [8]int{20, 24, 28, 32, 40, 48, 56, 64}
+
+func cashAddrPolymod(values []byte) uint64 {
+	gen := [5]uint64{
+		0x98f2bc8e61, 0x79b76d99e2, 0xf33e5fb3c4, 0xae2eabe2a8, 0x1e4f43e470}
+	c := uint64(1)
+	for _, v := range values {
+		top := c >> 35
+		c = (c&0x07ffffffff)<<5 ^ uint64(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				c ^= gen[i]
+			}
+		}
+	}
+	return c ^ 1
+}
+
+func cashAddrPrefixExpand(prefix string) []byte {
+	out := make([]byte, 0, len(prefix)+1)
+	for i := 0; i < len(prefix); i++ {
+		out = append(out, prefix[i]&0x1f)
+	}
+	return append(out, 0)
+}
+
+// encodeCashAddr returns the CashAddr address of a hash of the given
+// type.
+func encodeCashAddr(prefix string, t ScriptType, hash []byte) string {
+	ver := byte(0)
+	if t == P2SH {
+		ver = 1 << 3
+	}
+	for i, size := range cashAddrHashSizes {
+		if size == len(hash) {
+			ver |= byte(i)
+		}
+	}
+	data, _ := convertBits(append([]byte{ver}, hash...), 8, 5, true)
+	chk := cashAddrPolymod(append(append(cashAddrPrefixExpand(prefix),
+		data...), 0, 0, 0, 0, 0, 0, 0, 0))
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteByte(':')
+	for _, d := range data {
+		b.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 8; i++ {
+		b.WriteByte(bech32Charset[chk>>uint(5*(7-i))&31])
+	}
+	return b.String()
+}
+
+// parseCashAddr decodes the payload of s, given in lower case, as a
+// CashAddr address with the given prefix.
+func parseCashAddr(ps []ChainParams, prefix, payload, s string,
+) (Address, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return Address{}, errBech32Case
+	}
+	a := Address{Chain: ps[0].Chain, WitnessVersion: -1}
+	for _, p := range ps {
+		if p.CashAddrPrefix != "" && p.CashAddrPrefix == prefix {
+			a.Networks = append(a.Networks, p.Network)
+		}
+	}
+	if len(a.Networks) == 0 {
+		return Address{}, ErrUnknownFormat
+	}
+	if len(payload) < 8+34 || len(payload) > 8+104 {
+		return Address{}, errCashAddrLength
+	}
+	data := make([]byte, 0, len(payload))
+	for i := 0; i < len(payload); i++ {
+		d := strings.IndexByte(bech32Charset, payload[i])
+		if d < 0 {
+			return Address{}, errBech32Char
+		}
+		data = append(data, byte(d))
+	}
+	if cashAddrPolymod(append(cashAddrPrefixExpand(prefix), data...)) != 0 {
+		return Address{}, errCashAddrChecksum
+	}
+	b, err := convertBits(data[:len(data)-8], 5, 8, false)
+	if err != nil {
+		return Address{}, err
+	}
+	ver, hash := b[0], b[1:]
+	if ver&0x80 != 0 {
+		return Address{}, fmt.Errorf(
+			"has invalid CashAddr version 0x%02x", ver)
+	}
+	if size := cashAddrHashSizes[ver&0x07]; len(hash) != size {
+		return Address{}, fmt.Errorf(
+			"has a %d byte hash, expected %d", len(hash), size)
+	}
+	switch ver >> 3 {
+	case 0:
+		a.Type = P2PKH
+	case 1:
+		a.Type = P2SH
+	default:
+		return Address{}, fmt.Errorf(
+			"has unsupported CashAddr type %d", ver>>3)
+	}
+	if a.Type == P2PKH && len(hash) != 20 ||
+		a.Type == P2SH && len(hash) != 20 && len(hash) != 32 {
+		return Address{}, fmt.Errorf(
+			"has a %d byte %s hash", len(hash), a.Type)
+	}
+	a.Encoded = prefix + ":" + payload
+	a.Program = hash
+	return a, nil
+}
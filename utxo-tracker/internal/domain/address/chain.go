@@ -0,0 +1,137 @@
+package address
+
+import (
+	"slices"
+	"time"
+)
+
+// Chain identifies a UTXO chain.
+type Chain string
+
+const (
+	Bitcoin     Chain = "bitcoin"
+	Litecoin    Chain = "litecoin"
+	BitcoinCash Chain = "bitcoincash"
+	Dogecoin    Chain = "dogecoin"
+)
+
+// Chains lists the supported chains.
+var Chains = []Chain{Bitcoin, Litecoin, BitcoinCash, Dogecoin}
+
+// ChainParams holds the parameters of a network of a chain.
+type ChainParams struct {
+	Chain   Chain
+	Network Network
+	// PubKeyHash and ScriptHash are the Base58Check version bytes of
+	// P2PKH and P2SH addresses.
+	PubKeyHash byte
+	ScriptHash byte
+	// HRP is the human readable part of Bech32 addresses. It is empty
+	// on chains without segwit.
+	HRP string
+	// CashAddrPrefix is the prefix of CashAddr addresses. It is empty on
+	// chains that do not use CashAddr.
+	CashAddrPrefix string
+	// CoinType is the BIP44 coin type. Test networks share coin type 1.
+	CoinType uint32
+	// XPubVersion is the version of the chain's own extended public
+	// keys, if it has any beside the SLIP-0132 ones.
+	XPubVersion uint32
+	// DustLimit is the smallest standard output, in the chain's base
+	// unit.
+	DustLimit int64
+	// BlockTime is the targeted time between blocks.
+	BlockTime time.Duration
+}
+
+// registry holds the parameters of every supported network, in the
+// order of Chains and then of preference within the chain.
+var registry = []ChainParams{
+	{Chain: Bitcoin, Network: Mainnet, PubKeyHash: 0x00, ScriptHash: 0x05,
+		HRP: "bc", CoinType: 0, DustLimit: 546, BlockTime: 10 * time.Minute},
+	{Chain: Bitcoin, Network: Testnet, PubKeyHash: 0x6f, ScriptHash: 0xc4,
+		HRP: "tb", CoinType: 1, DustLimit: 546, BlockTime: 10 * time.Minute},
+	{Chain: Bitcoin, Network: Testnet4, PubKeyHash: 0x6f, ScriptHash: 0xc4,
+		HRP: "tb", CoinType: 1, DustLimit: 546, BlockTime: 10 * time.Minute},
+	{Chain: Bitcoin, Network: Signet, PubKeyHash: 0x6f, ScriptHash: 0xc4,
+		HRP: "tb", CoinType: 1, DustLimit: 546, BlockTime: 10 * time.Minute},
+	{Chain: Bitcoin, Network: Regtest, PubKeyHash: 0x6f, ScriptHash: 0xc4,
+		HRP: "bcrt", CoinType: 1, DustLimit: 546,
+		BlockTime: 10 * time.Minute},
+
+	{Chain: Litecoin, Network: Mainnet, PubKeyHash: 0x30, ScriptHash: 0x32,
+		HRP: "ltc", CoinType: 2, XPubVersion: 0x019da462,
+		DustLimit: 5460, BlockTime: 150 * time.Second},
+	{Chain: Litecoin, Network: Testnet, PubKeyHash: 0x6f, ScriptHash: 0x3a,
+		HRP: "tltc", CoinType: 1, DustLimit: 5460,
+		BlockTime: 150 * time.Second},
+	{Chain: Litecoin, Network: Regtest, PubKeyHash: 0x6f, ScriptHash: 0x3a,
+		HRP: "rltc", CoinType: 1, DustLimit: 5460,
+		BlockTime: 150 * time.Second},
+
+	{Chain: BitcoinCash, Network: Mainnet, PubKeyHash: 0x00,
+		ScriptHash: 0x05, CashAddrPrefix: "bitcoincash", CoinType: 145,
+		DustLimit: 546, BlockTime: 10 * time.Minute},
+	{Chain: BitcoinCash, Network: Testnet, PubKeyHash: 0x6f,
+		ScriptHash: 0xc4, CashAddrPrefix: "bchtest", CoinType: 1,
+		DustLimit: 546, BlockTime: 10 * time.Minute},
+	{Chain: BitcoinCash, Network: Regtest, PubKeyHash: 0x6f,
+		ScriptHash: 0xc4, CashAddrPrefix: "bchreg", CoinType: 1,
+		DustLimit: 546, BlockTime: 10 * time.Minute},
+
+	{Chain: Dogecoin, Network: Mainnet, PubKeyHash: 0x1e, ScriptHash: 0x16,
+		CoinType: 3, XPubVersion: 0x02facafd, DustLimit: 1_000_000,
+		BlockTime: time.Minute},
+	{Chain: Dogecoin, Network: Testnet, PubKeyHash: 0x71, ScriptHash: 0xc4,
+		CoinType: 1, DustLimit: 1_000_000, BlockTime: time.Minute},
+	{Chain: Dogecoin, Network: Regtest, PubKeyHash: 0x6f, ScriptHash: 0xc4,
+		CoinType: 1, DustLimit: 1_000_000, BlockTime: time.Minute},
+}
+
+// Registry returns the parameters of every supported network, grouped
+// by chain in the order of Chains.
+func Registry() []ChainParams {
+	return slices.Clone(registry)
+}
+
+// Params returns the parameters of network n of chain c.
+func Params(c Chain, n Network) (ChainParams, bool) {
+	for _, p := range registry {
+		if p.Chain == c && p.Network == n {
+			return p, true
+		}
+	}
+	return ChainParams{}, false
+}
+
+// ChainNetworks lists the networks of chain c, preferred ones first.
+func ChainNetworks(c Chain) []Network {
+	var out []Network
+	for _, p := range registry {
+		if p.Chain == c {
+			out = append(out, p.Network)
+		}
+	}
+	return out
+}
+
+// chainParams returns the parameters of the networks of chain c.
+func chainParams(c Chain) []ChainParams {
+	var out []ChainParams
+	for _, p := range registry {
+		if p.Chain == c {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ParseChain returns the chain with the given name.
+func ParseChain(s string) (Chain, bool) {
+	for _, c := range Chains {
+		if string(c) == s {
+			return c, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,355 @@
+package address
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Purpose is a BIP43 purpose. It fixes the script type of the addresses
+// derived below it.
+type Purpose uint32
+
+const (
+	// BIP44 derives P2PKH addresses
+	BIP44 Purpose = 44
+	// BIP49 derives P2WPKH addresses nested in P2SH
+	BIP49 Purpose = 49
+	// BIP84 derives P2WPKH addresses
+	BIP84 Purpose = 84
+	// BIP86 derives single key P2TR addresses
+	BIP86 Purpose = 86
+)
+
+// Purposes lists the supported purposes.
+var Purposes = []Purpose{BIP44, BIP49, BIP84, BIP86}
+
+// ScriptType returns the type of the addresses derived for p.
+func (p Purpose) ScriptType() ScriptType {
+	switch p {
+	case BIP49:
+		return P2SH
+	case BIP84:
+		return P2WPKH
+	case BIP86:
+		return P2TR
+	}
+	return P2PKH
+}
+
+// HardenedOffset is added to the index of hardened children.
+const HardenedOffset = 1 << 31
+
+// keyVersion is what the version bytes of an extended public key tell.
+type keyVersion struct {
+	test     bool
+	purpose  Purpose
+	multisig bool
+}
+
+// slip132 maps the extended public key versions registered in SLIP-0132
+// for Bitcoin, which other chains commonly use too.
+var slip132 = map[uint32]keyVersion{
+	0x0488b21e: {false, BIP44, false}, // xpub
+	0x049d7cb2: {false, BIP49, false}, // ypub
+	0x04b24746: {false, BIP84, false}, // zpub
+	0x0295b43f: {false, BIP49, true},  // Ypub
+	0x02aa7ed3: {false, BIP84, true},  // Zpub
+	0x043587cf: {true, BIP44, false},  // tpub
+	0x044a5262: {true, BIP49, false},  // upub
+	0x045f1cff: {true, BIP84, false},  // vpub
+	0x024289ef: {true, BIP49, true},   // Upub
+	0x02575483: {true, BIP84, true},   // Vpub
+}
+
+// slip132Private lists the versions of the private keys matching the
+// ones in slip132, so they can be refused as such.
+var slip132Private = []uint32{
+	0x0488ade4, // xprv
+	0x049d7878, // yprv
+	0x04b2430c, // zprv
+	0x04358394, // tprv
+	0x044a4e28, // uprv
+	0x045f18bc, // vprv
+	0x0295b005, // Yprv
+	0x02aa7a99, // Zprv
+	0x024285b5, // Uprv
+	0x02575048, // Vprv
+}
+
+// ExtendedKey is a BIP32 extended public key.
+type ExtendedKey struct {
+	// Encoded is the key as given
+	Encoded     string
+	Depth       byte
+	ChildNumber uint32
+	ChainCode   [32]byte
+	// PubKey is the compressed public key
+	PubKey [33]byte
+	// Test reports whether the version is one of the test networks
+	Test bool
+	// Purpose is the purpose the version stands for. Versions that do
+	// not tell, such as xpub, stand for BIP44.
+	Purpose Purpose
+	// Multisig is set for the versions of multisig keys, for which
+	// Purpose tells whether the script is nested in P2SH.
+	Multisig bool
+}
+
+// ParseExtendedKey decodes an extended public key of chain c. The
+// SLIP-0132 versions are accepted on every chain, along with the one of
+// the chain's registry entry.
+func ParseExtendedKey(c Chain, s string) (ExtendedKey, error) {
+	ver, payload, err := base58CheckDecode(s)
+	if err != nil {
+		return ExtendedKey{}, err
+	}
+	b := append([]byte{ver}, payload...)
+	if len(b) != 78 {
+		return ExtendedKey{}, fmt.Errorf(
+			"is %d bytes long, expected 78", len(b))
+	}
+	version := binary.BigEndian.Uint32(b[:4])
+	if slices.Contains(slip132Private, version) {
+		return ExtendedKey{}, ErrPrivateKey
+	}
+	kv, ok := slip132[version]
+	for _, p := range chainParams(c) {
+		if p.XPubVersion != 0 && p.XPubVersion == version {
+			kv, ok = keyVersion{p.Network != Mainnet, BIP44, false}, true
+		}
+	}
+	if !ok {
+		return ExtendedKey{}, fmt.Errorf(
+			"has unknown version 0x%08x", version)
+	}
+	k := ExtendedKey{
+		Encoded:     s,
+		Depth:       b[4],
+		ChildNumber: binary.BigEndian.Uint32(b[9:13]),
+		Test:        kv.test,
+		Purpose:     kv.purpose,
+		Multisig:    kv.multisig,
+	}
+	copy(k.ChainCode[:], b[13:45])
+	copy(k.PubKey[:], b[45:78])
+	if b[45] == 0 {
+		return ExtendedKey{}, ErrPrivateKey
+	}
+	if _, err := secp256k1.ParsePubKey(k.PubKey[:]); err != nil {
+		return ExtendedKey{}, errors.New("holds an invalid public key")
+	}
+	return k, nil
+}
+
+// ValidPubKey reports whether pub is a compressed public key on the
+// curve.
+func ValidPubKey(pub [33]byte) bool {
+	_, err := secp256k1.ParsePubKey(pub[:])
+	return err == nil && (pub[0] == 2 || pub[0] == 3)
+}
+
+// IsWIF reports whether s looks like a private key in wallet import
+// format, so that it can be refused without repeating it.
+func IsWIF(s string) bool {
+	_, payload, err := base58CheckDecode(s)
+	return err == nil && (len(payload) == 32 ||
+		len(payload) == 33 && payload[32] == 1)
+}
+
+// Child derives the non-hardened child key at index i.
+func (k ExtendedKey) Child(i uint32) (ExtendedKey, error) {
+	if i >= HardenedOffset {
+		return ExtendedKey{}, errors.New(
+			"cannot derive hardened children of a public key")
+	}
+	m := hmac.New(sha512.New, k.ChainCode[:])
+	m.Write(k.PubKey[:])
+	m.Write(binary.BigEndian.AppendUint32(nil, i))
+	sum := m.Sum(nil)
+
+	var tweak secp256k1.ModNScalar
+	if overflow := tweak.SetByteSlice(sum[:32]); overflow {
+		return ExtendedKey{}, errInvalidChild
+	}
+	parent, err := secp256k1.ParsePubKey(k.PubKey[:])
+	if err != nil {
+		return ExtendedKey{}, err
+	}
+	var p, t, r secp256k1.JacobianPoint
+	parent.AsJacobian(&p)
+	secp256k1.ScalarBaseMultNonConst(&tweak, &t)
+	secp256k1.AddNonConst(&p, &t, &r)
+	if (r.X.IsZero() && r.Y.IsZero()) || r.Z.IsZero() {
+		return ExtendedKey{}, errInvalidChild
+	}
+	r.ToAffine()
+
+	child := ExtendedKey{
+		Depth:       k.Depth + 1,
+		ChildNumber: i,
+		Test:        k.Test,
+		Purpose:     k.Purpose,
+		Multisig:    k.Multisig,
+	}
+	copy(child.ChainCode[:], sum[32:])
+	copy(child.PubKey[:],
+		secp256k1.NewPublicKey(&r.X, &r.Y).SerializeCompressed())
+	return child, nil
+}
+
+// Fingerprint returns the BIP32 fingerprint of a public key, which the
+// children of its extended key refer to it by.
+func Fingerprint(pub [33]byte) [4]byte {
+	var fp [4]byte
+	copy(fp[:], hash160(pub[:]))
+	return fp
+}
+
+// ErrPrivateKey is returned for extended private keys. Callers should
+// not repeat them back.
+var ErrPrivateKey = errors.New(
+	"is a private key, only public keys are accepted")
+
+// errInvalidChild is returned for the rare indexes BIP32 defines no key
+// for. Callers skip to the next index.
+var errInvalidChild = errors.New("derives no valid key")
+
+// IsInvalidChild reports whether err was returned for an index without
+// a key.
+func IsInvalidChild(err error) bool {
+	return errors.Is(err, errInvalidChild)
+}
+
+// FromPubKey returns the address paying to a compressed public key with
+// the script type of purpose on network p. CashAddr chains get CashAddr
+// addresses.
+func FromPubKey(p ChainParams, purpose Purpose, pub [33]byte,
+) (Address, error) {
+	if purpose != BIP44 && p.HRP == "" {
+		return Address{}, fmt.Errorf(
+			"BIP%d addresses need segwit, which %s lacks",
+			purpose, p.Chain)
+	}
+	var s string
+	switch purpose {
+	case BIP44:
+		h := hash160(pub[:])
+		s = base58CheckEncode(append([]byte{p.PubKeyHash}, h...))
+		if p.CashAddrPrefix != "" {
+			s = encodeCashAddr(p.CashAddrPrefix, P2PKH, h)
+		}
+	case BIP49:
+		redeem := append([]byte{0x00, 0x14}, hash160(pub[:])...)
+		s = base58CheckEncode(
+			append([]byte{p.ScriptHash}, hash160(redeem)...))
+	case BIP84:
+		s = encodeSegwit(p.HRP, 0, hash160(pub[:]))
+	case BIP86:
+		out, err := taprootOutputKey(pub, nil)
+		if err != nil {
+			return Address{}, err
+		}
+		s = encodeSegwit(p.HRP, 1, out)
+	default:
+		return Address{}, fmt.Errorf("has unknown purpose %d", purpose)
+	}
+	return ParseOn(p.Chain, s)
+}
+
+// FromScript returns the address paying to the hash of script on
+// network p, with script type P2SH or P2WSH. CashAddr chains get
+// CashAddr addresses.
+func FromScript(p ChainParams, t ScriptType, script []byte,
+) (Address, error) {
+	var s string
+	switch t {
+	case P2SH:
+		h := hash160(script)
+		s = base58CheckEncode(append([]byte{p.ScriptHash}, h...))
+		if p.CashAddrPrefix != "" {
+			s = encodeCashAddr(p.CashAddrPrefix, P2SH, h)
+		}
+	case P2WSH:
+		if p.HRP == "" {
+			return Address{}, fmt.Errorf(
+				"P2WSH addresses need segwit, which %s lacks", p.Chain)
+		}
+		h := sha256.Sum256(script)
+		s = encodeSegwit(p.HRP, 0, h[:])
+	default:
+		return Address{}, fmt.Errorf("cannot pay %s to a script", t)
+	}
+	return ParseOn(p.Chain, s)
+}
+
+// WitnessScriptHash returns the P2WSH output script paying to script,
+// which P2SH-P2WSH addresses nest.
+func WitnessScriptHash(script []byte) []byte {
+	h := sha256.Sum256(script)
+	return append([]byte{0x00, 0x20}, h[:]...)
+}
+
+func hash160(b []byte) []byte {
+	h := sha256.Sum256(b)
+	r := ripemd160.New()
+	r.Write(h[:])
+	return r.Sum(nil)
+}
+
+// FromTaproot returns the P2TR address of an internal key and the
+// merkle root of its script tree on network p.
+func FromTaproot(p ChainParams, internal [33]byte, root []byte,
+) (Address, error) {
+	if p.HRP == "" {
+		return Address{}, fmt.Errorf(
+			"P2TR addresses need segwit, which %s lacks", p.Chain)
+	}
+	out, err := taprootOutputKey(internal, root)
+	if err != nil {
+		return Address{}, err
+	}
+	return ParseOn(p.Chain, encodeSegwit(p.HRP, 1, out))
+}
+
+// taprootOutputKey tweaks an internal key with the merkle root of its
+// script tree as in BIP341, or without one as in BIP86, and returns the
+// x-only output key.
+func taprootOutputKey(pub [33]byte, root []byte) ([]byte, error) {
+	// The internal key is the one with the even Y coordinate
+	even := pub
+	even[0] = secp256k1.PubKeyFormatCompressedEven
+	internal, err := secp256k1.ParsePubKey(even[:])
+	if err != nil {
+		return nil, err
+	}
+	var tweak secp256k1.ModNScalar
+	if overflow := tweak.SetByteSlice(
+		taggedHash("TapTweak", append(even[1:], root...))); overflow {
+		return nil, errInvalidChild
+	}
+	var p, t, q secp256k1.JacobianPoint
+	internal.AsJacobian(&p)
+	secp256k1.ScalarBaseMultNonConst(&tweak, &t)
+	secp256k1.AddNonConst(&p, &t, &q)
+	q.ToAffine()
+	x := q.X.Bytes()
+	return x[:], nil
+}
+
+// taggedHash is the BIP340 tagged hash of msg.
+func taggedHash(tag string, msg []byte) []byte {
+	t := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(t[:])
+	h.Write(t[:])
+	h.Write(msg)
+	return h.Sum(nil)
+}
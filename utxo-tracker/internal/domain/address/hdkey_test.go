@@ -0,0 +1,150 @@
+package address
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// bip32Step is a key of a BIP32 test vector along with the index it was
+// derived at from the step before.
+type bip32Step struct {
+	index uint32
+	xpub  string
+}
+
+const hardened = HardenedOffset
+
+var bip32Vectors = map[string][]bip32Step{
+	"1": {
+		{0, "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"},
+		{0 + hardened, "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"},
+		{1, "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"},
+		{2 + hardened, "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5"},
+		{2, "xpub6FHa3pjLCk84BayeJxFW2SP4XRrFd1JYnxeLeU8EqN3vDfZmbqBqaGJAyiLjTAwm6ZLRQUMv1ZACTj37sR62cfN7fe5JnJ7dh8zL4fiyLHV"},
+		{1000000000, "xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy"},
+	},
+	"2": {
+		{0, "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB"},
+		{0, "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH"},
+		{2147483647 + hardened, "xpub6ASAVgeehLbnwdqV6UKMHVzgqAG8Gr6riv3Fxxpj8ksbH9ebxaEyBLZ85ySDhKiLDBrQSARLq1uNRts8RuJiHjaDMBU4Zn9h8LZNnBC5y4a"},
+		{1, "xpub6DF8uhdarytz3FWdA8TvFSvvAh8dP3283MY7p2V4SeE2wyWmG5mg5EwVvmdMVCQcoNJxGoWaU9DCWh89LojfZ537wTfunKau47EL2dhHKon"},
+		{2147483646 + hardened, "xpub6ERApfZwUNrhLCkDtcHTcxd75RbzS1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grBGRjaDMzQLcgJvLJuZZvRcEL"},
+		{2, "xpub6FnCn6nSzZAw5Tw7cgR9bi15UV96gLZhjDstkXXxvCLsUXBGXPdSnLFbdpq8p9HmGsApME5hQTZ3emM2rnY5agb9rXpVGyy3bdW6EEgAtqt"},
+	},
+	"3": {
+		{0, "xpub661MyMwAqRbcEZVB4dScxMAdx6d4nFc9nvyvH3v4gJL378CSRZiYmhRoP7mBy6gSPSCYk6SzXPTf3ND1cZAceL7SfJ1Z3GC8vBgp2epUt13"},
+		{0 + hardened, "xpub68NZiKmJWnxxS6aaHmn81bvJeTESw724CRDs6HbuccFQN9Ku14VQrADWgqbhhTHBaohPX4CjNLf9fq9MYo6oDaPPLPxSb7gwQN3ih19Zm4Y"},
+	},
+}
+
+func TestBIP32Vectors(t *testing.T) {
+	for name, steps := range bip32Vectors {
+		t.Run(name, func(t *testing.T) {
+			var parent ExtendedKey
+			for i, s := range steps {
+				k, err := ParseExtendedKey(Bitcoin, s.xpub)
+				if err != nil {
+					t.Fatalf("step %d: ParseExtendedKey: %v", i, err)
+				}
+				if k.Depth != byte(i) || k.ChildNumber != s.index {
+					t.Errorf("step %d: depth %d child %d, want %d %d",
+						i, k.Depth, k.ChildNumber, i, s.index)
+				}
+				if i > 0 {
+					_, b, _ := base58CheckDecode(s.xpub)
+					if fp := hash160(parent.PubKey[:])[:4]; string(fp) !=
+						string(b[4:8]) {
+						t.Errorf("step %d: parent fingerprint %x, want %x",
+							i, fp, b[4:8])
+					}
+				}
+				if i > 0 && s.index < HardenedOffset {
+					c, err := parent.Child(s.index)
+					if err != nil {
+						t.Fatalf("step %d: Child: %v", i, err)
+					}
+					if c.PubKey != k.PubKey || c.ChainCode != k.ChainCode ||
+						c.Depth != k.Depth || c.ChildNumber != k.ChildNumber {
+						t.Errorf("step %d: derived %x, want %x",
+							i, c.PubKey, k.PubKey)
+					}
+				}
+				if i > 0 && s.index >= HardenedOffset {
+					if _, err := parent.Child(s.index); err == nil {
+						t.Errorf("step %d: derived a hardened child", i)
+					}
+				}
+				parent = k
+			}
+		})
+	}
+}
+
+func TestAccountAddressVectors(t *testing.T) {
+	tests := []struct {
+		name    string
+		network Network
+		purpose Purpose
+		xpub    string
+		path    [2]uint32
+		pub     string
+		address string
+	}{
+		// BIP49, with the account key given as tpub
+		{"BIP49 receive", Testnet, BIP49,
+			"tpubDD7tXK8KeQ3YY83yWq755fHY2JW8Ha8Q765tknUM5rSvjPcGWfUppDFMpQ1ScziKfW3ZNtZvAD7M3u7bSs7HofjTD3KP3YxPK7X6hwV8Rk2",
+			[2]uint32{0, 0},
+			"03a1af804ac108a8a51782198c2d034b28bf90c8803f5a53f76276fa69a4eae77f",
+			"2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2"},
+		// BIP84
+		{"BIP84 receive 0", Mainnet, BIP84,
+			"zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			[2]uint32{0, 0},
+			"0330d54fd0dd420a6e5f8d3624f5f3482cae350f79d5f0753bf5beef9c2d91af3c",
+			"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{"BIP84 receive 1", Mainnet, BIP84,
+			"zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			[2]uint32{0, 1},
+			"03e775fd51f0dfb8cd865d9ff1cca2a158cf651fe997fdc9fee9c1d3b5e995ea77",
+			"bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		{"BIP84 change 0", Mainnet, BIP84,
+			"zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			[2]uint32{1, 0},
+			"03025324888e429ab8e3dbaf1f7802648b9cd01e9b418485c5fa4c1b9b5700e1a6",
+			"bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseExtendedKey(Bitcoin, tt.xpub)
+			if err != nil {
+				t.Fatalf("ParseExtendedKey: %v", err)
+			}
+			for _, i := range tt.path {
+				if k, err = k.Child(i); err != nil {
+					t.Fatalf("Child(%d): %v", i, err)
+				}
+			}
+			if pub := hex.EncodeToString(k.PubKey[:]); pub != tt.pub {
+				t.Errorf("public key %s, want %s", pub, tt.pub)
+			}
+			p, _ := Params(Bitcoin, tt.network)
+			a, err := FromPubKey(p, tt.purpose, k.PubKey)
+			if err != nil {
+				t.Fatalf("FromPubKey: %v", err)
+			}
+			if a.Encoded != tt.address {
+				t.Errorf("address %s, want %s", a.Encoded, tt.address)
+			}
+		})
+	}
+}
+
+func TestParseExtendedKeyPrivate(t *testing.T) {
+	// The master key of BIP32 test vector 1
+	const xprv = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+	_, err := ParseExtendedKey(Bitcoin, xprv)
+	if !errors.Is(err, ErrPrivateKey) {
+		t.Errorf("ParseExtendedKey(xprv) = %v, want ErrPrivateKey", err)
+	}
+}
@@ -0,0 +1,29 @@
+package address
+
+// Network identifies a network of a chain, such as its main network or
+// one of its test networks.
+type Network string
+
+const (
+	Mainnet Network = "mainnet"
+	// Testnet is testnet3 on Bitcoin. It is kept for the accounts that
+	// were given it before networks could be chosen.
+	Testnet  Network = "testnet"
+	Testnet4 Network = "testnet4"
+	Signet   Network = "signet"
+	Regtest  Network = "regtest"
+)
+
+// Networks lists the networks known on any chain. The networks of a
+// chain are listed by ChainNetworks.
+var Networks = []Network{Mainnet, Testnet, Testnet4, Signet, Regtest}
+
+// ParseNetwork returns the network with the given name.
+func ParseNetwork(s string) (Network, bool) {
+	for _, n := range Networks {
+		if string(n) == s {
+			return n, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,345 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AuditAction is the kind of change an audit entry records.
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	// AuditShare records an invitation
+	AuditShare AuditAction = "share"
+	// AuditJoin records the acceptance of an invitation
+	AuditJoin AuditAction = "join"
+	// AuditUnshare records the removal of a member or invitation
+	AuditUnshare AuditAction = "unshare"
+	// AuditPurge records that a deleted account was removed for good
+	AuditPurge AuditAction = "purge"
+	// AuditRedact records that a user whose data was erased was removed
+	// from the entries before
+	AuditRedact AuditAction = "redact"
+)
+
+// SystemActor is the actor of the changes the service makes on its own,
+// such as deriving further addresses.
+const SystemActor = "system"
+
+// ErasedActor stands in for a user whose data was erased in the audit
+// chains of the accounts of other users.
+const ErasedActor = "erased"
+
+// AuditChange is the change of a single field. Before and After hold
+// JSON values and are nil where the field had no value.
+type AuditChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditEntry records who changed an account and how. The entries of an
+// account form a hash chain: each one covers the hash of the one before,
+// so changing or removing an entry breaks the links that follow. The
+// last entry is recorded in the AuditHead of the chain.
+type AuditEntry struct {
+	AccountID string
+	// Seq numbers the entries of the account from 1
+	Seq    int64
+	Action AuditAction
+	// Actor is the user who made the change
+	Actor string
+	// TraceID identifies the request that made the change. It is empty
+	// if the request was not traced.
+	TraceID  string
+	At       time.Time
+	Changes  []AuditChange
+	PrevHash string
+	Hash     string
+}
+
+// NewAuditEntry returns an unchained entry of a change to an account.
+func NewAuditEntry(accountID string, action AuditAction, actor,
+	traceID string, changes []AuditChange, now time.Time) AuditEntry {
+	return AuditEntry{
+		AccountID: accountID,
+		Action:    action,
+		Actor:     actor,
+		TraceID:   traceID,
+		At:        timestamp(now),
+		Changes:   changes,
+	}
+}
+
+// Chain returns a copy of the entry appended after prev, which is nil
+// for the first entry of an account.
+func (e AuditEntry) Chain(prev *AuditEntry) AuditEntry {
+	e.Seq, e.PrevHash = 1, ""
+	if prev != nil {
+		e.Seq, e.PrevHash = prev.Seq+1, prev.Hash
+	}
+	e.Hash = e.digest()
+	return e
+}
+
+// digest hashes everything in the entry but its own hash.
+func (e AuditEntry) digest() string {
+	b, _ := json.Marshal(struct {
+		AccountID string        `json:"accountId"`
+		Seq       int64         `json:"seq"`
+		Action    AuditAction   `json:"action"`
+		Actor     string        `json:"actor"`
+		TraceID   string        `json:"traceId"`
+		At        time.Time     `json:"at"`
+		Changes   []AuditChange `json:"changes"`
+		PrevHash  string        `json:"prevHash"`
+	}{e.AccountID, e.Seq, e.Action, e.Actor, e.TraceID, e.At.UTC(),
+		e.Changes, e.PrevHash})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Member returns the user whose membership the entry records a change
+// of, or "" if it records none.
+func (e AuditEntry) Member() string {
+	for _, c := range e.Changes {
+		if id, ok := strings.CutPrefix(c.Field, "members/"); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// RedactAudit returns the entries of a chain with the user replaced by
+// ErasedActor, both as actor and in the fields of member changes, along
+// with the sequence numbers of the entries that changed. The entries
+// that follow a changed one are linked to it again, so that the chain
+// stays intact, while links broken before stay broken.
+func RedactAudit(es []AuditEntry, userID string,
+) ([]AuditEntry, []int64) {
+	out := make([]AuditEntry, len(es))
+	var seqs []int64
+	for i, e := range es {
+		redacted := e.Actor == userID
+		if redacted {
+			e.Actor = ErasedActor
+		}
+		e.Changes = slices.Clone(e.Changes)
+		for j, c := range e.Changes {
+			if c.Field == "members/"+userID {
+				e.Changes[j].Field = "members/" + ErasedActor
+				redacted = true
+			}
+		}
+		if redacted {
+			seqs = append(seqs, e.Seq)
+		}
+		relinked := false
+		if i > 0 && out[i-1].Hash != es[i-1].Hash &&
+			e.PrevHash == es[i-1].Hash {
+			e.PrevHash, relinked = out[i-1].Hash, true
+		}
+		if redacted || relinked {
+			e.Hash = e.digest()
+		}
+		out[i] = e
+	}
+	return out, seqs
+}
+
+// NewRedactEntry returns the unchained entry recording that RedactAudit
+// changed the entries with the sequence numbers seqs.
+func NewRedactEntry(accountID string, seqs []int64, now time.Time,
+) AuditEntry {
+	return NewAuditEntry(accountID, AuditRedact, SystemActor, "",
+		[]AuditChange{{Field: "entries", After: auditValue(seqs)}}, now)
+}
+
+// AuditHead records the last entry of an audit chain, so that entries
+// removed from the end of the chain are noticed. It is signed with an
+// AuditKey kept outside the database, so that the chain cannot be
+// rewritten along with it.
+type AuditHead struct {
+	AccountID string
+	Seq       int64
+	Hash      string
+	// MAC signs the other fields. It is empty if the head is not signed.
+	MAC string
+}
+
+// Head returns the unsigned head of the chain ending with e.
+func (e AuditEntry) Head() AuditHead {
+	return AuditHead{AccountID: e.AccountID, Seq: e.Seq, Hash: e.Hash}
+}
+
+// AuditKey signs the heads of audit chains. With an empty key heads are
+// neither signed nor checked.
+type AuditKey []byte
+
+// Sign returns h signed with the key.
+func (k AuditKey) Sign(h AuditHead) AuditHead {
+	h.MAC = ""
+	if len(k) > 0 {
+		h.MAC = k.mac(h)
+	}
+	return h
+}
+
+// Signed reports whether h was signed with the key.
+func (k AuditKey) Signed(h AuditHead) bool {
+	return len(k) == 0 || hmac.Equal([]byte(h.MAC), []byte(k.mac(h)))
+}
+
+func (k AuditKey) mac(h AuditHead) string {
+	m := hmac.New(sha256.New, k)
+	_, _ = fmt.Fprintf(m, "%s/%d/%s", h.AccountID, h.Seq, h.Hash)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// AuditBreak is the first broken link found in an audit chain.
+type AuditBreak struct {
+	// Seq is the sequence number expected at the broken link
+	Seq    int64
+	Reason string
+}
+
+// VerifyAuditChain walks the entries of an account in order and returns
+// the first broken link, or nil if the chain is intact. The chain must
+// end with its head, which must be signed with key.
+func VerifyAuditChain(es []AuditEntry, head *AuditHead,
+	key AuditKey) *AuditBreak {
+	var prev *AuditEntry
+	for i, e := range es {
+		want := int64(i + 1)
+		switch {
+		case e.Seq != want:
+			return &AuditBreak{want,
+				fmt.Sprintf("entry %d is missing", want)}
+		case prev != nil && e.PrevHash != prev.Hash,
+			prev == nil && e.PrevHash != "":
+			return &AuditBreak{want,
+				"does not link to the entry before"}
+		case e.Hash != e.digest():
+			return &AuditBreak{want,
+				"does not match its hash"}
+		}
+		prev = &es[i]
+	}
+	n := int64(len(es))
+	switch {
+	case head == nil && n == 0:
+		return nil
+	case head == nil:
+		return &AuditBreak{n, "the chain has no head"}
+	case !key.Signed(*head):
+		return &AuditBreak{head.Seq,
+			"the head of the chain is not signed by the service"}
+	case head.Seq > n:
+		return &AuditBreak{n + 1, fmt.Sprintf("entry %d is missing", n+1)}
+	case head.Seq < n:
+		return &AuditBreak{head.Seq + 1, "follows the head of the chain"}
+	case head.Hash != es[n-1].Hash:
+		return &AuditBreak{n, "does not match the head of the chain"}
+	}
+	return nil
+}
+
+// AccountChanges lists the fields that differ between two versions of an
+// account. Before is nil for created accounts.
+func AccountChanges(before *Account, after Account) []AuditChange {
+	var b Account
+	if before != nil {
+		b = *before
+	}
+	out := []AuditChange{}
+	add := func(field string, x, y any) {
+		bx, by := auditValue(x), auditValue(y)
+		if !bytes.Equal(bx, by) {
+			out = append(out, AuditChange{field, bx, by})
+		}
+	}
+	add("name", b.Name, after.Name)
+	add("chain", string(b.Chain), string(after.Chain))
+	add("network", string(b.Network), string(after.Network))
+	add("addresses", b.Addresses, after.Addresses)
+	add("tags", b.Tags, after.Tags)
+	add("labels", b.Labels, after.Labels)
+	add("derivation", derivationKey(b.Derivation),
+		derivationKey(after.Derivation))
+	add("descriptors", descriptorKeys(b.Descriptors),
+		descriptorKeys(after.Descriptors))
+	add("deletedAt", b.DeletedAt, after.DeletedAt)
+	return out
+}
+
+func derivationKey(d *Derivation) string {
+	if d == nil {
+		return ""
+	}
+	return d.ExtendedKey
+}
+
+func descriptorKeys(ds []AccountDescriptor) []string {
+	out := make([]string, 0, len(ds))
+	for _, d := range ds {
+		out = append(out, d.Descriptor)
+	}
+	return out
+}
+
+// MemberChanges describes a change to the membership of a user. Either
+// version is nil where there is none.
+func MemberChanges(before, after *Member) []AuditChange {
+	value := func(m *Member) json.RawMessage {
+		if m == nil {
+			return nil
+		}
+		status := "active"
+		if m.Pending() {
+			status = "invited"
+		}
+		return auditValue(map[string]string{
+			"role": string(m.Role), "status": status})
+	}
+	userID := ""
+	for _, m := range []*Member{before, after} {
+		if m != nil {
+			userID = m.UserID
+		}
+	}
+	return []AuditChange{{"members/" + userID, value(before), value(after)}}
+}
+
+// auditValue encodes v, leaving out zero values.
+func auditValue(v any) json.RawMessage {
+	b, _ := json.Marshal(v)
+	switch string(b) {
+	case "null", `""`, "[]":
+		return nil
+	}
+	return b
+}
+
+// AuditRepository reads the audit chains of accounts. Entries are
+// appended by the AccountRepository and MemberRepository along with the
+// changes they record, and the head of the chain is moved along. Purging
+// an account keeps its chain, only erasing the data of its owner removes
+// it. Implementations must be safe for concurrent use.
+type AuditRepository interface {
+	// ListAudit returns the entries of an account in order along with
+	// the head of its chain, which is nil if there is none.
+	ListAudit(ctx context.Context, accountID string,
+	) ([]AuditEntry, *AuditHead, error)
+}
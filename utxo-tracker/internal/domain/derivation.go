@@ -0,0 +1,304 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// Limits applied to extended key derivation.
+const (
+	DefaultGapLimit = 20
+	MaxGapLimit     = 100
+)
+
+// Branches of the accounts of BIP44 and the purposes modelled on it.
+const (
+	ReceiveBranch uint32 = 0
+	ChangeBranch  uint32 = 1
+)
+
+// Derivation describes how addresses of an account are derived from an
+// extended public key.
+type Derivation struct {
+	// ExtendedKey is the extended public key as given
+	ExtendedKey string
+	Purpose     address.Purpose
+	// GapLimit is the number of unused addresses kept derived past the
+	// last used one on each branch.
+	GapLimit int
+	// Addresses lists the derived addresses in the order they were
+	// derived.
+	Addresses []DerivedAddress
+}
+
+// DerivedAddress is an address derived from an extended public key.
+type DerivedAddress struct {
+	Address string
+	Branch  uint32
+	Index   uint32
+	// Path is the BIP32 path of the address. It is absolute when the key
+	// is a BIP44 style account key and relative to the key otherwise.
+	Path string
+}
+
+// DerivationSpec holds the user editable fields of a derivation.
+type DerivationSpec struct {
+	ExtendedKey string
+	// Purpose defaults to the one the key's version stands for
+	Purpose address.Purpose
+	// GapLimit defaults to DefaultGapLimit
+	GapLimit int
+}
+
+// Path returns the derivation path of addr, or an empty string if the
+// account did not derive addr or it has no path.
+func (a Account) Path(addr string) string {
+	for _, d := range a.derived() {
+		if d.Address == addr {
+			return d.Path
+		}
+	}
+	return ""
+}
+
+// derived returns the addresses derived from the account's derivation
+// and expanded from its descriptors.
+func (a Account) derived() []DerivedAddress {
+	var out []DerivedAddress
+	if a.Derivation != nil {
+		out = append(out, a.Derivation.Addresses...)
+	}
+	for _, d := range a.Descriptors {
+		out = append(out, d.Addresses...)
+	}
+	return out
+}
+
+// keyNetwork returns the first network of chain c whose keys are test
+// keys if test is set, and main keys otherwise.
+func keyNetwork(c address.Chain, test bool) address.Network {
+	for _, n := range address.ChainNetworks(c) {
+		if test == (n != address.Mainnet) {
+			return n
+		}
+	}
+	return ""
+}
+
+// newDerivation validates spec and returns a derivation without
+// addresses for network n of chain c, along with the network. An empty
+// network is taken from the key.
+func newDerivation(v *ValidationError, c address.Chain, n address.Network,
+	spec DerivationSpec) (*Derivation, address.Network) {
+	s := strings.TrimSpace(spec.ExtendedKey)
+	key, err := address.ParseExtendedKey(c, s)
+	if errors.Is(err, address.ErrPrivateKey) {
+		v.Add("derivation.extendedKey", "", err.Error())
+		return &Derivation{}, n
+	}
+	if err != nil {
+		v.Add("derivation.extendedKey", s, err.Error())
+		return &Derivation{ExtendedKey: s}, n
+	}
+	if key.Multisig {
+		v.Add("derivation.extendedKey", s,
+			"is a multisig key, which needs a multisig account")
+	}
+	if n == "" {
+		n = keyNetwork(c, key.Test)
+	}
+	if key.Test == (n == address.Mainnet) {
+		v.Add("derivation.extendedKey", s, fmt.Sprintf(
+			"is not a key of the %s network", n))
+	}
+	d := &Derivation{
+		ExtendedKey: s,
+		Purpose:     spec.Purpose,
+		GapLimit:    spec.GapLimit,
+	}
+	if d.Purpose == 0 {
+		d.Purpose = key.Purpose
+	}
+	switch {
+	case !slices.Contains(address.Purposes, d.Purpose):
+		v.Add("derivation.purpose", fmt.Sprint(d.Purpose), "is not a known purpose")
+	case key.Purpose != address.BIP44 && d.Purpose != key.Purpose:
+		v.Add("derivation.purpose", fmt.Sprint(d.Purpose), fmt.Sprintf(
+			"does not match the BIP%d version of the key", key.Purpose))
+	}
+	if d.GapLimit == 0 {
+		d.GapLimit = DefaultGapLimit
+	}
+	if d.GapLimit < 1 || d.GapLimit > MaxGapLimit {
+		v.Add("derivation.gapLimit", fmt.Sprint(d.GapLimit), fmt.Sprintf(
+			"must be between 1 and %d", MaxGapLimit))
+	}
+	return d, n
+}
+
+// derive extends branch to count addresses on network n of chain c.
+func (d *Derivation) derive(c address.Chain, n address.Network,
+	branch uint32, count int) error {
+	p, ok := address.Params(c, n)
+	if !ok {
+		return fmt.Errorf("%s has no network %s", c, n)
+	}
+	key, err := address.ParseExtendedKey(c, d.ExtendedKey)
+	if err != nil {
+		return err
+	}
+	bk, err := key.Child(branch)
+	if err != nil {
+		return err
+	}
+	have, next := 0, uint32(0)
+	for _, a := range d.Addresses {
+		if a.Branch == branch {
+			have++
+			next = a.Index + 1
+		}
+	}
+	for ; have < count; next++ {
+		ck, err := bk.Child(next)
+		if address.IsInvalidChild(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		addr, err := address.FromPubKey(p, d.Purpose, ck.PubKey)
+		if err != nil {
+			return err
+		}
+		d.Addresses = append(d.Addresses, DerivedAddress{
+			Address: addr.Encoded,
+			Branch:  branch,
+			Index:   next,
+			Path:    derivationPath(key, p, d.Purpose, branch, next),
+		})
+		have++
+	}
+	return nil
+}
+
+// derivationPath returns the path of an address derived from key. Keys
+// at the account level of BIP44 get absolute paths, which assume the
+// chain's coin type.
+func derivationPath(key address.ExtendedKey, p address.ChainParams,
+	purpose address.Purpose, branch, index uint32) string {
+	if key.Depth != 3 || key.ChildNumber < address.HardenedOffset {
+		return fmt.Sprintf("%d/%d", branch, index)
+	}
+	return fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", purpose, p.CoinType,
+		key.ChildNumber-address.HardenedOffset, branch, index)
+}
+
+// clone returns a deep copy of d.
+func (d *Derivation) clone() *Derivation {
+	if d == nil {
+		return nil
+	}
+	c := *d
+	c.Addresses = slices.Clone(d.Addresses)
+	return &c
+}
+
+// withDerived returns addrs followed by the derived addresses of the
+// account it does not hold yet.
+func (a Account) withDerived(addrs []string) []string {
+	for _, da := range a.derived() {
+		if !slices.Contains(addrs, da.Address) {
+			addrs = append(addrs, da.Address)
+		}
+	}
+	return addrs
+}
+
+// DiscoverAddresses derives addresses of the account until GapLimit
+// unused ones follow the last used one on each branch, asking src which
+// were used. Without a chain source for the account's network only the
+// first GapLimit addresses are derived. It reports whether addresses
+// were added and leaves the version alone, see Rescan.
+func DiscoverAddresses(ctx context.Context, src ChainSource, a Account,
+) (Account, bool, error) {
+	if a.Derivation == nil {
+		return a, false, nil
+	}
+	d := a.Derivation.clone()
+	used := make(map[string]bool)
+	checked := 0
+	grown := false
+	for {
+		err := checkUsed(ctx, src, a, d.Addresses[checked:], used)
+		if err != nil {
+			return Account{}, false, err
+		}
+		checked = len(d.Addresses)
+		before := len(d.Addresses)
+		for _, branch := range []uint32{ReceiveBranch, ChangeBranch} {
+			want := d.GapLimit
+			for _, da := range d.Addresses {
+				if da.Branch == branch && used[da.Address] {
+					want = int(da.Index) + 1 + d.GapLimit
+				}
+			}
+			err := d.derive(a.Chain, a.Network, branch, want)
+			if err != nil {
+				return Account{}, false, err
+			}
+		}
+		if len(d.Addresses) == before {
+			break
+		}
+		grown = true
+	}
+	if !grown {
+		return a, false, nil
+	}
+	a.Derivation = d
+	a.Addresses = a.withDerived(slices.Clone(a.Addresses))
+	return a, true, nil
+}
+
+// checkUsed marks the addresses of ds that have been used in used.
+func checkUsed(ctx context.Context, src ChainSource, a Account,
+	ds []DerivedAddress, used map[string]bool) error {
+	if src == nil || len(ds) == 0 {
+		return nil
+	}
+	addrs := make([]string, 0, len(ds))
+	for _, da := range ds {
+		addrs = append(addrs, da.Address)
+	}
+	bs, err := src.AddressBalances(ctx, a.Chain, a.Network, addrs)
+	if errors.Is(err, ErrNoChainSource) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for addr, b := range bs {
+		used[addr] = b.Used
+	}
+	return nil
+}
+
+// Rescan returns a copy of the account with the addresses found by
+// DiscoverAddresses and the next version, and reports whether any were
+// found. Accounts without new addresses are returned unchanged.
+func (a Account) Rescan(ctx context.Context, src ChainSource,
+	now time.Time) (Account, bool, error) {
+	b, grown, err := DiscoverAddresses(ctx, src, a)
+	if err != nil || !grown {
+		return a, false, err
+	}
+	b.Version++
+	b.UpdatedAt = timestamp(now)
+	return b, true, nil
+}
@@ -0,0 +1,65 @@
+package descriptor
+
+import "strings"
+
+// The descriptor checksum of BIP380. It is a BCH code over the
+// descriptor's characters, grouped so that the characters most likely
+// to be mistyped for one another differ in a single symbol.
+
+const (
+	checksumInput = "0123456789()[],'/*abcdefgh@:$%{}" +
+		"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+		"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	checksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	checksumLength  = 8
+)
+
+func checksumPolymod(c uint64, v int) uint64 {
+	gen := [5]uint64{
+		0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+	top := c >> 35
+	c = (c&0x7ffffffff)<<5 ^ uint64(v)
+	for i := 0; i < 5; i++ {
+		if (top>>uint(i))&1 == 1 {
+			c ^= gen[i]
+		}
+	}
+	return c
+}
+
+// Checksum returns the checksum of a descriptor without one. It returns
+// the position of the first character outside the descriptor character
+// set, or -1 if there is none.
+func Checksum(s string) (string, int) {
+	c := uint64(1)
+	var group [3]int
+	n := 0
+	for i := 0; i < len(s); i++ {
+		v := strings.IndexByte(checksumInput, s[i])
+		if v < 0 {
+			return "", i
+		}
+		c = checksumPolymod(c, v&31)
+		group[n] = v >> 5
+		n++
+		if n == 3 {
+			c = checksumPolymod(c, group[0]*9+group[1]*3+group[2])
+			n = 0
+		}
+	}
+	switch n {
+	case 1:
+		c = checksumPolymod(c, group[0])
+	case 2:
+		c = checksumPolymod(c, group[0]*3+group[1])
+	}
+	for i := 0; i < checksumLength; i++ {
+		c = checksumPolymod(c, 0)
+	}
+	c ^= 1
+	out := make([]byte, checksumLength)
+	for i := range out {
+		out[i] = checksumCharset[c>>uint(5*(checksumLength-1-i))&31]
+	}
+	return string(out), -1
+}
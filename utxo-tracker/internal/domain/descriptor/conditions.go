@@ -0,0 +1,198 @@
+package descriptor
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// numsKey is the x coordinate of the BIP341 point with no known private
+// key, used as internal key of outputs that can only be spent by script.
+const numsKey = "50929b74c1a04954b78b4b6035e97a5e" +
+	"078a5a0f28ec96d547bfee9ace803ac0"
+
+// Conditions describes the ways to spend the outputs of d, one sentence
+// for each. Keys are named by their fingerprint. It returns nil for
+// addr() descriptors, whose script is not known.
+func (d Descriptor) Conditions() []string {
+	return conditions(d.Script)
+}
+
+// conditions describes the ways to spend script s.
+func conditions(s Script) []string {
+	switch s := s.(type) {
+	case SH:
+		return conditions(s.Script)
+	case WSH:
+		return conditions(s.Script)
+	case Miniscript:
+		return alternatives(s.Node)
+	case Multi:
+		return []string{signatures(s.Threshold, s.Keys)}
+	case PKH:
+		return []string{signature(s.Key)}
+	case WPKH:
+		return []string{signature(s.Key)}
+	case TR:
+		var out []string
+		if s.Key.Extended != nil ||
+			hex.EncodeToString(s.Key.PubKey[1:]) != numsKey {
+			out = append(out, "key path: "+signature(s.Key))
+		}
+		if s.Tree == nil {
+			return out
+		}
+		for _, leaf := range s.Tree.leaves() {
+			for _, c := range alternatives(leaf) {
+				out = append(out, "script path: "+c)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// alternatives splits the expression n at its top level disjunctions
+// and describes each of them.
+func alternatives(n *Node) []string {
+	switch n.Fragment {
+	case "a", "s", "c", "d", "v", "j", "n", "l", "u":
+		return alternatives(n.Args[0])
+	case "or_b", "or_c", "or_d", "or_i":
+		return append(alternatives(n.Args[0]), alternatives(n.Args[1])...)
+	case "andor":
+		and := conjunction(n.Args[0], n.Args[1])
+		return append([]string{and}, alternatives(n.Args[2])...)
+	}
+	text, _ := phrase(n)
+	return []string{text}
+}
+
+// conjunction describes x and y both holding.
+func conjunction(x, y *Node) string {
+	return join([]*Node{x, y}, "and")
+}
+
+// phrase describes n. It also returns "and" or "or" if the description
+// is a list joined by that word, which needs parentheses inside a list
+// joined by the other.
+func phrase(n *Node) (string, string) {
+	switch n.Fragment {
+	case "a", "s", "c", "d", "v", "j", "n", "l", "u":
+		return phrase(n.Args[0])
+	case "0":
+		return "never", ""
+	case "1":
+		return "always", ""
+	case "pk_k", "pk_h", "pk", "pkh":
+		return signature(n.Keys[0]), ""
+	case "multi", "multi_a", "sortedmulti_a":
+		return signatures(int(n.K), n.Keys), ""
+	case "older":
+		return relative(n.K), ""
+	case "after":
+		return absolute(n.K), ""
+	case "sha256", "hash256", "ripemd160", "hash160":
+		digest := hex.EncodeToString(n.Hash[:4])
+		return fmt.Sprintf("preimage of %s %s…",
+			strings.ToUpper(n.Fragment), digest), ""
+	case "and_v", "and_b", "and_n":
+		return join(n.Args, "and"), "and"
+	case "or_b", "or_c", "or_d", "or_i":
+		return join(n.Args, "or"), "or"
+	case "andor":
+		and := "(" + conjunction(n.Args[0], n.Args[1]) + ")"
+		z, kind := phrase(n.Args[2])
+		if kind == "and" {
+			z = "(" + z + ")"
+		}
+		return and + " or " + z, "or"
+	case "thresh":
+		parts := make([]string, len(n.Args))
+		for i, a := range n.Args {
+			parts[i], _ = phrase(a)
+		}
+		return fmt.Sprintf("%d of (%s)", n.K,
+			strings.Join(parts, "; ")), ""
+	}
+	return n.String(), ""
+}
+
+// join describes the expressions ns joined by word, leaving out the
+// trivial "always" of and_v(X,1) and t:X.
+func join(ns []*Node, word string) string {
+	var parts []string
+	for _, a := range ns {
+		text, kind := phrase(a)
+		switch {
+		case word == "and" && text == "always":
+			continue
+		case kind != "" && kind != word:
+			text = "(" + text + ")"
+		}
+		parts = append(parts, text)
+	}
+	if len(parts) == 0 {
+		return "always"
+	}
+	return strings.Join(parts, " "+word+" ")
+}
+
+// signature describes a signature of k.
+func signature(k Key) string {
+	return "signature of key " + keyName(k)
+}
+
+// signatures describes threshold signatures of keys.
+func signatures(threshold int, keys []Key) string {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = keyName(k)
+	}
+	return fmt.Sprintf("%d of %d signatures of keys %s", threshold,
+		len(keys), strings.Join(names, ", "))
+}
+
+func keyName(k Key) string {
+	fp := k.Fingerprint()
+	return hex.EncodeToString(fp[:])
+}
+
+// relative describes the BIP68 relative lock time v of older().
+func relative(v uint32) string {
+	const timeFlag = 1 << 22
+	n := v & 0xffff
+	if v&timeFlag == 0 {
+		return count(int(n), "block") + " after confirmation"
+	}
+	d := time.Duration(n) * 512 * time.Second
+	switch {
+	case d >= 24*time.Hour:
+		return "about " + count(int(d.Hours()/24+0.5), "day") +
+			" after confirmation"
+	case d >= time.Hour:
+		return "about " + count(int(d.Hours()+0.5), "hour") +
+			" after confirmation"
+	}
+	return "about " + count(int(d.Minutes()+0.5), "minute") +
+		" after confirmation"
+}
+
+// count formats n of unit, which is made plural unless n is 1.
+func count(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// absolute describes the lock time v of after(), a block height below
+// 500000000 and a Unix time from there.
+func absolute(v uint32) string {
+	if v < 500000000 {
+		return fmt.Sprintf("from block %d", v)
+	}
+	t := time.Unix(int64(v), 0).UTC()
+	return "from " + t.Format("2006-01-02 15:04 UTC")
+}
@@ -0,0 +1,554 @@
+// Package descriptor parses the output descriptors of BIP380 and its
+// companions into a syntax tree and expands them into addresses.
+package descriptor
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// Descriptor is a parsed output descriptor.
+type Descriptor struct {
+	Script Script
+}
+
+// Script is a script expression.
+type Script interface {
+	// String returns the canonical form of the expression
+	String() string
+	script()
+}
+
+// PKH is pkh(KEY), paying to a public key hash.
+type PKH struct{ Key Key }
+
+// WPKH is wpkh(KEY), paying to a witness public key hash.
+type WPKH struct{ Key Key }
+
+// SH is sh(SCRIPT), paying to the hash of the inner script.
+type SH struct{ Script Script }
+
+// WSH is wsh(SCRIPT), paying to the witness hash of the inner script.
+type WSH struct{ Script Script }
+
+// Multi is multi(K,KEY,...) or sortedmulti(K,KEY,...), a K of N
+// multisig script. It is only supported inside sh() and wsh().
+type Multi struct {
+	Threshold int
+	Keys      []Key
+	// Sorted is set for sortedmulti, which orders the public keys in the
+	// script at every index.
+	Sorted bool
+}
+
+// Miniscript is a miniscript expression inside wsh().
+type Miniscript struct{ Node *Node }
+
+// TR is tr(KEY) or tr(KEY,TREE), paying to a taproot output with KEY as
+// internal key and, if given, a script tree.
+type TR struct {
+	Key  Key
+	Tree *Tree
+}
+
+// Addr is addr(ADDR), paying to the given address.
+type Addr struct{ Address address.Address }
+
+func (PKH) script()        {}
+func (WPKH) script()       {}
+func (SH) script()         {}
+func (WSH) script()        {}
+func (Multi) script()      {}
+func (Miniscript) script() {}
+func (TR) script()         {}
+func (Addr) script()       {}
+
+func (s PKH) String() string  { return "pkh(" + s.Key.String() + ")" }
+func (s WPKH) String() string { return "wpkh(" + s.Key.String() + ")" }
+func (s SH) String() string   { return "sh(" + s.Script.String() + ")" }
+func (s WSH) String() string  { return "wsh(" + s.Script.String() + ")" }
+func (s Addr) String() string { return "addr(" + s.Address.Encoded + ")" }
+
+func (s Miniscript) String() string { return s.Node.String() }
+
+func (s TR) String() string {
+	if s.Tree == nil {
+		return "tr(" + s.Key.String() + ")"
+	}
+	return "tr(" + s.Key.String() + "," + s.Tree.String() + ")"
+}
+
+func (s Multi) String() string {
+	parts := []string{strconv.Itoa(s.Threshold)}
+	for _, k := range s.Keys {
+		parts = append(parts, k.String())
+	}
+	name := "multi"
+	if s.Sorted {
+		name = "sortedmulti"
+	}
+	return name + "(" + strings.Join(parts, ",") + ")"
+}
+
+// Limits on the keys of multisig scripts. P2SH redeem scripts must fit
+// in 520 bytes.
+const (
+	MaxMultiKeys   = 20
+	MaxSHMultiKeys = 15
+)
+
+// encode returns the multisig script of pubs, one for each key.
+func (s Multi) encode(pubs [][33]byte) []byte {
+	e := encoder{pubs: pubs}
+	e.num(int64(s.Threshold))
+	for _, k := range e.keys(len(pubs), s.Sorted) {
+		e.push(k)
+	}
+	e.num(int64(len(pubs)))
+	e.op(opCheckMultiSig)
+	return e.b
+}
+
+// Error is a descriptor that could not be parsed.
+type Error struct {
+	// Pos is the byte offset of what is wrong
+	Pos int
+	Msg string
+	// err is address.ErrPrivateKey for private keys
+	err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// unsupported lists the fragments of the descriptor BIPs that are
+// recognised but cannot be expanded yet.
+var unsupported = map[string]string{
+	"pk":    "has pk(), which has no address",
+	"combo": "has combo(), which is not supported",
+	"raw":   "has raw(), which has no address",
+	"rawtr": "has rawtr(), which is not supported",
+}
+
+// inside lists the fragments each wrapping fragment supports inside it.
+// The empty parent is the top level.
+var inside = map[string][]string{
+	"":    {"pkh", "wpkh", "sh", "wsh", "tr", "addr"},
+	"sh":  {"wpkh", "wsh", "multi", "sortedmulti"},
+	"wsh": {"multi", "sortedmulti"},
+}
+
+// Parse parses a descriptor of chain c. A checksum is not required but
+// verified if present.
+func Parse(c address.Chain, s string) (Descriptor, error) {
+	body, sum, hasSum := strings.Cut(s, "#")
+	want, bad := Checksum(body)
+	if bad >= 0 {
+		return Descriptor{}, &Error{Pos: bad,
+			Msg: fmt.Sprintf("has invalid character %q", body[bad])}
+	}
+	if hasSum && sum != want {
+		return Descriptor{}, &Error{Pos: len(body) + 1,
+			Msg: fmt.Sprintf("has checksum %q, expected %q", sum, want)}
+	}
+	p := parser{s: body, chain: c}
+	sc, err := p.parseScript("")
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if p.pos < len(body) {
+		return Descriptor{}, p.errorf(p.pos,
+			"has unexpected %q after the descriptor", body[p.pos:])
+	}
+	d := Descriptor{Script: sc}
+	paths := 1
+	for _, k := range d.Keys() {
+		n := k.paths()
+		if n > 1 && paths > 1 && n != paths {
+			return Descriptor{}, &Error{Pos: 0, Msg: "has multipath " +
+				"steps with different numbers of paths"}
+		}
+		paths = max(paths, n)
+	}
+	return d, nil
+}
+
+// String returns the canonical form of the descriptor with checksum.
+func (d Descriptor) String() string {
+	s := d.Script.String()
+	sum, _ := Checksum(s)
+	return s + "#" + sum
+}
+
+// Keys returns the key expressions of the descriptor in order.
+func (d Descriptor) Keys() []Key {
+	switch s := d.Script.(type) {
+	case PKH:
+		return []Key{s.Key}
+	case WPKH:
+		return []Key{s.Key}
+	case SH:
+		return Descriptor{Script: s.Script}.Keys()
+	case WSH:
+		return Descriptor{Script: s.Script}.Keys()
+	case Multi:
+		return s.Keys
+	case Miniscript:
+		return s.Node.keys()
+	case TR:
+		if s.Tree == nil {
+			return []Key{s.Key}
+		}
+		return append([]Key{s.Key}, s.Tree.keys()...)
+	}
+	return nil
+}
+
+// Multi returns the multisig script of the descriptor, if it has one.
+func (d Descriptor) Multi() (Multi, bool) {
+	switch s := d.Script.(type) {
+	case SH:
+		return Descriptor{Script: s.Script}.Multi()
+	case WSH:
+		return Descriptor{Script: s.Script}.Multi()
+	case Multi:
+		return s, true
+	}
+	return Multi{}, false
+}
+
+// Ranged reports whether the descriptor has a wildcard.
+func (d Descriptor) Ranged() bool {
+	for _, k := range d.Keys() {
+		if k.Wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// Paths returns the number of paths of the descriptor's multipath
+// steps, or 1 if it has none.
+func (d Descriptor) Paths() int {
+	n := 1
+	for _, k := range d.Keys() {
+		n = max(n, k.paths())
+	}
+	return n
+}
+
+// Output is an address a descriptor expands to.
+type Output struct {
+	Address address.Address
+	// Path is the derivation path of the first key, see
+	// Key.derivationPath.
+	Path string
+	// Index is the index the wildcard was replaced by
+	Index uint32
+}
+
+// Expand returns the addresses at indexes start to end, both included,
+// of one of the descriptor's paths on network p. Descriptors that are
+// not ranged expand to a single address. Indexes at which a key has no
+// child are skipped.
+func (d Descriptor) Expand(p address.ChainParams, path int,
+	start, end uint32) ([]Output, error) {
+	if s, ok := d.Script.(Addr); ok {
+		if !s.Address.ValidOn(p.Network) {
+			return nil, fmt.Errorf("is not a %s address", p.Network)
+		}
+		return []Output{{Address: s.Address}}, nil
+	}
+	keys := d.Keys()
+	bases := make([]address.ExtendedKey, len(keys))
+	for i, k := range keys {
+		if k.Extended == nil {
+			continue
+		}
+		if k.Extended.Test != (p.Network != address.Mainnet) {
+			return nil, fmt.Errorf(
+				"has a key that is not of the %s network", p.Network)
+		}
+		var err error
+		if bases[i], err = k.base(path); err != nil {
+			return nil, err
+		}
+	}
+	if !d.Ranged() {
+		start, end = 0, 0
+	}
+	var out []Output
+	pubs := make([][33]byte, len(keys))
+next:
+	for i := uint64(start); i <= uint64(end); i++ {
+		for j, k := range keys {
+			switch {
+			case k.Extended == nil:
+				pubs[j] = k.PubKey
+			case !k.Wildcard:
+				pubs[j] = bases[j].PubKey
+			default:
+				ck, err := bases[j].Child(uint32(i))
+				if address.IsInvalidChild(err) {
+					continue next
+				}
+				if err != nil {
+					return nil, err
+				}
+				pubs[j] = ck.PubKey
+			}
+		}
+		a, err := scriptAddress(p, d.Script, pubs)
+		if err != nil {
+			return nil, err
+		}
+		o := Output{Address: a, Path: keys[0].derivationPath(path,
+			uint32(i))}
+		if d.Ranged() {
+			o.Index = uint32(i)
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// scriptAddress returns the address of s on network p with pubs as the
+// public keys of its keys.
+func scriptAddress(p address.ChainParams, s Script, pubs [][33]byte,
+) (address.Address, error) {
+	switch s := s.(type) {
+	case PKH:
+		return address.FromPubKey(p, address.BIP44, pubs[0])
+	case WPKH:
+		return address.FromPubKey(p, address.BIP84, pubs[0])
+	case TR:
+		if s.Tree == nil {
+			return address.FromPubKey(p, address.BIP86, pubs[0])
+		}
+		root := s.Tree.root(&encoder{pubs: pubs[1:], tap: true})
+		return address.FromTaproot(p, pubs[0], root)
+	case WSH:
+		return address.FromScript(p, address.P2WSH,
+			witnessScript(s.Script, pubs))
+	case SH:
+		switch in := s.Script.(type) {
+		case WPKH:
+			return address.FromPubKey(p, address.BIP49, pubs[0])
+		case WSH:
+			ws := witnessScript(in.Script, pubs)
+			return address.FromScript(p, address.P2SH,
+				address.WitnessScriptHash(ws))
+		case Multi:
+			return address.FromScript(p, address.P2SH, in.encode(pubs))
+		}
+	}
+	return address.Address{}, fmt.Errorf("cannot expand %s", s)
+}
+
+// witnessScript returns the script inside wsh() with pubs as the public
+// keys of its keys.
+func witnessScript(s Script, pubs [][33]byte) []byte {
+	if m, ok := s.(Multi); ok {
+		return m.encode(pubs)
+	}
+	e := encoder{pubs: pubs}
+	e.encode(s.(Miniscript).Node)
+	return e.b
+}
+
+// supported reports whether the fragment can appear somewhere.
+func supported(name string) bool {
+	for _, names := range inside {
+		if slices.Contains(names, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parser reads a descriptor without checksum.
+type parser struct {
+	s     string
+	pos   int
+	chain address.Chain
+}
+
+// parseScript reads a script expression inside the given parent
+// fragment, which is empty at the top level.
+func (p *parser) parseScript(parent string) (Script, error) {
+	start := p.pos
+	name := p.token()
+	if name == "" {
+		return nil, p.errorf(start, "expected a script expression")
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	if msg, ok := unsupported[name]; ok {
+		return nil, p.errorf(start, "%s", msg)
+	}
+	if supported(name) && !slices.Contains(inside[parent], name) {
+		if parent == "" {
+			return nil, p.errorf(start, "has %s() at the top level, "+
+				"which is not supported", name)
+		}
+		return nil, p.errorf(start, "has %s() inside %s(), which is "+
+			"not supported", name, parent)
+	}
+	var (
+		s   Script
+		err error
+	)
+	switch name {
+	case "pkh":
+		var k Key
+		k, err = p.parseKey(false)
+		s = PKH{k}
+	case "wpkh":
+		var k Key
+		k, err = p.parseKey(false)
+		s = WPKH{k}
+	case "sh":
+		var sc Script
+		sc, err = p.parseScript(name)
+		s = SH{sc}
+	case "wsh":
+		var sc Script
+		sc, err = p.parseWitnessScript()
+		s = WSH{sc}
+	case "multi", "sortedmulti":
+		s, err = p.parseMulti(name == "sortedmulti", parent)
+	case "tr":
+		tr := TR{}
+		tr.Key, err = p.parseKey(true)
+		if err == nil && p.peek() == ',' {
+			p.pos++
+			tr.Tree, err = p.parseTree(0)
+		}
+		s = tr
+	case "addr":
+		at := p.pos
+		end := strings.IndexByte(p.s[at:], ')')
+		if end < 0 {
+			end = len(p.s) - at
+		}
+		p.pos = at + end
+		a, perr := address.ParseOn(p.chain, p.s[at:p.pos])
+		if perr != nil {
+			return nil, p.errorf(at, "has an address that %s", perr)
+		}
+		s = Addr{a}
+	default:
+		if isMiniscript(name) {
+			return nil, p.errorf(start, "has %s() outside wsh() and "+
+				"script trees, which is not supported", name)
+		}
+		return nil, p.errorf(start, "has unknown fragment %s()", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, p.expect(')')
+}
+
+// parseWitnessScript reads the script inside wsh(), a multisig script or
+// a miniscript expression.
+func (p *parser) parseWitnessScript() (Script, error) {
+	start := p.pos
+	name := p.token()
+	p.pos = start
+	if name == "multi" || name == "sortedmulti" {
+		return p.parseScript("wsh")
+	}
+	n, err := p.parseNode(false, false)
+	if err != nil {
+		return nil, err
+	}
+	return Miniscript{n}, p.checkTop(n, false)
+}
+
+// parseMulti reads the arguments of multi() or sortedmulti() inside
+// the given parent.
+func (p *parser) parseMulti(sorted bool, parent string) (Multi, error) {
+	m := Multi{Sorted: sorted}
+	start := p.pos
+	k, err := strconv.Atoi(p.token())
+	if err != nil {
+		return Multi{}, p.errorf(start, "expected a threshold")
+	}
+	m.Threshold = k
+	for p.peek() == ',' {
+		p.pos++
+		key, err := p.parseKey(false)
+		if err != nil {
+			return Multi{}, err
+		}
+		m.Keys = append(m.Keys, key)
+	}
+	limit := MaxMultiKeys
+	if parent == "sh" {
+		limit = MaxSHMultiKeys
+	}
+	switch n := len(m.Keys); {
+	case n == 0 || n > limit:
+		return Multi{}, p.errorf(start, "has %d keys in a multisig "+
+			"script inside %s(), expected 1 to %d", n, parent, limit)
+	case k < 1 || k > n:
+		return Multi{}, p.errorf(start, "has threshold %d of %d keys",
+			k, n)
+	}
+	return m, nil
+}
+
+// token reads a run of letters, digits and underscores.
+func (p *parser) token() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c != '_' && (c < '0' || c > '9') && (c < 'a' || c > 'z') &&
+			(c < 'A' || c > 'Z') {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		if p.pos >= len(p.s) {
+			return p.errorf(p.pos, "ends where %q was expected", c)
+		}
+		return p.errorf(p.pos, "has %q where %q was expected",
+			p.s[p.pos], c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) errorf(pos int, format string, args ...any) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// private returns the error for a private key at pos. The message does
+// not repeat the key.
+func (p *parser) private(pos int) error {
+	return &Error{Pos: pos, err: address.ErrPrivateKey,
+		Msg: "has a private key, only public keys are accepted"}
+}
@@ -0,0 +1,209 @@
+package descriptor
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// Vectors without an address in their BIP were encoded from the BIP's
+// script with the reference implementations of BIP173 and Base58Check.
+
+const (
+	xpub1 = "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB"
+	xpub2 = "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH"
+)
+
+type expansion struct {
+	name       string
+	desc       string
+	path       int
+	start, end uint32
+	want       []string
+}
+
+func testExpand(t *testing.T, network address.Network,
+	tests []expansion) {
+	t.Helper()
+	p, _ := address.Params(address.Bitcoin, network)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Parse(address.Bitcoin, tt.desc)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if _, err := Parse(address.Bitcoin, d.String()); err != nil {
+				t.Errorf("Parse(%s): %v", d, err)
+			}
+			out, err := d.Expand(p, tt.path, tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("Expand: %v", err)
+			}
+			var got []string
+			for _, o := range out {
+				got = append(got, o.Address.Encoded)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expand = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		in  string
+		sum string
+		bad int
+	}{
+		// BIP380
+		{"raw(deadbeef)", "89f8spxm", -1},
+		{"pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)",
+			"8fhd9pwu", -1},
+		{"raw(dëadbeef)", "", 5},
+	}
+	for _, tt := range tests {
+		sum, bad := Checksum(tt.in)
+		if sum != tt.sum || bad != tt.bad {
+			t.Errorf("Checksum(%q) = %q, %d, want %q, %d",
+				tt.in, sum, bad, tt.sum, tt.bad)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	const pkh = "pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)"
+	tests := []struct {
+		name    string
+		desc    string
+		private bool
+	}{
+		// BIP380
+		{"empty checksum", pkh + "#", false},
+		{"long checksum", pkh + "#8fhd9pwuq", false},
+		{"short checksum", pkh + "#8fhd9pw", false},
+		{"wrong checksum", pkh + "#8fhd9pwv", false},
+		{"double separator", pkh + "##8fhd9pwu", false},
+		{"invalid character", "pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709eë5)", false},
+		// BIP381 and BIP382
+		{"sh inside sh", "sh(sh(pkh(03a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd)))", false},
+		{"wsh inside wsh", "wsh(wsh(pkh(03a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd)))", false},
+		{"wsh inside sh inside wsh", "wsh(sh(pkh(03a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd)))", false},
+		{"wpkh inside wsh", "wsh(wpkh(03a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd))", false},
+		{"uncompressed wpkh", "wpkh(04a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd5b8dec5235a0fa8722476c7709c02559e3aa73aa03918ba2d492eea75abea235)", false},
+		{"hardened step after xpub", "pkh(" + xpub2 + "/1'/*)", false},
+		{"unknown fragment", "foo(" + xpub2 + ")", false},
+		{"trailing input", pkh + "x", false},
+		// BIP385
+		{"raw", "raw(deadbeef)#89f8spxm", false},
+		// Private keys, the WIF and xprv of BIP381 and BIP32 vector 1
+		{"WIF", "pkh(L4rK1yDtCWekvXuE6oXD9jCYfFNV2cWRpVuPLBcCU2z8TrisoyY1)", true},
+		{"xprv", "wpkh(xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi/0/*)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(address.Bitcoin, tt.desc)
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Parse = %v, want a descriptor error", err)
+			}
+			if errors.Is(err, address.ErrPrivateKey) != tt.private {
+				t.Errorf("Parse = %v, private key %t", err, tt.private)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	testExpand(t, address.Mainnet, []expansion{
+		// BIP381
+		{"pkh", "pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)#8fhd9pwu",
+			0, 0, 0, []string{"1cMh228HTCiwS8ZsaakH8A8wze1JR5ZsP"}},
+		{"pkh with origin", "pkh([deadbeef/1/2'/3/4']03a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd)",
+			0, 0, 0, []string{"1F3sAm6ZtwLAUnj7d38pGFxtP3RVEvtsbV"}},
+		{"pkh of xpub", "pkh([bd16bee5/0']xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw/1/2)",
+			0, 0, 0, []string{"1PdNaNxbyQvHW5QHuAZenMGVHrrRaJuZDJ"}},
+		{"sh of wpkh", "sh(wpkh(03fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556))",
+			0, 0, 0, []string{"3LKyvRN6SmYXGBNn8fcQvYxW9MGKtwcinN"}},
+		// BIP382
+		{"wpkh", "wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)",
+			0, 0, 0, []string{"bc1q0ht9tyks4vh7p5p904t340cr9nvahy7u3re7zg"}},
+		{"wsh of pkh", "wsh(pkh(02e493dbf1c10d80f3581e4904930b1404cc6c13900ee0758474fa94abe8c4cd13))",
+			0, 0, 0, []string{"bc1ql3dvcvp24wtlsg0e5c0pe3tju7tg5cp428546jap9dga7evpfqhsncqcl0"}},
+		{"sh of wsh of pkh", "sh(wsh(pkh(02e493dbf1c10d80f3581e4904930b1404cc6c13900ee0758474fa94abe8c4cd13)))",
+			0, 0, 0, []string{"39XGHYpYmJV9sGFoGHZeU2rLkY6r1MJ6C1"}},
+		{"ranged wpkh", "wpkh([ffffffff/13']" + xpub2 + "/1/2/*)",
+			0, 0, 2, []string{
+				"bc1qxf4jyj0r5fw4m3sfxhcyfm5rt5ysh2zej5q0n2",
+				"bc1q4u9anz4u9uk2uehrdzt288l795efsnahdcv7nh",
+				"bc1qr7ne3m73e0u4e6leztqrrw9y5m5lh8e8y2j7hv"}},
+		// BIP389
+		{"receive path", "wpkh(" + xpub2 + "/<0;1>/*)", 0, 0, 1,
+			[]string{
+				"bc1qd2vc2a9w8hvcw9dd3qz8e83ymhnqn24y0tqk88",
+				"bc1qene8fhnwg48f583esnd9g2pmf20lzquu7kgrrd"}},
+		{"change path", "wpkh(" + xpub2 + "/<0;1>/*)", 1, 0, 1,
+			[]string{
+				"bc1qwxejgp39yavp4h32xgjfll8w8l2yl5s30echgk",
+				"bc1qpsl6llemcgzzj9p2mgx2p4gprv4a0830gza6tg"}},
+		// BIP385
+		{"addr", "addr(bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4)",
+			0, 0, 0, []string{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"}},
+	})
+}
+
+func TestExpandMultisig(t *testing.T) {
+	testExpand(t, address.Mainnet, []expansion{
+		// BIP383
+		{"sh of multi", "sh(multi(2,022f01e5e15cca351daff3843fb70f3c2f0a1bdd05e5af888a67784ef3e10a2a01,03acd484e2f0c7f65309ad178a9f559abde09796974c57e714c35f110dfc27ccbe))",
+			0, 0, 0, []string{"3GtEB3yg3r5de2cDJG48SkQwxfxJumKQdN"}},
+		{"sh of sortedmulti", "sh(sortedmulti(2,03acd484e2f0c7f65309ad178a9f559abde09796974c57e714c35f110dfc27ccbe,022f01e5e15cca351daff3843fb70f3c2f0a1bdd05e5af888a67784ef3e10a2a01))",
+			0, 0, 0, []string{"3GtEB3yg3r5de2cDJG48SkQwxfxJumKQdN"}},
+		{"wsh of multi", "wsh(multi(2,03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7,03774ae7f858a9411e5ef4246b70c65aac5649980be5c17891bbec17895da008cb,03d01115d548e7561b15c38f004d734633687cf4419620095bc5b0f47070afe85a))",
+			0, 0, 0, []string{"bc1qwu7hp9vckakyuw6htsy244qxtztrlyez4l7qlrpg68v6drgvj39qn4zazc"}},
+		{"sh of wsh of multi", "sh(wsh(multi(1,03f28773c2d975288bc7d1d205c3748651b075fbc6610e58cddeeddf8f19405aa8,03499fdf9e895e719cfd64e67f07d38e3226aa7b63678949e6e49b241a60e823e4,02d7924d4f7d43ea965a465ae3095ff41131e5946f3c85f79e44adbcf8e27e080e)))",
+			0, 0, 0, []string{"3Hd7YQStg9gYpEt6hgK14ZHUABxSURzeuQ"}},
+		{"ranged wsh of sortedmulti", "wsh(sortedmulti(1," + xpub1 + "/1/0/*," + xpub2 + "/0/0/*))",
+			0, 0, 2, []string{
+				"bc1qvjtfmrxu524qhdevl6yyyasjs7xmnzjlqlu60mrwepact60eyz9s9xjw0c",
+				"bc1qp6rfclasvmwys7w7j4svgc2mrujq9m73s5shpw4e799hwkdcqlcsj464fw",
+				"bc1qvxcjrqhrkdkkuujfk3enulmwve5r2x4cm9f4q8g64kg64q7puyvsv8vkcm"}},
+	})
+}
+
+func TestParseMultisigInvalid(t *testing.T) {
+	const key = ",03a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd"
+	for _, s := range []string{
+		// BIP383
+		"multi(1" + key + ")",
+		"sh(multi(0" + key + "))",
+		"sh(multi(3" + strings.Repeat(key, 2) + "))",
+		"sh(multi(1" + strings.Repeat(key, 16) + "))",
+		"wsh(multi(1))",
+		"wsh(sortedmulti(a" + key + "))",
+	} {
+		var e *Error
+		if _, err := Parse(address.Bitcoin, s); !errors.As(err, &e) {
+			t.Errorf("Parse(%s) = %v, want a descriptor error", s, err)
+		}
+	}
+}
+
+func TestExpandOtherNetwork(t *testing.T) {
+	p, _ := address.Params(address.Bitcoin, address.Mainnet)
+	for _, s := range []string{
+		"addr(tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx)",
+		"wpkh(tpubDD7tXK8KeQ3YY83yWq755fHY2JW8Ha8Q765tknUM5rSvjPcGWfUppDFMpQ1ScziKfW3ZNtZvAD7M3u7bSs7HofjTD3KP3YxPK7X6hwV8Rk2/0/*)",
+	} {
+		d, err := Parse(address.Bitcoin, s)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", s, err)
+		}
+		if _, err := d.Expand(p, 0, 0, 0); err == nil {
+			t.Errorf("Expand(%s) on mainnet succeeded", s)
+		}
+	}
+}
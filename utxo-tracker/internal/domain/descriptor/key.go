@@ -0,0 +1,342 @@
+package descriptor
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// Key is a key expression of BIP380.
+type Key struct {
+	// Origin is where the key was derived from, if given
+	Origin *Origin
+	// PubKey is the compressed public key of keys given in hex. It is
+	// unset for extended keys.
+	PubKey [33]byte
+	// XOnly is set for hex keys given as the 32 byte x coordinate,
+	// which tr() allows.
+	XOnly bool
+	// Extended is set for extended public keys
+	Extended *address.ExtendedKey
+	// Steps are the derivation steps following the extended key, not
+	// counting the wildcard.
+	Steps []Step
+	// Wildcard is set for ranged keys that end in /*
+	Wildcard bool
+}
+
+// Origin is the key origin of a key expression.
+type Origin struct {
+	Fingerprint [4]byte
+	// Path lists the steps from the master key, hardened ones offset by
+	// address.HardenedOffset.
+	Path []uint32
+}
+
+// Step is a derivation step. Steps of BIP389 multipath expressions
+// have more than one value, the others have one.
+type Step []uint32
+
+// ParseKey parses a key expression of chain c on its own, such as the
+// keys of a multisig script.
+func ParseKey(c address.Chain, s string) (Key, error) {
+	p := parser{s: s, chain: c}
+	k, err := p.parseKey(false)
+	if err == nil && p.pos < len(s) {
+		err = p.errorf(p.pos, "has unexpected %q after the key",
+			s[p.pos:])
+	}
+	return k, err
+}
+
+// parseKey reads a key expression. xOnly allows 32 byte hex keys.
+func (p *parser) parseKey(xOnly bool) (Key, error) {
+	var k Key
+	if p.peek() == '[' {
+		o, err := p.parseOrigin()
+		if err != nil {
+			return Key{}, err
+		}
+		k.Origin = &o
+	}
+	start := p.pos
+	text := p.token()
+	if text == "" {
+		return Key{}, p.errorf(start, "expected a key")
+	}
+	if b, err := hex.DecodeString(text); err == nil {
+		switch {
+		case len(b) == 33 && (b[0] == 2 || b[0] == 3):
+			copy(k.PubKey[:], b)
+		case len(b) == 32 && xOnly:
+			k.PubKey[0] = 2
+			copy(k.PubKey[1:], b)
+			k.XOnly = true
+		case len(b) == 65 && b[0] == 4:
+			return Key{}, p.errorf(start,
+				"has an uncompressed key, which is not supported")
+		default:
+			return Key{}, p.errorf(start,
+				"has a hex key of %d bytes, which is not a public key",
+				len(b))
+		}
+		if !address.ValidPubKey(k.PubKey) {
+			return Key{}, p.errorf(start, "has an invalid public key")
+		}
+		if p.peek() == '/' {
+			return Key{}, p.errorf(p.pos,
+				"derives from a key that is not an extended key")
+		}
+		return k, nil
+	}
+	if address.IsWIF(text) {
+		return Key{}, p.private(start)
+	}
+	ek, err := address.ParseExtendedKey(p.chain, text)
+	if errors.Is(err, address.ErrPrivateKey) {
+		return Key{}, p.private(start)
+	}
+	if err != nil {
+		return Key{}, p.errorf(start, "has a key that %s", err)
+	}
+	k.Extended = &ek
+	return k, p.parseSteps(&k)
+}
+
+// parseOrigin reads a key origin in brackets.
+func (p *parser) parseOrigin() (Origin, error) {
+	p.pos++
+	var o Origin
+	start := p.pos
+	fp := p.token()
+	b, err := hex.DecodeString(fp)
+	if err != nil || len(b) != 4 {
+		return Origin{}, p.errorf(start,
+			"has a key origin without an 8 digit hex fingerprint")
+	}
+	copy(o.Fingerprint[:], b)
+	for p.peek() == '/' {
+		p.pos++
+		v, err := p.parseIndex()
+		if err != nil {
+			return Origin{}, err
+		}
+		o.Path = append(o.Path, v)
+	}
+	if err := p.expect(']'); err != nil {
+		return Origin{}, err
+	}
+	return o, nil
+}
+
+// parseSteps reads the derivation steps following an extended key.
+func (p *parser) parseSteps(k *Key) error {
+	width := 0
+	for p.peek() == '/' {
+		p.pos++
+		start := p.pos
+		var s Step
+		switch p.peek() {
+		case '*':
+			p.pos++
+			if c := p.peek(); c == '\'' || c == 'h' || c == 'H' {
+				return p.errorf(start, "has a hardened wildcard, "+
+					"which needs a private key")
+			}
+			k.Wildcard = true
+			if p.peek() == '/' {
+				return p.errorf(p.pos,
+					"continues deriving after the wildcard")
+			}
+			return nil
+		case '<':
+			if width > 0 {
+				return p.errorf(start,
+					"has more than one multipath step in a key")
+			}
+			p.pos++
+			for {
+				v, err := p.parseIndex()
+				if err != nil {
+					return err
+				}
+				s = append(s, v)
+				if p.peek() != ';' {
+					break
+				}
+				p.pos++
+			}
+			if err := p.expect('>'); err != nil {
+				return err
+			}
+			if len(s) < 2 {
+				return p.errorf(start,
+					"has a multipath step with fewer than two paths")
+			}
+			width = len(s)
+		default:
+			v, err := p.parseIndex()
+			if err != nil {
+				return err
+			}
+			s = Step{v}
+		}
+		for _, v := range s {
+			if v >= address.HardenedOffset {
+				return p.errorf(start, "has a hardened step after an "+
+					"extended public key, which needs a private key")
+			}
+		}
+		k.Steps = append(k.Steps, s)
+	}
+	return nil
+}
+
+// parseIndex reads a derivation index, possibly hardened.
+func (p *parser) parseIndex() (uint32, error) {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	v, err := strconv.ParseUint(p.s[start:p.pos], 10, 32)
+	if err != nil || v >= address.HardenedOffset {
+		return 0, p.errorf(start, "expected a derivation index")
+	}
+	if c := p.peek(); c == '\'' || c == 'h' || c == 'H' {
+		p.pos++
+		v += address.HardenedOffset
+	}
+	return uint32(v), nil
+}
+
+// paths returns the number of paths of the key's multipath step, or 1
+// if it has none.
+func (k Key) paths() int {
+	for _, s := range k.Steps {
+		if len(s) > 1 {
+			return len(s)
+		}
+	}
+	return 1
+}
+
+// base returns the key that path of the key's paths ranges over. Keys
+// without wildcard are their own base.
+func (k Key) base(path int) (address.ExtendedKey, error) {
+	ek := *k.Extended
+	for _, s := range k.Steps {
+		v := s[0]
+		if len(s) > 1 {
+			v = s[path]
+		}
+		var err error
+		if ek, err = ek.Child(v); err != nil {
+			return address.ExtendedKey{}, err
+		}
+	}
+	return ek, nil
+}
+
+// derivationPath returns the path of the key at index i of the given
+// path. It is absolute if the key has an origin and relative to the
+// extended key otherwise. Hex keys without origin have no path.
+func (k Key) derivationPath(path int, i uint32) string {
+	var steps []uint32
+	if k.Origin != nil {
+		steps = append(steps, k.Origin.Path...)
+	}
+	for _, s := range k.Steps {
+		if len(s) > 1 {
+			steps = append(steps, s[path])
+		} else {
+			steps = append(steps, s[0])
+		}
+	}
+	if k.Wildcard {
+		steps = append(steps, i)
+	}
+	parts := make([]string, 0, len(steps)+1)
+	if k.Origin != nil {
+		parts = append(parts, "m")
+	}
+	for _, v := range steps {
+		parts = append(parts, formatIndex(v, "'"))
+	}
+	return strings.Join(parts, "/")
+}
+
+// Fingerprint returns the fingerprint of the key's origin, or the one
+// of the key itself if it has no origin.
+func (k Key) Fingerprint() [4]byte {
+	switch {
+	case k.Origin != nil:
+		return k.Origin.Fingerprint
+	case k.Extended != nil:
+		return address.Fingerprint(k.Extended.PubKey)
+	}
+	return address.Fingerprint(k.PubKey)
+}
+
+// OriginPath returns the path of the key's origin, or an empty string
+// if it has none.
+func (k Key) OriginPath() string {
+	if k.Origin == nil {
+		return ""
+	}
+	parts := []string{"m"}
+	for _, v := range k.Origin.Path {
+		parts = append(parts, formatIndex(v, "'"))
+	}
+	return strings.Join(parts, "/")
+}
+
+// Encoded returns the key without origin and derivation steps.
+func (k Key) Encoded() string {
+	switch {
+	case k.Extended != nil:
+		return k.Extended.Encoded
+	case k.XOnly:
+		return hex.EncodeToString(k.PubKey[1:])
+	}
+	return hex.EncodeToString(k.PubKey[:])
+}
+
+// String returns the canonical form of the key expression.
+func (k Key) String() string {
+	var b strings.Builder
+	if o := k.Origin; o != nil {
+		b.WriteString("[" + hex.EncodeToString(o.Fingerprint[:]))
+		for _, v := range o.Path {
+			b.WriteString("/" + formatIndex(v, "h"))
+		}
+		b.WriteString("]")
+	}
+	b.WriteString(k.Encoded())
+	for _, s := range k.Steps {
+		parts := make([]string, 0, len(s))
+		for _, v := range s {
+			parts = append(parts, formatIndex(v, "h"))
+		}
+		if len(s) > 1 {
+			b.WriteString("/<" + strings.Join(parts, ";") + ">")
+		} else {
+			b.WriteString("/" + parts[0])
+		}
+	}
+	if k.Wildcard {
+		b.WriteString("/*")
+	}
+	return b.String()
+}
+
+// formatIndex formats a derivation index, marking hardened ones.
+func formatIndex(v uint32, hardened string) string {
+	if v >= address.HardenedOffset {
+		return fmt.Sprint(v-address.HardenedOffset) + hardened
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,460 @@
+package descriptor
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Node is a miniscript expression of BIP379. Aliases such as pk() and
+// t: are kept as written and expanded when typing and encoding.
+type Node struct {
+	// Fragment is the fragment name, such as and_v, or the letter of a
+	// wrapper.
+	Fragment string
+	Args     []*Node
+	Keys     []Key
+	// K is the threshold of thresh and the multisig fragments and the
+	// value of older and after.
+	K uint32
+	// Hash is the digest of the hash fragments
+	Hash []byte
+	// pos is where the expression starts, for type errors
+	pos int
+}
+
+// wrappers are the letters that can precede a colon.
+const wrappers = "asctdvjnlu"
+
+// hashSizes are the digest sizes of the hash fragments.
+var hashSizes = map[string]int{
+	"sha256": 32, "hash256": 32, "ripemd160": 20, "hash160": 20,
+}
+
+// arity is the number of subexpressions of the combinators.
+var arity = map[string]int{
+	"andor": 3, "and_v": 2, "and_b": 2, "and_n": 2,
+	"or_b": 2, "or_c": 2, "or_d": 2, "or_i": 2,
+}
+
+// isMiniscript reports whether name is a miniscript fragment, so that
+// it can be told apart from unknown ones outside wsh() and tr().
+func isMiniscript(name string) bool {
+	_, hash := hashSizes[name]
+	_, comb := arity[name]
+	switch name {
+	case "pk_k", "pk_h", "older", "after", "thresh", "multi_a",
+		"sortedmulti_a":
+		return true
+	}
+	return hash || comb
+}
+
+// parseNode reads a miniscript expression. tap selects the tapscript
+// context and leaf is set for the top of a tap leaf, the only place
+// sortedmulti_a() may appear.
+func (p *parser) parseNode(tap, leaf bool) (*Node, error) {
+	start := p.pos
+	name := p.token()
+	if name == "" {
+		return nil, p.errorf(start, "expected a miniscript expression")
+	}
+	if p.peek() == ':' {
+		p.pos++
+		inner, err := p.parseNode(tap, false)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(name) - 1; i >= 0; i-- {
+			if !strings.ContainsRune(wrappers, rune(name[i])) {
+				return nil, p.errorf(start, "has unknown wrapper %q",
+					name[i])
+			}
+			inner = &Node{Fragment: name[i : i+1], Args: []*Node{inner},
+				pos: start}
+		}
+		return inner, nil
+	}
+	n := &Node{Fragment: name, pos: start}
+	if name == "0" || name == "1" {
+		return n, nil
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	var err error
+	switch name {
+	case "pk_k", "pk_h", "pk", "pkh":
+		var k Key
+		k, err = p.parseKey(tap)
+		n.Keys = []Key{k}
+	case "older", "after":
+		n.K, err = p.parseNumber(1, 1<<31-1)
+	case "sha256", "hash256", "ripemd160", "hash160":
+		at := p.pos
+		n.Hash, err = hex.DecodeString(p.token())
+		if err != nil || len(n.Hash) != hashSizes[name] {
+			return nil, p.errorf(at, "expected a %d byte hex digest",
+				hashSizes[name])
+		}
+	case "andor", "and_v", "and_b", "and_n", "or_b", "or_c", "or_d",
+		"or_i":
+		for i := 0; i < arity[name] && err == nil; i++ {
+			if i > 0 {
+				err = p.expect(',')
+			}
+			var sub *Node
+			if err == nil {
+				sub, err = p.parseNode(tap, false)
+				n.Args = append(n.Args, sub)
+			}
+		}
+	case "thresh":
+		if n.K, err = p.parseNumber(1, 1<<31-1); err != nil {
+			return nil, err
+		}
+		for p.peek() == ',' && err == nil {
+			p.pos++
+			var sub *Node
+			sub, err = p.parseNode(tap, false)
+			n.Args = append(n.Args, sub)
+		}
+		if err == nil && int(n.K) > len(n.Args) {
+			err = p.errorf(start, "has threshold %d of %d expressions",
+				n.K, len(n.Args))
+		}
+	case "multi", "multi_a", "sortedmulti_a":
+		err = p.parseMultiNode(n, tap, leaf)
+	default:
+		return nil, p.errorf(start, "has unknown miniscript fragment %s()",
+			name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n, p.expect(')')
+}
+
+// parseMultiNode reads the arguments of the multisig fragments into n.
+func (p *parser) parseMultiNode(n *Node, tap, leaf bool) error {
+	switch {
+	case n.Fragment == "multi" && tap:
+		return p.errorf(n.pos, "has multi() in a tap leaf, use multi_a()")
+	case n.Fragment != "multi" && !tap:
+		return p.errorf(n.pos, "has %s() outside a tap leaf",
+			n.Fragment)
+	case n.Fragment == "sortedmulti_a" && !leaf:
+		return p.errorf(n.pos,
+			"has sortedmulti_a() below the top of a tap leaf")
+	}
+	var err error
+	if n.K, err = p.parseNumber(1, 1<<31-1); err != nil {
+		return err
+	}
+	for p.peek() == ',' {
+		p.pos++
+		k, err := p.parseKey(tap)
+		if err != nil {
+			return err
+		}
+		n.Keys = append(n.Keys, k)
+	}
+	limit := MaxMultiKeys
+	if tap {
+		limit = MaxMultiAKeys
+	}
+	switch c := len(n.Keys); {
+	case c == 0 || c > limit:
+		return p.errorf(n.pos, "has %d keys in %s(), expected 1 to %d",
+			c, n.Fragment, limit)
+	case int(n.K) > c:
+		return p.errorf(n.pos, "has threshold %d of %d keys", n.K, c)
+	}
+	return nil
+}
+
+// MaxMultiAKeys is the limit on the keys of multi_a() and
+// sortedmulti_a(), the number of signatures a tap leaf can check.
+const MaxMultiAKeys = 999
+
+// parseNumber reads a decimal number between lo and hi.
+func (p *parser) parseNumber(lo, hi uint64) (uint32, error) {
+	start := p.pos
+	v, err := strconv.ParseUint(p.token(), 10, 32)
+	if err != nil || v < lo || v > hi {
+		return 0, p.errorf(start, "expected a number from %d to %d",
+			lo, hi)
+	}
+	return uint32(v), nil
+}
+
+// checkTop type checks a miniscript expression at the top of a script,
+// where it must be of type B.
+func (p *parser) checkTop(n *Node, tap bool) error {
+	t, err := n.typ(tap)
+	if err != nil {
+		return err
+	}
+	if t.base != 'B' {
+		return p.errorf(n.pos, "has a miniscript expression of type %c, "+
+			"expected B", t.base)
+	}
+	return nil
+}
+
+// String returns the canonical form of the expression.
+func (n *Node) String() string {
+	if strings.Contains(wrappers, n.Fragment) && len(n.Args) == 1 {
+		inner := n.Args[0].String()
+		if strings.Contains(wrappers, n.Args[0].Fragment) &&
+			len(n.Args[0].Args) == 1 {
+			return n.Fragment + inner
+		}
+		return n.Fragment + ":" + inner
+	}
+	var parts []string
+	switch n.Fragment {
+	case "0", "1":
+		return n.Fragment
+	case "older", "after":
+		parts = append(parts, fmt.Sprint(n.K))
+	case "sha256", "hash256", "ripemd160", "hash160":
+		parts = append(parts, hex.EncodeToString(n.Hash))
+	case "thresh", "multi", "multi_a", "sortedmulti_a":
+		parts = append(parts, fmt.Sprint(n.K))
+	}
+	for _, k := range n.Keys {
+		parts = append(parts, k.String())
+	}
+	for _, a := range n.Args {
+		parts = append(parts, a.String())
+	}
+	return n.Fragment + "(" + strings.Join(parts, ",") + ")"
+}
+
+// keys returns the keys of the expression in order.
+func (n *Node) keys() []Key {
+	out := append([]Key(nil), n.Keys...)
+	for _, a := range n.Args {
+		out = append(out, a.keys()...)
+	}
+	return out
+}
+
+// msType is the type of a miniscript expression: its basic type B, V,
+// K or W and the properties z, o, n, d and u. The malleability
+// properties are not tracked, as watching addresses needs no
+// satisfactions.
+type msType struct {
+	base          byte
+	z, o, n, d, u bool
+}
+
+// typ returns the type of the expression in context tap, or an error
+// if it is not well typed.
+func (n *Node) typ(tap bool) (msType, error) {
+	args := make([]msType, len(n.Args))
+	for i, a := range n.Args {
+		var err error
+		if args[i], err = a.typ(tap); err != nil {
+			return msType{}, err
+		}
+	}
+	need := func(i int, base byte, props string) error {
+		t := args[i]
+		ok := t.base == base
+		for _, c := range props {
+			ok = ok && map[rune]bool{'z': t.z, 'o': t.o, 'n': t.n,
+				'd': t.d, 'u': t.u}[c]
+		}
+		if !ok {
+			return &Error{Pos: n.Args[i].pos, Msg: fmt.Sprintf(
+				"has a %s() argument that is not of type %c%s",
+				n.Fragment, base, props)}
+		}
+		return nil
+	}
+	x, y, z := msType{}, msType{}, msType{}
+	if len(args) > 0 {
+		x = args[0]
+	}
+	if len(args) > 1 {
+		y = args[1]
+	}
+	if len(args) > 2 {
+		z = args[2]
+	}
+	switch n.Fragment {
+	case "0":
+		return msType{base: 'B', z: true, u: true, d: true}, nil
+	case "1":
+		return msType{base: 'B', z: true, u: true}, nil
+	case "pk_k":
+		return msType{base: 'K', o: true, n: true, d: true, u: true}, nil
+	case "pk_h":
+		return msType{base: 'K', n: true, d: true, u: true}, nil
+	case "pk":
+		return msType{base: 'B', o: true, n: true, d: true, u: true}, nil
+	case "pkh":
+		return msType{base: 'B', n: true, d: true, u: true}, nil
+	case "older", "after":
+		return msType{base: 'B', z: true}, nil
+	case "sha256", "hash256", "ripemd160", "hash160":
+		return msType{base: 'B', o: true, n: true, d: true, u: true}, nil
+	case "multi":
+		return msType{base: 'B', n: true, d: true, u: true}, nil
+	case "multi_a", "sortedmulti_a":
+		return msType{base: 'B', d: true, u: true}, nil
+	case "andor", "and_n":
+		if n.Fragment == "and_n" {
+			// and_n(X,Y) is andor(X,Y,0)
+			z = msType{base: 'B', z: true, u: true, d: true}
+		}
+		if err := need(0, 'B', "du"); err != nil {
+			return msType{}, err
+		}
+		if b := y.base; b != z.base || b == 'W' {
+			return msType{}, &Error{Pos: n.pos, Msg: fmt.Sprintf(
+				"has %s() branches that are not both of type B, K "+
+					"or V", n.Fragment)}
+		}
+		return msType{base: y.base, z: x.z && y.z && z.z,
+			o: x.z && y.o && z.o || x.o && y.z && z.z,
+			u: y.u && z.u, d: x.d && z.d}, nil
+	case "and_v":
+		if err := need(0, 'V', ""); err != nil {
+			return msType{}, err
+		}
+		if y.base == 'W' {
+			return msType{}, need(1, 'B', "")
+		}
+		return msType{base: y.base, z: x.z && y.z,
+			o: x.z && y.o || x.o && y.z, n: x.n || x.z && y.n,
+			u: y.u}, nil
+	case "and_b":
+		if err := need(0, 'B', ""); err != nil {
+			return msType{}, err
+		}
+		if err := need(1, 'W', ""); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'B', z: x.z && y.z,
+			o: x.z && y.o || x.o && y.z, n: x.n || x.z && y.n,
+			d: x.d && y.d, u: true}, nil
+	case "or_b":
+		if err := need(0, 'B', "d"); err != nil {
+			return msType{}, err
+		}
+		if err := need(1, 'W', "d"); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'B', z: x.z && y.z,
+			o: x.z && y.o || x.o && y.z, d: true, u: true}, nil
+	case "or_c":
+		if err := need(0, 'B', "du"); err != nil {
+			return msType{}, err
+		}
+		if err := need(1, 'V', ""); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'V', z: x.z && y.z, o: x.o && y.z}, nil
+	case "or_d":
+		if err := need(0, 'B', "du"); err != nil {
+			return msType{}, err
+		}
+		if err := need(1, 'B', ""); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'B', z: x.z && y.z, o: x.o && y.z,
+			d: y.d, u: y.u}, nil
+	case "or_i":
+		if x.base != y.base || x.base == 'W' {
+			return msType{}, &Error{Pos: n.pos, Msg: "has or_i() " +
+				"branches that are not both of type B, K or V"}
+		}
+		return msType{base: x.base, o: x.z && y.z, u: x.u && y.u,
+			d: x.d || y.d}, nil
+	case "thresh":
+		t := msType{base: 'B', z: true, d: true, u: true}
+		ones := 0
+		for i, a := range args {
+			props := "du"
+			base := byte('W')
+			if i == 0 {
+				base = 'B'
+			}
+			if err := need(i, base, props); err != nil {
+				return msType{}, err
+			}
+			t.z = t.z && a.z
+			if !a.z {
+				ones++
+				if !a.o {
+					ones = len(args) + 1
+				}
+			}
+		}
+		t.o = ones == 1
+		return t, nil
+	}
+	return wrapperType(n, x, tap, need)
+}
+
+// wrapperType returns the type of the wrapper n around an expression of
+// type x.
+func wrapperType(n *Node, x msType, tap bool,
+	need func(int, byte, string) error) (msType, error) {
+	switch n.Fragment {
+	case "a":
+		if err := need(0, 'B', ""); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'W', u: x.u, d: x.d}, nil
+	case "s":
+		if err := need(0, 'B', "o"); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'W', u: x.u, d: x.d}, nil
+	case "c":
+		if err := need(0, 'K', ""); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'B', o: x.o, n: x.n, d: x.d, u: true}, nil
+	case "t":
+		// t:X is and_v(X,1)
+		if err := need(0, 'V', ""); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'B', z: x.z, o: x.o, n: x.n, u: true}, nil
+	case "d":
+		if err := need(0, 'V', "z"); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'B', o: true, n: true, d: true, u: tap}, nil
+	case "v":
+		if err := need(0, 'B', ""); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'V', z: x.z, o: x.o, n: x.n}, nil
+	case "j":
+		if err := need(0, 'B', "n"); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'B', o: x.o, n: true, d: true, u: x.u}, nil
+	case "n":
+		if err := need(0, 'B', ""); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'B', z: x.z, o: x.o, n: x.n, d: x.d,
+			u: true}, nil
+	case "l", "u":
+		// l:X is or_i(0,X) and u:X is or_i(X,0)
+		if err := need(0, 'B', ""); err != nil {
+			return msType{}, err
+		}
+		return msType{base: 'B', o: x.z, u: x.u, d: true}, nil
+	}
+	return msType{}, &Error{Pos: n.pos,
+		Msg: fmt.Sprintf("has unknown fragment %s()", n.Fragment)}
+}
@@ -0,0 +1,385 @@
+package descriptor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Opcodes used by the encoded scripts.
+const (
+	opIf                  = 0x63
+	opNotIf               = 0x64
+	opElse                = 0x67
+	opEndIf               = 0x68
+	opVerify              = 0x69
+	opToAltStack          = 0x6b
+	opFromAltStack        = 0x6c
+	opIfDup               = 0x73
+	opDup                 = 0x76
+	opSwap                = 0x7c
+	opSize                = 0x82
+	opEqual               = 0x87
+	opEqualVerify         = 0x88
+	op0NotEqual           = 0x92
+	opAdd                 = 0x93
+	opBoolAnd             = 0x9a
+	opBoolOr              = 0x9b
+	opNumEqual            = 0x9c
+	opNumEqualVerify      = 0x9d
+	opRipemd160           = 0xa6
+	opSha256              = 0xa8
+	opHash160             = 0xa9
+	opHash256             = 0xaa
+	opCheckSig            = 0xac
+	opCheckSigVerify      = 0xad
+	opCheckMultiSig       = 0xae
+	opCheckMultiSigVerify = 0xaf
+	opCheckLockTimeVerify = 0xb1
+	opCheckSequenceVerify = 0xb2
+	opCheckSigAdd         = 0xba
+)
+
+// verifyOf maps the opcodes v: merges with to their VERIFY form.
+var verifyOf = map[byte]byte{
+	opEqual:         opEqualVerify,
+	opCheckSig:      opCheckSigVerify,
+	opCheckMultiSig: opCheckMultiSigVerify,
+	opNumEqual:      opNumEqualVerify,
+}
+
+// encoder writes a script, taking the public keys of its keys in order.
+type encoder struct {
+	b    []byte
+	pubs [][33]byte
+	// tap selects tapscript, which pushes x-only keys
+	tap bool
+}
+
+func (e *encoder) op(ops ...byte) {
+	e.b = append(e.b, ops...)
+}
+
+// num pushes a script number.
+func (e *encoder) num(n int64) {
+	switch {
+	case n == 0:
+		e.op(0x00)
+		return
+	case n >= 1 && n <= 16:
+		e.op(0x50 + byte(n)) // OP_1 to OP_16
+		return
+	}
+	var v []byte
+	for x := n; x > 0; x >>= 8 {
+		v = append(v, byte(x))
+	}
+	if v[len(v)-1]&0x80 != 0 {
+		v = append(v, 0)
+	}
+	e.push(v)
+}
+
+// push pushes data of up to 75 bytes.
+func (e *encoder) push(data []byte) {
+	e.op(byte(len(data)))
+	e.op(data...)
+}
+
+// key returns the next public key as pushed in the context.
+func (e *encoder) key() []byte {
+	pub := e.pubs[0]
+	e.pubs = e.pubs[1:]
+	if e.tap {
+		return pub[1:]
+	}
+	return pub[:]
+}
+
+// keys returns the next n keys as pushed, sorted if asked to.
+func (e *encoder) keys(n int, sorted bool) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = e.key()
+	}
+	if sorted {
+		slices.SortFunc(out, bytes.Compare)
+	}
+	return out
+}
+
+// encode writes the script of n.
+func (e *encoder) encode(n *Node) {
+	switch n.Fragment {
+	case "0":
+		e.num(0)
+	case "1":
+		e.num(1)
+	case "pk_k", "pk":
+		e.push(e.key())
+		if n.Fragment == "pk" {
+			e.op(opCheckSig)
+		}
+	case "pk_h", "pkh":
+		e.op(opDup, opHash160)
+		e.push(hash160(e.key()))
+		e.op(opEqualVerify)
+		if n.Fragment == "pkh" {
+			e.op(opCheckSig)
+		}
+	case "older":
+		e.num(int64(n.K))
+		e.op(opCheckSequenceVerify)
+	case "after":
+		e.num(int64(n.K))
+		e.op(opCheckLockTimeVerify)
+	case "sha256", "hash256", "ripemd160", "hash160":
+		e.op(opSize)
+		e.num(32)
+		e.op(opEqualVerify)
+		e.op(map[string]byte{"sha256": opSha256, "hash256": opHash256,
+			"ripemd160": opRipemd160, "hash160": opHash160}[n.Fragment])
+		e.push(n.Hash)
+		e.op(opEqual)
+	case "andor":
+		e.encode(n.Args[0])
+		e.op(opNotIf)
+		e.encode(n.Args[2])
+		e.op(opElse)
+		e.encode(n.Args[1])
+		e.op(opEndIf)
+	case "and_v":
+		e.encode(n.Args[0])
+		e.encode(n.Args[1])
+	case "and_b":
+		e.encode(n.Args[0])
+		e.encode(n.Args[1])
+		e.op(opBoolAnd)
+	case "and_n":
+		e.encode(n.Args[0])
+		e.op(opNotIf)
+		e.num(0)
+		e.op(opElse)
+		e.encode(n.Args[1])
+		e.op(opEndIf)
+	case "or_b":
+		e.encode(n.Args[0])
+		e.encode(n.Args[1])
+		e.op(opBoolOr)
+	case "or_c":
+		e.encode(n.Args[0])
+		e.op(opNotIf)
+		e.encode(n.Args[1])
+		e.op(opEndIf)
+	case "or_d":
+		e.encode(n.Args[0])
+		e.op(opIfDup, opNotIf)
+		e.encode(n.Args[1])
+		e.op(opEndIf)
+	case "or_i":
+		e.op(opIf)
+		e.encode(n.Args[0])
+		e.op(opElse)
+		e.encode(n.Args[1])
+		e.op(opEndIf)
+	case "thresh":
+		for i, a := range n.Args {
+			e.encode(a)
+			if i > 0 {
+				e.op(opAdd)
+			}
+		}
+		e.num(int64(n.K))
+		e.op(opEqual)
+	case "multi":
+		e.num(int64(n.K))
+		for _, k := range e.keys(len(n.Keys), false) {
+			e.push(k)
+		}
+		e.num(int64(len(n.Keys)))
+		e.op(opCheckMultiSig)
+	case "multi_a", "sortedmulti_a":
+		ks := e.keys(len(n.Keys), n.Fragment == "sortedmulti_a")
+		for i, k := range ks {
+			e.push(k)
+			if i == 0 {
+				e.op(opCheckSig)
+			} else {
+				e.op(opCheckSigAdd)
+			}
+		}
+		e.num(int64(n.K))
+		e.op(opNumEqual)
+	default:
+		e.wrap(n)
+	}
+}
+
+// wrap writes the script of the wrapper n.
+func (e *encoder) wrap(n *Node) {
+	x := n.Args[0]
+	switch n.Fragment {
+	case "a":
+		e.op(opToAltStack)
+		e.encode(x)
+		e.op(opFromAltStack)
+	case "s":
+		e.op(opSwap)
+		e.encode(x)
+	case "c":
+		e.encode(x)
+		e.op(opCheckSig)
+	case "t":
+		e.encode(x)
+		e.num(1)
+	case "d":
+		e.op(opDup, opIf)
+		e.encode(x)
+		e.op(opEndIf)
+	case "v":
+		// Expressions of type B end in an opcode, which merges with
+		// VERIFY if it has a VERIFY form
+		e.encode(x)
+		last := len(e.b) - 1
+		if v, ok := verifyOf[e.b[last]]; ok {
+			e.b[last] = v
+		} else {
+			e.op(opVerify)
+		}
+	case "j":
+		e.op(opSize, op0NotEqual, opIf)
+		e.encode(x)
+		e.op(opEndIf)
+	case "n":
+		e.encode(x)
+		e.op(op0NotEqual)
+	case "l":
+		e.op(opIf)
+		e.num(0)
+		e.op(opElse)
+		e.encode(x)
+		e.op(opEndIf)
+	case "u":
+		e.op(opIf)
+		e.encode(x)
+		e.op(opElse)
+		e.num(0)
+		e.op(opEndIf)
+	}
+}
+
+func hash160(b []byte) []byte {
+	h := sha256.Sum256(b)
+	r := ripemd160.New()
+	r.Write(h[:])
+	return r.Sum(nil)
+}
+
+// Tree is a taproot script tree. Leaves hold a tapscript, branches two
+// subtrees.
+type Tree struct {
+	Leaf        *Node
+	Left, Right *Tree
+}
+
+// maxTreeDepth is the depth limit of BIP341 script trees.
+const maxTreeDepth = 128
+
+func (t *Tree) String() string {
+	if t.Leaf != nil {
+		return t.Leaf.String()
+	}
+	return "{" + t.Left.String() + "," + t.Right.String() + "}"
+}
+
+// keys returns the keys of the leaves from left to right.
+func (t *Tree) keys() []Key {
+	if t.Leaf != nil {
+		return t.Leaf.keys()
+	}
+	return append(t.Left.keys(), t.Right.keys()...)
+}
+
+// leaves returns the leaf scripts from left to right.
+func (t *Tree) leaves() []*Node {
+	if t.Leaf != nil {
+		return []*Node{t.Leaf}
+	}
+	return append(t.Left.leaves(), t.Right.leaves()...)
+}
+
+// parseTree reads a script tree at the given depth.
+func (p *parser) parseTree(depth int) (*Tree, error) {
+	if depth > maxTreeDepth {
+		return nil, p.errorf(p.pos, "has a script tree deeper than %d",
+			maxTreeDepth)
+	}
+	if p.peek() != '{' {
+		leaf, err := p.parseNode(true, true)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkTop(leaf, true); err != nil {
+			return nil, err
+		}
+		return &Tree{Leaf: leaf}, nil
+	}
+	p.pos++
+	left, err := p.parseTree(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(','); err != nil {
+		return nil, err
+	}
+	right, err := p.parseTree(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &Tree{Left: left, Right: right}, p.expect('}')
+}
+
+// tapLeafVersion is the leaf version of tapscript.
+const tapLeafVersion = 0xc0
+
+// root returns the BIP341 merkle root of the tree, taking the public
+// keys of its keys from e.
+func (t *Tree) root(e *encoder) []byte {
+	if t.Leaf != nil {
+		e.b = nil
+		e.encode(t.Leaf)
+		msg := []byte{tapLeafVersion}
+		msg = appendCompactSize(msg, len(e.b))
+		return taggedHash("TapLeaf", append(msg, e.b...))
+	}
+	l, r := t.Left.root(e), t.Right.root(e)
+	if bytes.Compare(l, r) > 0 {
+		l, r = r, l
+	}
+	return taggedHash("TapBranch", append(l, r...))
+}
+
+// appendCompactSize appends the Bitcoin variable length integer n.
+func appendCompactSize(b []byte, n int) []byte {
+	switch {
+	case n < 0xfd:
+		return append(b, byte(n))
+	case n <= 0xffff:
+		return binary.LittleEndian.AppendUint16(append(b, 0xfd),
+			uint16(n))
+	}
+	return binary.LittleEndian.AppendUint32(append(b, 0xfe), uint32(n))
+}
+
+// taggedHash is the BIP340 tagged hash of msg.
+func taggedHash(tag string, msg []byte) []byte {
+	t := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(t[:])
+	h.Write(t[:])
+	h.Write(msg)
+	return h.Sum(nil)
+}
@@ -0,0 +1,99 @@
+package descriptor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// The script tree vectors were computed from the BIP341 tagged hashes
+// with the reference implementation of BIP350.
+
+const (
+	trKey = "a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd"
+	leaf1 = "669b8afcec803a0d323e9a17f3ea8e68e8abe5a278020a929adbec52421adbd0"
+	leaf2 = "e493dbf1c10d80f3581e4904930b1404cc6c13900ee0758474fa94abe8c4cd13"
+	leaf3 = "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"
+	// The BIP86 account 0 key of "abandon abandon … about"
+	bip86Account = "[73c5da0a/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"
+)
+
+func TestExpandTaproot(t *testing.T) {
+	testExpand(t, address.Mainnet, []expansion{
+		// BIP386
+		{"key path", "tr(" + trKey + ")", 0, 0, 0,
+			[]string{"bc1pw74tdcrxlzn5r8z6ku2vztr86fgq0m245s72mjktf4afwzsf8ugs0gs8zu"}},
+		{"ranged key path", "tr(" + xpub2 + "/0/*)", 0, 0, 1,
+			[]string{
+				"bc1p77d788x6r60fywrl9ksa2gytzgnhuk0ghnluav6hcghuhnqzgqus4dxacr",
+				"bc1prxwde7z0demcwyq344yuwjgvschj7ht5t6tpa47dwf5l27jyuk8q375gzl"}},
+		{"single leaf", "tr(" + trKey + ",pk(" + leaf1 + "))", 0, 0, 0,
+			[]string{"bc1pzl833kecrkpkmzfrkx7my3k0ekqcmgdf7rnw0yrlrplsktunwa2q7vxsg5"}},
+		{"tree", "tr(" + trKey + ",{pk(" + leaf1 + "),{pk(" + leaf2 +
+			"),pk(" + leaf3 + ")}})", 0, 0, 0,
+			[]string{"bc1p445vqjxxra5vunqwqqjwmnnjn7l5rkm6dhp87gcuc8zkj7cerpzsx4825q"}},
+		{"ranged leaf", "tr(" + trKey + ",{pk(" + xpub1 +
+			"/0/*),and_v(v:pk(" + leaf1 + "),older(144))})", 0, 0, 1,
+			[]string{
+				"bc1p4xnzjmpgjsw4ht0ga4zdj4d6hfpzy6p6gkgcfr7haqfhm39glftqxgcd6z",
+				"bc1ptrd0tvpa4a50wav0600c7aq2t72dmnm4jm8y2ky2mjhaqzawnqnq5wena7"}},
+		// BIP86
+		{"BIP86 receive", "tr(" + bip86Account + "/<0;1>/*)", 0, 0, 1,
+			[]string{
+				"bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+				"bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh"}},
+		{"BIP86 change", "tr(" + bip86Account + "/<0;1>/*)", 1, 0, 0,
+			[]string{"bc1p3qkhfews2uk44qtvauqyr2ttdsw7svhkl9nkm9s9c3x4ax5h60wqwruhk7"}},
+		// Miniscript
+		{"timelocked key", "wsh(and_v(v:pk(02" + leaf1 + "),older(144)))",
+			0, 0, 0,
+			[]string{"bc1qh9tsvf0ncn8wcvwdf9kxgcz54ex9906q7s3tkvugsk9ehhqa48hspt88nm"}},
+	})
+}
+
+func TestParseScriptInvalid(t *testing.T) {
+	const (
+		a = "02" + leaf1
+		b = "02" + leaf2
+	)
+	tests := []struct {
+		name    string
+		desc    string
+		private bool
+	}{
+		{"key at the top", "wsh(pk_k(" + a + "))", false},
+		{"and_v without verify", "wsh(and_v(pk(" + a + "),pk(" + b + ")))",
+			false},
+		{"older of zero", "wsh(and_v(v:pk(" + a + "),older(0)))", false},
+		{"after out of range",
+			"wsh(and_v(v:pk(" + a + "),after(2147483648)))", false},
+		{"short digest", "wsh(and_v(v:pk(" + a + "),sha256(ab)))", false},
+		{"unknown wrapper", "wsh(x:pk(" + a + "))", false},
+		{"unknown fragment", "wsh(foo(" + a + "))", false},
+		{"threshold above count",
+			"wsh(thresh(3,pk(" + a + "),s:pk(" + b + ")))", false},
+		{"miniscript at the top", "and_v(v:pk(" + a + "),older(1))", false},
+		{"multi_a outside tr", "wsh(multi_a(1," + a + "))", false},
+		{"multi in a leaf", "tr(" + trKey + ",multi(1," + leaf1 + "))",
+			false},
+		{"nested sortedmulti_a", "tr(" + trKey + ",and_v(v:pk(" + leaf1 +
+			"),sortedmulti_a(1," + leaf2 + ")))", false},
+		{"branch of one", "tr(" + trKey + ",{pk(" + leaf1 + ")})", false},
+		{"private key in a leaf", "tr(" + trKey +
+			",pk(L4rK1yDtCWekvXuE6oXD9jCYfFNV2cWRpVuPLBcCU2z8TrisoyY1))",
+			true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(address.Bitcoin, tt.desc)
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Parse = %v, want a descriptor error", err)
+			}
+			if errors.Is(err, address.ErrPrivateKey) != tt.private {
+				t.Errorf("Parse = %v, private key %t", err, tt.private)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/descriptor"
+)
+
+// Limits applied to output descriptors.
+const (
+	MaxDescriptors = 10
+	// DefaultDescriptorRange is the number of indexes ranged descriptors
+	// are expanded at when no range is given.
+	DefaultDescriptorRange = 20
+	MaxDescriptorRange     = 1000
+)
+
+// AccountDescriptor is an output descriptor an account expands into
+// addresses.
+type AccountDescriptor struct {
+	// Descriptor is the canonical form with checksum
+	Descriptor string
+	// Start and End are the first and last index ranged descriptors are
+	// expanded at, both included. They are zero for other descriptors.
+	Start uint32
+	End   uint32
+	// Addresses lists the addresses in the order they were expanded.
+	// Their branch is the path of multipath descriptors, 0 otherwise.
+	Addresses []DerivedAddress
+	// Multisig is set for descriptors of multisig scripts
+	Multisig *Multisig
+	// Conditions describes the ways to spend the outputs, see
+	// descriptor.Descriptor.Conditions.
+	Conditions []string
+}
+
+// Ranged reports whether the descriptor has a wildcard, the only place
+// a star appears in.
+func (d AccountDescriptor) Ranged() bool {
+	return strings.Contains(d.Descriptor, "*")
+}
+
+// DescriptorSpec holds the user editable fields of a descriptor.
+type DescriptorSpec struct {
+	Descriptor string
+	// Range holds the first and last index to expand at, both included.
+	// It defaults to the first DefaultDescriptorRange indexes.
+	Range []int
+}
+
+// newDescriptors validates specs and expands them on network n of chain
+// c, reporting violations for field. It returns them along with the
+// network, which is taken from the descriptors when empty.
+func newDescriptors(v *ValidationError, field string, c address.Chain,
+	n address.Network, specs []DescriptorSpec,
+) ([]AccountDescriptor, address.Network) {
+	if len(specs) > MaxDescriptors {
+		v.Add(field, "", fmt.Sprintf(
+			"must not hold more than %d descriptors", MaxDescriptors))
+		return nil, n
+	}
+	out := make([]AccountDescriptor, 0, len(specs))
+	parsed := make([]descriptor.Descriptor, 0, len(specs))
+	for _, spec := range specs {
+		s := strings.TrimSpace(spec.Descriptor)
+		d, err := descriptor.Parse(c, s)
+		if errors.Is(err, address.ErrPrivateKey) {
+			v.Add(field, "", err.Error())
+			out = append(out, AccountDescriptor{})
+			continue
+		}
+		if err != nil {
+			v.Add(field, s, err.Error())
+			out = append(out, AccountDescriptor{Descriptor: s})
+			continue
+		}
+		ad := AccountDescriptor{
+			Descriptor: d.String(),
+			Multisig:   multisigOf(d),
+			Conditions: d.Conditions(),
+		}
+		if d.Ranged() {
+			ad.Start, ad.End = descriptorRange(v, field, ad.Descriptor,
+				spec.Range)
+		}
+		if n == "" {
+			n = descriptorNetwork(c, d)
+		}
+		out = append(out, ad)
+		parsed = append(parsed, d)
+	}
+	if len(v.Violations) > 0 {
+		return out, n
+	}
+	if n == "" {
+		n = address.Mainnet
+	}
+	p, ok := address.Params(c, n)
+	if !ok {
+		// The network itself is reported by validate
+		return out, n
+	}
+	for i, d := range parsed {
+		ad := &out[i]
+		for path := 0; path < d.Paths(); path++ {
+			outputs, err := d.Expand(p, path, ad.Start, ad.End)
+			if err != nil {
+				v.Add(field, ad.Descriptor, err.Error())
+				break
+			}
+			for _, o := range outputs {
+				ad.Addresses = append(ad.Addresses, DerivedAddress{
+					Address: o.Address.Encoded,
+					Branch:  uint32(path),
+					Index:   o.Index,
+					Path:    o.Path,
+				})
+			}
+		}
+	}
+	return out, n
+}
+
+// descriptorRange validates the range r of descriptor d and returns
+// its first and last index.
+func descriptorRange(v *ValidationError, field, d string, r []int,
+) (uint32, uint32) {
+	if r == nil {
+		return 0, DefaultDescriptorRange - 1
+	}
+	switch {
+	case len(r) != 2:
+		v.Add(field, d,
+			"must have a range of a first and a last index")
+	case r[0] < 0 || r[1] >= address.HardenedOffset:
+		v.Add(field, d, fmt.Sprintf(
+			"must have a range within 0 and %d",
+			address.HardenedOffset-1))
+	case r[1] < r[0] || r[1]-r[0] >= MaxDescriptorRange:
+		v.Add(field, d, fmt.Sprintf(
+			"must have a range of 1 to %d indexes", MaxDescriptorRange))
+	default:
+		return uint32(r[0]), uint32(r[1])
+	}
+	return 0, 0
+}
+
+// descriptorNetwork returns the network the keys or address of d
+// belong to, or an empty one if it does not tell.
+func descriptorNetwork(c address.Chain, d descriptor.Descriptor,
+) address.Network {
+	if a, ok := d.Script.(descriptor.Addr); ok {
+		n, _ := address.CommonNetwork([]address.Address{a.Address})
+		return n
+	}
+	for _, k := range d.Keys() {
+		if k.Extended != nil {
+			return keyNetwork(c, k.Extended.Test)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrAccountNotFound is returned when an account does not exist or is
+	// not visible to the requesting user.
+	ErrAccountNotFound = errors.New("account not found")
+	// ErrDuplicateAccount is returned when an account conflicts with one
+	// that already exists.
+	ErrDuplicateAccount = errors.New("account already exists")
+	// ErrVersionMismatch is returned when an account was modified after
+	// the version a change is based on.
+	ErrVersionMismatch = errors.New(
+		"account was modified since the given version")
+	// ErrAddressNotTracked is returned when none of the user's accounts
+	// holds an address.
+	ErrAddressNotTracked = errors.New(
+		"address is not tracked in any account")
+)
+
+// Violation describes a single invalid input value.
+type Violation struct {
+	Field   string
+	Value   string
+	Message string
+}
+
+// ValidationError is returned when input fails domain validation. It
+// carries every violation found rather than only the first one.
+type ValidationError struct {
+	Violations []Violation
+}
+
+// Add records a violation.
+func (e *ValidationError) Add(field, value, msg string) {
+	e.Violations = append(e.Violations,
+		Violation{Field: field, Value: value, Message: msg})
+}
+
+// OrNil returns the error if violations were recorded, nil otherwise.
+func (e *ValidationError) OrNil() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		m := v.Field + " " + v.Message
+		if v.Value != "" {
+			m = v.Field + " '" + v.Value + "' " + v.Message
+		}
+		msgs = append(msgs, m)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrIdempotencyKeyInUse is returned while the request that first
+	// used an idempotency key is still being processed.
+	ErrIdempotencyKeyInUse = errors.New(
+		"a request with this idempotency key is still being processed")
+	// ErrIdempotencyKeyReused is returned when an idempotency key is
+	// used again for a request with a different payload.
+	ErrIdempotencyKeyReused = errors.New(
+		"the idempotency key was already used for a different request")
+)
+
+// IdempotencyRecord holds the outcome of a request made with an
+// idempotency key so that retries can be answered with it.
+type IdempotencyRecord struct {
+	OwnerID string
+	Key     string
+	// Fingerprint identifies the request the key was first used with
+	Fingerprint string
+	// Status is the response status code. It is zero while the request
+	// is still being processed.
+	Status int
+	Header map[string][]string
+	Body   []byte
+	// ExpiresAt is when the record may be discarded. While a request is
+	// being processed it bounds how long a crashed request blocks
+	// retries.
+	ExpiresAt time.Time
+}
+
+// Completed reports whether the response has been recorded.
+func (r IdempotencyRecord) Completed() bool {
+	return r.Status != 0
+}
+
+// IdempotencyRepository stores idempotency records per owner and key.
+// Expired records are treated as absent.
+type IdempotencyRepository interface {
+	// ReserveIdempotencyKey stores rec if its owner has no unexpired
+	// record for the key, and returns nil. Otherwise it returns the
+	// existing record and leaves it unchanged.
+	ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord,
+		now time.Time) (*IdempotencyRecord, error)
+	// CompleteIdempotencyKey replaces a reserved record with one that
+	// holds the response.
+	CompleteIdempotencyKey(ctx context.Context, rec IdempotencyRecord) error
+	// ExtendIdempotencyKey moves the expiry of a reserved record that is
+	// not completed yet to rec.ExpiresAt, so that it outlives a request
+	// that is still being processed.
+	ExtendIdempotencyKey(ctx context.Context, rec IdempotencyRecord) error
+	// ReleaseIdempotencyKey removes a record so that the request can be
+	// retried.
+	ReleaseIdempotencyKey(ctx context.Context, ownerID, key string) error
+	// DeleteExpiredIdempotencyKeys removes the records expired at now.
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) error
+}
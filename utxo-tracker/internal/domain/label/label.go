@@ -0,0 +1,223 @@
+// Package label reads and writes wallet labels in the BIP329 JSON Lines
+// format. Records of types this package does not know, and fields it
+// does not interpret, are kept so that labels round-trip unchanged.
+package label
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// Type is the kind of object a label refers to.
+type Type string
+
+const (
+	Tx     Type = "tx"
+	Addr   Type = "addr"
+	Pubkey Type = "pubkey"
+	Input  Type = "input"
+	Output Type = "output"
+	Xpub   Type = "xpub"
+)
+
+// MaxLength is the longest label BIP329 asks importers to accept.
+const MaxLength = 255
+
+// Label is a single BIP329 record.
+type Label struct {
+	Type  Type
+	Ref   string
+	Label string
+	// Extra holds every other field of the record, such as origin or
+	// spendable, as raw JSON.
+	Extra map[string]json.RawMessage
+}
+
+// New returns a label without extra fields.
+func New(t Type, ref, text string) Label {
+	return Label{Type: t, Ref: ref, Label: text}
+}
+
+// Validate checks the fields BIP329 defines for the label type. Labels
+// of unknown types only need a type and a reference.
+func (l Label) Validate() error {
+	if l.Type == "" {
+		return errors.New("has no type")
+	}
+	if l.Ref == "" {
+		return errors.New("has no ref")
+	}
+	if utf8.RuneCountInString(l.Label) > MaxLength {
+		return fmt.Errorf("is longer than %d characters", MaxLength)
+	}
+	switch l.Type {
+	case Tx:
+		if !isTxID(l.Ref) {
+			return fmt.Errorf("ref '%s' is not a transaction ID", l.Ref)
+		}
+	case Input, Output:
+		txid, vout, ok := strings.Cut(l.Ref, ":")
+		if _, err := strconv.ParseUint(vout, 10, 32); !ok || err != nil ||
+			!isTxID(txid) {
+			return fmt.Errorf("ref '%s' is not an outpoint", l.Ref)
+		}
+	case Addr:
+		if _, err := address.ParseAny(l.Ref); err != nil {
+			return fmt.Errorf("ref '%s' %s", l.Ref, err)
+		}
+	}
+	return nil
+}
+
+func isTxID(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 32
+}
+
+// Key identifies the object a label is attached to.
+func (l Label) Key() string {
+	return string(l.Type) + " " + l.Ref
+}
+
+// MarshalJSON writes the label as a BIP329 record. The type, ref and
+// label come first, as in the BIP329 examples, followed by the extra
+// fields in key order.
+func (l Label) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	field := func(k string, v any) error {
+		if b.Len() == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		kv, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		vv, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(kv)
+		b.WriteByte(':')
+		b.Write(vv)
+		return nil
+	}
+	_ = field("type", l.Type)
+	_ = field("ref", l.Ref)
+	if l.Label != "" {
+		_ = field("label", l.Label)
+	}
+	for _, k := range slices.Sorted(maps.Keys(l.Extra)) {
+		if err := field(k, l.Extra[k]); err != nil {
+			return nil, err
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// UnmarshalJSON reads a BIP329 record.
+func (l *Label) UnmarshalJSON(b []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	var out Label
+	for k, dst := range map[string]any{
+		"type": &out.Type, "ref": &out.Ref, "label": &out.Label,
+	} {
+		if v, ok := m[k]; ok {
+			if err := json.Unmarshal(v, dst); err != nil {
+				return fmt.Errorf("field %s: %w", k, err)
+			}
+			delete(m, k)
+		}
+	}
+	if len(m) > 0 {
+		out.Extra = m
+	}
+	if out.Type == Addr {
+		// Bech32 addresses may be written in upper case
+		if a, err := address.ParseAny(out.Ref); err == nil {
+			out.Ref = a.Encoded
+		}
+	}
+	*l = out
+	return nil
+}
+
+// LineError reports an invalid record.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Read parses BIP329 records from r. Blank lines are skipped and when a
+// type and ref occur more than once the last record wins, as BIP329
+// asks. All invalid lines are reported, joined into one error.
+func Read(r io.Reader, maxLineBytes int) ([]Label, error) {
+	var (
+		out  []Label
+		errs []error
+		idx  = make(map[string]int)
+	)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxLineBytes)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var l Label
+		err := json.Unmarshal(line, &l)
+		if err == nil {
+			err = l.Validate()
+		}
+		if err != nil {
+			errs = append(errs, &LineError{Line: n, Err: err})
+			continue
+		}
+		if i, ok := idx[l.Key()]; ok {
+			out[i] = l
+			continue
+		}
+		idx[l.Key()] = len(out)
+		out = append(out, l)
+	}
+	if err := sc.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return out, errors.Join(errs...)
+}
+
+// Write writes the labels as BIP329 records, one per line.
+func Write(w io.Writer, ls []Label) error {
+	enc := json.NewEncoder(w)
+	for _, l := range ls {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package label
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The example export of BIP329, followed by a record of a type the BIP
+// does not define.
+const export = `{"type":"tx","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd","label":"Transaction","origin":"wpkh([d34db33f/84'/0'/0'])"}
+{"type":"addr","ref":"bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c","label":"Address"}
+{"type":"pubkey","ref":"0283409659355b6d1cc3c32decd5d561abaac86c37a353b52895a5e6c196d6f448","label":"Public Key"}
+{"type":"input","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd:0","label":"Input"}
+{"type":"output","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd:1","label":"Output","spendable":false}
+{"type":"xpub","ref":"xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8","label":"Extended Public Key"}
+{"type":"tx","ref":"f546156d9044844e02b181026a1a407abfca62e7ea1159f87bbeaa77b4286c74","label":"Account #1 Transaction","origin":"wpkh([d34db33f/84'/0'/1'])"}
+{"type":"psbt","ref":"cHNidP8BAHUCAAAAAQ","label":"Draft","height":840000}
+`
+
+func TestRoundTrip(t *testing.T) {
+	ls, err := Read(strings.NewReader(export), 1<<16)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	var types []Type
+	for _, l := range ls {
+		types = append(types, l.Type)
+	}
+	want := []Type{Tx, Addr, Pubkey, Input, Output, Xpub, Tx, "psbt"}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("types = %v, want %v", types, want)
+	}
+	if o := string(ls[0].Extra["origin"]); o != `"wpkh([d34db33f/84'/0'/0'])"` {
+		t.Errorf("origin = %s", o)
+	}
+	if s := string(ls[4].Extra["spendable"]); s != "false" {
+		t.Errorf("spendable = %s", s)
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, ls); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	in := strings.Split(strings.TrimSuffix(export, "\n"), "\n")
+	if len(got) != len(in) {
+		t.Fatalf("Write wrote %d lines, want %d", len(got), len(in))
+	}
+	for i := range in {
+		var g, w map[string]any
+		if err := json.Unmarshal([]byte(got[i]), &g); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if err := json.Unmarshal([]byte(in[i]), &w); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("line %d = %s, want %s", i+1, got[i], in[i])
+		}
+	}
+}
+
+func TestReadDuplicates(t *testing.T) {
+	const in = `{"type":"addr","ref":"BC1Q34AQ5DRPUWY3WGL9LHUP9892QP6SVR8LDZYY7C","label":"First"}
+
+{"type":"addr","ref":"bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c","label":"Second"}
+`
+	ls, err := Read(strings.NewReader(in), 1<<16)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	want := []Label{New(Addr, "bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c",
+		"Second")}
+	if !reflect.DeepEqual(ls, want) {
+		t.Errorf("Read = %+v, want %+v", ls, want)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	const txid = "f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd"
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"not JSON", `{"type":"tx",`},
+		{"not an object", `["tx"]`},
+		{"no type", `{"ref":"` + txid + `","label":"x"}`},
+		{"no ref", `{"type":"tx","label":"x"}`},
+		{"type of another kind", `{"type":1,"ref":"` + txid + `"}`},
+		{"short txid", `{"type":"tx","ref":"f91d0a8a"}`},
+		{"outpoint without index", `{"type":"output","ref":"` + txid + `"}`},
+		{"outpoint index out of range",
+			`{"type":"input","ref":"` + txid + `:4294967296"}`},
+		{"bad address", `{"type":"addr",` +
+			`"ref":"bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7d"}`},
+		{"label too long", `{"type":"tx","ref":"` + txid + `","label":"` +
+			strings.Repeat("é", MaxLength+1) + `"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := `{"type":"tx","ref":"` + txid + `"}` + "\n" + tt.line
+			ls, err := Read(strings.NewReader(in), 1<<16)
+			var le *LineError
+			if !errors.As(err, &le) || le.Line != 2 {
+				t.Fatalf("Read = %v, want an error on line 2", err)
+			}
+			if len(ls) != 1 {
+				t.Errorf("Read returned %d labels, want the valid one",
+					len(ls))
+			}
+		})
+	}
+}
+
+func TestReadLineTooLong(t *testing.T) {
+	line := `{"type":"tx","ref":"` + strings.Repeat("0", 64) + `"}`
+	if _, err := Read(strings.NewReader(line), 32); err == nil {
+		t.Error("Read accepted a line longer than the limit")
+	}
+}
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// AddressMatch is an account that holds a looked up address.
+type AddressMatch struct {
+	Address string
+	Account Account
+	// Index is the position of the address in the account's list
+	Index int
+	// DerivationPath is the BIP32 path the address was derived at. It is
+	// empty for addresses that were added to the account directly.
+	DerivationPath string
+}
+
+// TrackedAddressError is returned when a new account holds addresses
+// that the owner already tracks in other accounts and the caller asked
+// for that to be rejected.
+type TrackedAddressError struct {
+	Matches []AddressMatch
+}
+
+// Violations describes every tracked address.
+func (e *TrackedAddressError) Violations() []Violation {
+	vs := make([]Violation, 0, len(e.Matches))
+	for _, m := range e.Matches {
+		vs = append(vs, Violation{
+			Field: "addresses",
+			Value: m.Address,
+			Message: fmt.Sprintf("is already tracked in account '%s' (%s)",
+				m.Account.Name, m.Account.ID),
+		})
+	}
+	return vs
+}
+
+func (e *TrackedAddressError) Error() string {
+	addrs := make([]string, 0, len(e.Matches))
+	for _, m := range e.Matches {
+		addrs = append(addrs, m.Address)
+	}
+	return "addresses already tracked in other accounts: " +
+		strings.Join(slices.Compact(addrs), ", ")
+}
+
+// CheckUntracked returns a *TrackedAddressError if any address of the
+// account is held by another account in matches.
+func CheckUntracked(a Account, matches []AddressMatch) error {
+	var others []AddressMatch
+	for _, m := range matches {
+		if m.Account.ID != a.ID {
+			others = append(others, m)
+		}
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	return &TrackedAddressError{Matches: others}
+}
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Role is what a user may do with an account.
+type Role string
+
+const (
+	// RoleOwner may do everything, including deleting and sharing the
+	// account. Every account has exactly one owner, its creator.
+	RoleOwner Role = "owner"
+	// RoleEditor may read the account and change its addresses, tags and
+	// labels.
+	RoleEditor Role = "editor"
+	// RoleViewer may only read the account.
+	RoleViewer Role = "viewer"
+)
+
+// roleRank orders the roles by what they permit.
+var roleRank = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// Allows reports whether the role permits everything need permits.
+func (r Role) Allows(need Role) bool {
+	return roleRank[r] > 0 && roleRank[r] >= roleRank[need]
+}
+
+var (
+	// ErrPermissionDenied is returned when the role of a user on an
+	// account does not permit a change.
+	ErrPermissionDenied = errors.New(
+		"your role on the account does not permit this")
+	// ErrMemberNotFound is returned when a user is neither a member of
+	// nor invited to an account.
+	ErrMemberNotFound = errors.New("member not found")
+	// ErrDuplicateMember is returned when a user already is a member of
+	// or invited to an account.
+	ErrDuplicateMember = errors.New(
+		"user is already a member of or invited to the account")
+)
+
+// Member is a user an account is shared with. Sharing starts with an
+// invitation, which the user accepts to become an active member.
+type Member struct {
+	AccountID string
+	UserID    string
+	Role      Role
+	InvitedBy string
+	InvitedAt time.Time
+	// AcceptedAt is nil while the invitation is pending
+	AcceptedAt *time.Time
+}
+
+// NewInvitation validates the given input and returns the pending
+// membership of a user invited to the account.
+func NewInvitation(a Account, userID string, role Role, now time.Time,
+) (Member, error) {
+	m := Member{
+		AccountID: a.ID,
+		UserID:    strings.TrimSpace(userID),
+		Role:      role,
+		InvitedBy: a.OwnerID,
+		InvitedAt: timestamp(now),
+	}
+	var v ValidationError
+	switch m.UserID {
+	case "":
+		v.Add("userId", "", "must not be empty")
+	case a.OwnerID:
+		v.Add("userId", m.UserID, "is the owner of the account")
+	}
+	if role != RoleEditor && role != RoleViewer {
+		v.Add("role", string(role), "must be editor or viewer")
+	}
+	if err := v.OrNil(); err != nil {
+		return Member{}, err
+	}
+	return m, nil
+}
+
+// Accept returns a copy of the membership accepted at now.
+func (m Member) Accept(now time.Time) Member {
+	t := timestamp(now)
+	m.AcceptedAt = &t
+	return m
+}
+
+// Pending reports whether the member has yet to accept the invitation.
+func (m Member) Pending() bool {
+	return m.AcceptedAt == nil
+}
+
+// MemberRepository persists the members of accounts. Purging an account
+// removes its members. Implementations must be safe for concurrent use.
+// Like the changes to accounts, every change to their members is stored
+// along with the AuditEntry recording it.
+type MemberRepository interface {
+	// AddMember stores an invitation. It returns ErrDuplicateMember if
+	// the user already is a member or invited and ErrAccountNotFound if
+	// the account does not exist.
+	AddMember(ctx context.Context, m Member, e AuditEntry) error
+	// AcceptInvitation stores the acceptance of an invitation. It
+	// returns ErrMemberNotFound if the invitation is no longer pending.
+	AcceptInvitation(ctx context.Context, m Member, e AuditEntry) error
+	// RemoveMember removes a member or invitation. It returns
+	// ErrMemberNotFound if there is none.
+	RemoveMember(ctx context.Context, accountID, userID string,
+		e AuditEntry) error
+	// ListMembers returns the members and invitations of an account in
+	// the order they were invited.
+	ListMembers(ctx context.Context, accountID string) ([]Member, error)
+	// ListMemberships returns the memberships and invitations of a user
+	// in the order they were invited.
+	ListMemberships(ctx context.Context, userID string) ([]Member, error)
+	// GetSharedAccount returns an account the user is an active member
+	// of along with their role. It returns ErrAccountNotFound otherwise.
+	GetSharedAccount(ctx context.Context, userID, accountID string,
+	) (Account, Role, error)
+}
@@ -0,0 +1,180 @@
+package domain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/descriptor"
+)
+
+// MultisigScript is how the addresses of a multisig script pay to it.
+type MultisigScript string
+
+const (
+	MultisigP2WSH     MultisigScript = "p2wsh"
+	MultisigP2SHP2WSH MultisigScript = "p2sh-p2wsh"
+	MultisigP2SH      MultisigScript = "p2sh"
+)
+
+// MultisigScripts lists the supported multisig scripts.
+var MultisigScripts = []MultisigScript{
+	MultisigP2WSH, MultisigP2SHP2WSH, MultisigP2SH}
+
+// Multisig describes the multisig script of a descriptor.
+type Multisig struct {
+	// Threshold is the number of cosigners needed to spend
+	Threshold int
+	// Cosigners are the keys in the order of the descriptor
+	Cosigners []Cosigner
+	Script    MultisigScript
+	// Sorted is set for sortedmulti
+	Sorted bool
+}
+
+// Cosigner is a key of a multisig script.
+type Cosigner struct {
+	// Fingerprint is the hex fingerprint of the key's origin, or of the
+	// key itself if the descriptor gives no origin.
+	Fingerprint string
+	// Path is the derivation path of the key's origin, if given
+	Path string
+	// Key is the extended or hex public key
+	Key string
+}
+
+// MultisigSpec describes a multisig account by its keys.
+type MultisigSpec struct {
+	Threshold int
+	// Keys are extended public keys at the account level, each optionally
+	// preceded by its key origin as in descriptors.
+	Keys []string
+	// Script defaults to the one the SLIP-0132 version of the keys
+	// stands for, or MultisigP2WSH.
+	Script MultisigScript
+	// Range is the range of DescriptorSpec
+	Range []int
+}
+
+// multisigDescriptor validates spec and returns the sortedmulti
+// descriptor of its keys with receive and change paths.
+func multisigDescriptor(v *ValidationError, c address.Chain,
+	spec MultisigSpec) DescriptorSpec {
+	var bad bool
+	add := func(field, value, msg string) {
+		v.Add("multisig."+field, value, msg)
+		bad = true
+	}
+	script := spec.Script
+	if script != "" && !slices.Contains(MultisigScripts, script) {
+		add("script", string(script), "is not a known multisig script")
+	}
+	limit := descriptor.MaxMultiKeys
+	if script == MultisigP2SH {
+		limit = descriptor.MaxSHMultiKeys
+	}
+	n := len(spec.Keys)
+	if n == 0 || n > limit {
+		add("keys", "", fmt.Sprintf("must hold 1 to %d keys", limit))
+	}
+	if spec.Threshold < 1 || spec.Threshold > max(n, 1) {
+		add("threshold", fmt.Sprint(spec.Threshold), fmt.Sprintf(
+			"must be between 1 and the number of keys, %d", n))
+	}
+	keys := make([]string, 0, n)
+	for _, s := range spec.Keys {
+		s = strings.TrimSpace(s)
+		k, err := descriptor.ParseKey(c, s)
+		switch {
+		case errors.Is(err, address.ErrPrivateKey):
+			add("keys", "", err.Error())
+			continue
+		case err != nil:
+			add("keys", s, err.Error())
+			continue
+		case k.Extended == nil:
+			add("keys", s, "is not an extended public key")
+			continue
+		case len(k.Steps) > 0 || k.Wildcard:
+			add("keys", s, "has derivation steps, expected an "+
+				"account level key")
+			continue
+		case slices.Contains(keys, k.String()):
+			add("keys", s, "is listed more than once")
+			continue
+		}
+		if ks := keyScript(*k.Extended); ks != "" {
+			if script == "" {
+				script = ks
+			}
+			if ks != script {
+				add("keys", s, fmt.Sprintf(
+					"is a %s key, but the script is %s", ks, script))
+			}
+		}
+		keys = append(keys, k.String())
+	}
+	if bad {
+		return DescriptorSpec{}
+	}
+	if script == "" {
+		script = MultisigP2WSH
+	}
+	d := fmt.Sprintf("sortedmulti(%d,%s/<0;1>/*)", spec.Threshold,
+		strings.Join(keys, "/<0;1>/*,"))
+	switch script {
+	case MultisigP2WSH:
+		d = "wsh(" + d + ")"
+	case MultisigP2SHP2WSH:
+		d = "sh(wsh(" + d + "))"
+	case MultisigP2SH:
+		d = "sh(" + d + ")"
+	}
+	return DescriptorSpec{Descriptor: d, Range: spec.Range}
+}
+
+// keyScript returns the script the SLIP-0132 version of k stands for,
+// if it is one of the multisig versions.
+func keyScript(k address.ExtendedKey) MultisigScript {
+	switch {
+	case !k.Multisig:
+		return ""
+	case k.Purpose == address.BIP49:
+		return MultisigP2SHP2WSH
+	}
+	return MultisigP2WSH
+}
+
+// multisigOf returns the multisig script of d, or nil if it has none.
+func multisigOf(d descriptor.Descriptor) *Multisig {
+	m, ok := d.Multi()
+	if !ok {
+		return nil
+	}
+	ms := &Multisig{
+		Threshold: m.Threshold,
+		Cosigners: make([]Cosigner, 0, len(m.Keys)),
+		Script:    MultisigP2SH,
+		Sorted:    m.Sorted,
+	}
+	switch s := d.Script.(type) {
+	case descriptor.WSH:
+		ms.Script = MultisigP2WSH
+	case descriptor.SH:
+		if _, ok := s.Script.(descriptor.WSH); ok {
+			ms.Script = MultisigP2SHP2WSH
+		}
+	}
+	for _, k := range m.Keys {
+		fp := k.Fingerprint()
+		ms.Cosigners = append(ms.Cosigners, Cosigner{
+			Fingerprint: hex.EncodeToString(fp[:]),
+			Path:        k.OriginPath(),
+			Key:         k.Encoded(),
+		})
+	}
+	return ms
+}
@@ -0,0 +1,228 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// Limits applied when validating portfolio input.
+const (
+	MaxPortfolioNameLength = 100
+	MaxPortfolioAccounts   = 100
+)
+
+var (
+	// ErrPortfolioNotFound is returned when a portfolio does not exist or
+	// is not visible to the requesting user.
+	ErrPortfolioNotFound = errors.New("portfolio not found")
+	// ErrDuplicatePortfolio is returned when the owner already has a
+	// portfolio with the same name.
+	ErrDuplicatePortfolio = errors.New("portfolio already exists")
+	// ErrUnknownMember is returned when a portfolio refers to an account
+	// the owner does not have.
+	ErrUnknownMember = errors.New(
+		"portfolio refers to an account that does not exist")
+)
+
+// Portfolio is a named group of accounts of the same owner.
+type Portfolio struct {
+	ID      string
+	OwnerID string
+	Name    string
+	// AccountIDs lists the member accounts in the order they were given.
+	// Deleting an account removes it from every portfolio.
+	AccountIDs []string
+	Version    int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// PortfolioSpec holds the user editable fields of a portfolio.
+type PortfolioSpec struct {
+	Name       string
+	AccountIDs []string
+}
+
+// NewPortfolio validates the given input and returns a new Portfolio
+// owned by the given user.
+func NewPortfolio(ownerID string, spec PortfolioSpec, now time.Time,
+) (Portfolio, error) {
+	now = timestamp(now)
+	p := Portfolio{
+		ID:        NewID(),
+		OwnerID:   ownerID,
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return p.apply(spec)
+}
+
+// Update returns a copy of the portfolio with the given fields and the
+// next version.
+func (p Portfolio) Update(spec PortfolioSpec, now time.Time,
+) (Portfolio, error) {
+	p.Version++
+	p.UpdatedAt = timestamp(now)
+	return p.apply(spec)
+}
+
+func (p Portfolio) apply(spec PortfolioSpec) (Portfolio, error) {
+	p.Name = strings.TrimSpace(spec.Name)
+	p.AccountIDs = make([]string, 0, len(spec.AccountIDs))
+	for _, id := range spec.AccountIDs {
+		p.AccountIDs = append(p.AccountIDs, strings.TrimSpace(id))
+	}
+	if err := p.Validate(); err != nil {
+		return Portfolio{}, err
+	}
+	return p, nil
+}
+
+// Validate checks the portfolio invariants.
+func (p Portfolio) Validate() error {
+	var v ValidationError
+	if strings.TrimSpace(p.OwnerID) == "" {
+		v.Add("ownerId", "", "must not be empty")
+	}
+	switch n := utf8.RuneCountInString(p.Name); {
+	case n == 0:
+		v.Add("name", p.Name, "must not be empty")
+	case n > MaxPortfolioNameLength:
+		v.Add("name", p.Name, fmt.Sprintf(
+			"must not be longer than %d characters",
+			MaxPortfolioNameLength))
+	}
+	if len(p.AccountIDs) > MaxPortfolioAccounts {
+		v.Add("accountIds", "", fmt.Sprintf(
+			"must not hold more than %d accounts", MaxPortfolioAccounts))
+	}
+	for i, id := range p.AccountIDs {
+		switch {
+		case id == "":
+			v.Add("accountIds", id, "must not be empty")
+		case slices.Index(p.AccountIDs, id) != i:
+			v.Add("accountIds", id, "is listed more than once")
+		}
+	}
+	return v.OrNil()
+}
+
+// RemoveAccount returns a copy of the portfolio without the account and
+// reports whether it was a member.
+func (p Portfolio) RemoveAccount(id string) (Portfolio, bool) {
+	i := slices.Index(p.AccountIDs, id)
+	if i < 0 {
+		return p, false
+	}
+	p.AccountIDs = slices.Delete(slices.Clone(p.AccountIDs), i, i+1)
+	p.Version++
+	return p, true
+}
+
+// PortfolioRepository persists portfolios. Implementations must be safe
+// for concurrent use, scope every lookup to the owning user and remove
+// deleted accounts from the portfolios holding them.
+type PortfolioRepository interface {
+	// CreatePortfolio stores a new portfolio. It returns
+	// ErrDuplicatePortfolio when the owner's portfolio name is taken and
+	// ErrUnknownMember when a member is not an account of the owner.
+	CreatePortfolio(ctx context.Context, p Portfolio) error
+	// GetPortfolio returns ErrPortfolioNotFound if the owner has no
+	// portfolio with the given ID.
+	GetPortfolio(ctx context.Context, ownerID, id string) (Portfolio, error)
+	// ListPortfolios returns the owner's portfolios by creation.
+	ListPortfolios(ctx context.Context, ownerID string) ([]Portfolio, error)
+	// UpdatePortfolio replaces the stored portfolio if its stored
+	// version still equals version, and returns ErrVersionMismatch
+	// otherwise.
+	UpdatePortfolio(ctx context.Context, p Portfolio, version int64) error
+	// DeletePortfolio removes the portfolio if its stored version still
+	// equals version, and returns ErrVersionMismatch otherwise.
+	DeletePortfolio(ctx context.Context, ownerID, id string,
+		version int64) error
+}
+
+// AddressBalance is the on-chain state of an address in satoshis.
+type AddressBalance struct {
+	Confirmed   int64
+	Unconfirmed int64
+	// UTXOs counts the unspent outputs, including unconfirmed ones
+	UTXOs int
+	// Used reports whether the address ever received an output
+	Used bool
+}
+
+var (
+	// ErrNoChainSource is returned by a ChainSource that cannot serve
+	// the requested network.
+	ErrNoChainSource = errors.New("no chain source for the network")
+	// ErrChainUnavailable is returned when a ChainSource failed to
+	// answer.
+	ErrChainUnavailable = errors.New("chain source is unavailable")
+)
+
+// ChainSource reads the state of addresses from the networks of the
+// supported chains.
+type ChainSource interface {
+	// AddressBalances returns the balance of every given address of
+	// network n of chain c.
+	AddressBalances(ctx context.Context, c address.Chain, n address.Network,
+		addrs []string) (map[string]AddressBalance, error)
+}
+
+// NetworkSummary aggregates the addresses of a portfolio on a network.
+type NetworkSummary struct {
+	Chain   address.Chain
+	Network address.Network
+	// Addresses lists each address once, however many member accounts
+	// hold it
+	Addresses []string
+	// Balance is the sum over Addresses. It is nil if there is no chain
+	// source for the network.
+	Balance *AddressBalance
+}
+
+// SummarizeAddresses groups the distinct addresses of the accounts by
+// chain and network, in registry order.
+func SummarizeAddresses(as []Account) []NetworkSummary {
+	var out []NetworkSummary
+	for _, p := range address.Registry() {
+		s := NetworkSummary{Chain: p.Chain, Network: p.Network}
+		seen := make(map[string]bool)
+		for _, a := range as {
+			if a.Chain != p.Chain || a.Network != p.Network {
+				continue
+			}
+			for _, addr := range a.Addresses {
+				if !seen[addr] {
+					seen[addr] = true
+					s.Addresses = append(s.Addresses, addr)
+				}
+			}
+		}
+		if len(s.Addresses) > 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// AddBalances sums the balances of the summary's addresses.
+func (s *NetworkSummary) AddBalances(bs map[string]AddressBalance) {
+	var total AddressBalance
+	for _, addr := range s.Addresses {
+		b := bs[addr]
+		total.Confirmed += b.Confirmed
+		total.Unconfirmed += b.Unconfirmed
+		total.UTXOs += b.UTXOs
+	}
+	s.Balance = &total
+}
@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// Page size limits for account listings.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 100
+)
+
+// AccountOrder is a field accounts can be sorted by. Ties are always
+// broken by account ID so that the order is stable.
+type AccountOrder string
+
+const (
+	OrderByCreated AccountOrder = "createdAt"
+	OrderByName    AccountOrder = "name"
+)
+
+// AccountPosition identifies where a listing stopped so that the next
+// page can continue after it.
+type AccountPosition struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// AccountQuery selects a page of the accounts a user can see.
+type AccountQuery struct {
+	// UserID selects the accounts the user owns or is an active member
+	// of
+	UserID string
+	// NamePrefix matches names starting with it, ignoring case
+	NamePrefix string
+	// Chain matches accounts of the chain when not empty
+	Chain address.Chain
+	// Network matches accounts of the network when not empty
+	Network address.Network
+	// HasAddress matches accounts holding the address when not empty
+	HasAddress string
+	OrderBy    AccountOrder
+	Descending bool
+	// After skips accounts up to and including this position
+	After *AccountPosition
+	// Limit is the maximum number of accounts to return
+	Limit int
+}
+
+// NewAccountQuery returns a query for the first page of the user's
+// accounts in creation order.
+func NewAccountQuery(userID string) AccountQuery {
+	return AccountQuery{
+		UserID:  userID,
+		OrderBy: OrderByCreated,
+		Limit:   DefaultPageSize,
+	}
+}
+
+// Validate checks the query parameters and puts the address filter in
+// its canonical form.
+func (q *AccountQuery) Validate() error {
+	var v ValidationError
+	if q.Limit < 1 || q.Limit > MaxPageSize {
+		v.Add("limit", fmt.Sprint(q.Limit), fmt.Sprintf(
+			"must be between 1 and %d", MaxPageSize))
+	}
+	if q.OrderBy != OrderByCreated && q.OrderBy != OrderByName {
+		v.Add("sort", string(q.OrderBy), "is not a sortable field")
+	}
+	if q.Chain != "" && !slices.Contains(address.Chains, q.Chain) {
+		v.Add("chain", string(q.Chain), "is not a known chain")
+	}
+	if q.Network != "" && !slices.Contains(address.Networks, q.Network) {
+		v.Add("network", string(q.Network), "is not a known network")
+	}
+	if q.HasAddress != "" {
+		parse := address.ParseAny
+		if q.Chain != "" {
+			parse = func(s string) (address.Address, error) {
+				return address.ParseOn(q.Chain, s)
+			}
+		}
+		a, err := parse(q.HasAddress)
+		if err != nil {
+			v.Add("has_address", q.HasAddress, err.Error())
+		} else {
+			q.HasAddress = a.Encoded
+		}
+	}
+	return v.OrNil()
+}
+
+// FoldName returns the form of an account name that name prefixes are
+// matched in, so that case is ignored alike by every repository.
+func FoldName(name string) string {
+	return strings.ToLower(name)
+}
+
+// Matches reports whether the account passes the query filters. It
+// leaves it to the caller to select the accounts of the user.
+func (q AccountQuery) Matches(a Account) bool {
+	if q.NamePrefix != "" && !strings.HasPrefix(
+		FoldName(a.Name), FoldName(q.NamePrefix)) {
+		return false
+	}
+	if q.Chain != "" && a.Chain != q.Chain {
+		return false
+	}
+	if q.Network != "" && a.Network != q.Network {
+		return false
+	}
+	if q.HasAddress != "" && !slices.Contains(a.Addresses, q.HasAddress) {
+		return false
+	}
+	return q.After == nil || q.Compare(q.After, a.Position()) < 0
+}
+
+// Compare orders two positions the way the query sorts them.
+func (q AccountQuery) Compare(a, b *AccountPosition) int {
+	var c int
+	if q.OrderBy == OrderByName {
+		c = strings.Compare(a.Name, b.Name)
+	} else {
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c == 0 {
+		c = strings.Compare(a.ID, b.ID)
+	}
+	if q.Descending {
+		return -c
+	}
+	return c
+}
+
+// Position returns the listing position of the account.
+func (a Account) Position() *AccountPosition {
+	return &AccountPosition{ID: a.ID, Name: a.Name, CreatedAt: a.CreatedAt}
+}
@@ -0,0 +1,174 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// Resources limited by a Quota.
+const (
+	QuotaAccounts          = "accounts"
+	QuotaAccountAddresses  = "addressesPerAccount"
+	QuotaAddresses         = "addresses"
+	QuotaRequestsPerMinute = "requestsPerMinute"
+)
+
+// Quota holds the limits that apply to every user. A zero limit means
+// unlimited.
+type Quota struct {
+	MaxAccounts int
+	// MaxAddressesPerAccount bounds the addresses of a single account
+	MaxAddressesPerAccount int
+	// MaxAddresses bounds the addresses summed over all accounts of a
+	// user
+	MaxAddresses      int
+	RequestsPerMinute int
+}
+
+// Usage is what a user currently holds.
+type Usage struct {
+	Accounts  int
+	Addresses int
+	// LargestAccount is the number of addresses of the account holding
+	// the most
+	LargestAccount int
+}
+
+// QuotaExceededError is returned when a change would take a user over a
+// quota limit.
+type QuotaExceededError struct {
+	// Resource is one of the Quota* constants
+	Resource string
+	Limit    int
+	// Used is the usage before the rejected change
+	Used int
+	// RetryAfter is set for rate limits and says when the limit resets
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s limit is %d, %d used",
+		e.Resource, e.Limit, e.Used)
+}
+
+// CheckAccount reports whether the owner may store account a given
+// their usage. The old version of the account is nil when it is being
+// created. Changes that do not grow the usage are always allowed, so
+// users above a lowered limit can still clean up.
+func (q Quota) CheckAccount(u Usage, old *Account, a Account) error {
+	var before int
+	if old != nil {
+		before = len(old.Addresses)
+	}
+	after := len(a.Addresses)
+	switch {
+	case old == nil && exceeds(q.MaxAccounts, u.Accounts+1):
+		return &QuotaExceededError{Resource: QuotaAccounts,
+			Limit: q.MaxAccounts, Used: u.Accounts}
+	case after > before && exceeds(q.MaxAddressesPerAccount, after):
+		return &QuotaExceededError{Resource: QuotaAccountAddresses,
+			Limit: q.MaxAddressesPerAccount, Used: before}
+	case after > before &&
+		exceeds(q.MaxAddresses, u.Addresses-before+after):
+		return &QuotaExceededError{Resource: QuotaAddresses,
+			Limit: q.MaxAddresses, Used: u.Addresses}
+	}
+	return nil
+}
+
+// CheckRequests reports whether a user that made used requests in the
+// current minute, which ends in resetIn, may make another.
+func (q Quota) CheckRequests(used int, resetIn time.Duration) error {
+	if !exceeds(q.RequestsPerMinute, used+1) {
+		return nil
+	}
+	return &QuotaExceededError{Resource: QuotaRequestsPerMinute,
+		Limit: q.RequestsPerMinute, Used: used, RetryAfter: resetIn}
+}
+
+func exceeds(limit, n int) bool {
+	return limit > 0 && n > limit
+}
+
+// QuotaEnforcer is an AccountRepository that rejects writes taking the
+// owner over the quota. Writes of the same owner are serialized within
+// the process, replicas may each let one concurrent write through.
+type QuotaEnforcer struct {
+	AccountRepository
+	quota Quota
+	seed  maphash.Seed
+	locks [64]sync.Mutex
+}
+
+// NewQuotaEnforcer wraps repo to enforce q.
+func NewQuotaEnforcer(repo AccountRepository, q Quota) *QuotaEnforcer {
+	return &QuotaEnforcer{
+		AccountRepository: repo,
+		quota:             q,
+		seed:              maphash.MakeSeed(),
+	}
+}
+
+// Quota returns the enforced limits.
+func (e *QuotaEnforcer) Quota() Quota {
+	return e.quota
+}
+
+// CreateAccount implements AccountRepository.
+func (e *QuotaEnforcer) CreateAccount(ctx context.Context, a Account,
+	audit AuditEntry) error {
+	mu := e.lock(a.OwnerID)
+	defer mu.Unlock()
+	u, err := e.AccountUsage(ctx, a.OwnerID)
+	if err != nil {
+		return err
+	}
+	if err := e.quota.CheckAccount(u, nil, a); err != nil {
+		return err
+	}
+	return e.AccountRepository.CreateAccount(ctx, a, audit)
+}
+
+// UpdateAccount implements AccountRepository.
+func (e *QuotaEnforcer) UpdateAccount(ctx context.Context, a Account,
+	version int64, audit AuditEntry) error {
+	mu := e.lock(a.OwnerID)
+	defer mu.Unlock()
+	old, err := e.GetAccount(ctx, a.OwnerID, a.ID)
+	if err != nil {
+		return err
+	}
+	u, err := e.AccountUsage(ctx, a.OwnerID)
+	if err != nil {
+		return err
+	}
+	if err := e.quota.CheckAccount(u, &old, a); err != nil {
+		return err
+	}
+	return e.AccountRepository.UpdateAccount(ctx, a, version, audit)
+}
+
+// RestoreAccount implements AccountRepository. Restored accounts count
+// against the quota like new ones.
+func (e *QuotaEnforcer) RestoreAccount(ctx context.Context, a Account,
+	version int64, audit AuditEntry) error {
+	mu := e.lock(a.OwnerID)
+	defer mu.Unlock()
+	u, err := e.AccountUsage(ctx, a.OwnerID)
+	if err != nil {
+		return err
+	}
+	if err := e.quota.CheckAccount(u, nil, a); err != nil {
+		return err
+	}
+	return e.AccountRepository.RestoreAccount(ctx, a, version, audit)
+}
+
+func (e *QuotaEnforcer) lock(ownerID string) *sync.Mutex {
+	mu := &e.locks[maphash.String(e.seed, ownerID)%uint64(len(e.locks))]
+	mu.Lock()
+	return mu
+}
@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrErasureNotFound is returned when an erasure does not exist or was
+// requested by another user.
+var ErrErasureNotFound = errors.New("erasure not found")
+
+// UserData is everything stored for a user.
+type UserData struct {
+	// Accounts are the accounts the user owns, deleted ones included, in
+	// creation order
+	Accounts []Account
+	// Members are the members of those accounts
+	Members    []Member
+	Portfolios []Portfolio
+	// Memberships are the memberships and invitations of the user in
+	// accounts of other users
+	Memberships []Member
+	// Audit holds the audit chains of the accounts, including the ones
+	// of the accounts purged since
+	Audit []AuditEntry
+	// AuditHeads holds the heads of those chains
+	AuditHeads []AuditHead
+}
+
+// ErasedData counts the records removed when erasing the data of a user.
+type ErasedData struct {
+	Accounts        int
+	Portfolios      int
+	Memberships     int
+	IdempotencyKeys int
+	// AuditEntries counts the entries of accounts of other users from
+	// which the user was removed
+	AuditEntries int
+}
+
+// UserDataRepository reads and erases everything stored for a user.
+// Implementations must be safe for concurrent use.
+type UserDataRepository interface {
+	// ExportUserData returns the data of the user.
+	ExportUserData(ctx context.Context, userID string) (UserData, error)
+	// EraseUserData removes the data of the user, along with the audit
+	// chains, indexes and cached responses derived from it, and returns
+	// what was removed. Erasure records are kept. Erasing again removes
+	// what was stored in between.
+	EraseUserData(ctx context.Context, userID string) (ErasedData, error)
+}
+
+// ErasureStatus is the progress of an erasure.
+type ErasureStatus string
+
+const (
+	ErasurePending   ErasureStatus = "pending"
+	ErasureRunning   ErasureStatus = "running"
+	ErasureCompleted ErasureStatus = "completed"
+	ErasureFailed    ErasureStatus = "failed"
+)
+
+// Erasure tracks the request of a user to have their data erased. It is
+// kept after the data is gone as proof of the erasure.
+type Erasure struct {
+	ID          string
+	UserID      string
+	Status      ErasureStatus
+	RequestedAt time.Time
+	// StartedAt is set once the erasure runs
+	StartedAt *time.Time
+	// CompletedAt is set once the erasure completed or failed
+	CompletedAt *time.Time
+	// Erased is set once the erasure completed
+	Erased ErasedData
+}
+
+// NewErasure returns a pending erasure of the data of the user.
+func NewErasure(userID string, now time.Time) Erasure {
+	return Erasure{
+		ID:          NewID(),
+		UserID:      userID,
+		Status:      ErasurePending,
+		RequestedAt: timestamp(now),
+	}
+}
+
+// ErasureLease is how long an erasure may run before it is taken over,
+// as the process running it is assumed to have gone away.
+const ErasureLease = time.Hour
+
+// Start returns a copy of the erasure that runs from now.
+func (e Erasure) Start(now time.Time) Erasure {
+	t := timestamp(now)
+	e.Status = ErasureRunning
+	e.StartedAt = &t
+	return e
+}
+
+// Complete returns a copy of the erasure that completed at now after
+// removing d.
+func (e Erasure) Complete(d ErasedData, now time.Time) Erasure {
+	t := timestamp(now)
+	e.Status = ErasureCompleted
+	e.CompletedAt = &t
+	e.Erased = d
+	return e
+}
+
+// Fail returns a copy of the erasure that failed at now. Requesting
+// another erasure erases what is left.
+func (e Erasure) Fail(now time.Time) Erasure {
+	t := timestamp(now)
+	e.Status = ErasureFailed
+	e.CompletedAt = &t
+	return e
+}
+
+// ErasureRepository persists erasures. Implementations must be safe for
+// concurrent use.
+type ErasureRepository interface {
+	CreateErasure(ctx context.Context, e Erasure) error
+	// UpdateErasure stores the new state of an erasure.
+	UpdateErasure(ctx context.Context, e Erasure) error
+	// GetErasure returns ErrErasureNotFound if the user requested no
+	// erasure with the given ID.
+	GetErasure(ctx context.Context, userID, id string) (Erasure, error)
+	// ClaimErasure stores the started erasure e if it is still pending
+	// or was started before stale. It returns false if another process
+	// runs it or it is finished.
+	ClaimErasure(ctx context.Context, e Erasure, stale time.Time,
+	) (bool, error)
+	// ListUnfinishedErasures returns the pending and running erasures of
+	// all users.
+	ListUnfinishedErasures(ctx context.Context) ([]Erasure, error)
+}
+
+// RunErasure claims the erasure and erases the data of its user, unless
+// another process runs it, in which case it returns false. The erasure
+// is stored as completed or failed and returned along with the error it
+// failed with.
+func RunErasure(ctx context.Context, erasures ErasureRepository,
+	data UserDataRepository, e Erasure) (Erasure, bool, error) {
+	now := time.Now()
+	e = e.Start(now)
+	ok, err := erasures.ClaimErasure(ctx, e, now.Add(-ErasureLease))
+	if err != nil || !ok {
+		return e, false, err
+	}
+	d, err := data.EraseUserData(ctx, e.UserID)
+	if err != nil {
+		e = e.Fail(time.Now())
+	} else {
+		e = e.Complete(d, time.Now())
+	}
+	if serr := erasures.UpdateErasure(ctx, e); serr != nil {
+		err = errors.Join(err,
+			fmt.Errorf("failed to store erasure: %w", serr))
+	}
+	return e, true, err
+}
@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/label"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/wallet"
+)
+
+// NewWalletAccount returns a new account of chain c from the keys,
+// descriptors, labels and gap limit of a wallet file, see wallet.Read.
+// An empty chain is detected from the file, see wallet.DetectChain. The
+// account is named name, or after the wallet if name is empty.
+func NewWalletAccount(ownerID, name string, c address.Chain, file []byte,
+	now time.Time) (Account, error) {
+	var v ValidationError
+	if c == "" {
+		c = wallet.DetectChain(file)
+	}
+	if !slices.Contains(address.Chains, c) {
+		v.Add("chain", string(c), "is not a known chain")
+		return Account{}, &v
+	}
+	w, err := wallet.Read(c, file)
+	if err != nil {
+		v.Add("file", "", err.Error())
+		return Account{}, &v
+	}
+	if max(w.Receive, w.Change) > MaxDescriptorRange {
+		v.Add("file", "", fmt.Sprintf(
+			"has more than %d addresses on a branch", MaxDescriptorRange))
+		return Account{}, &v
+	}
+	spec := AccountSpec{
+		Name:      cmp.Or(strings.TrimSpace(name), w.Name),
+		Chain:     c,
+		Addresses: w.Addresses,
+	}
+	if w.Key != "" {
+		spec.Derivation = &DerivationSpec{
+			ExtendedKey: w.Key,
+			Purpose:     w.Purpose,
+			GapLimit:    w.GapLimit,
+		}
+	}
+	if m := w.Multisig; m != nil {
+		spec.Multisig = &MultisigSpec{
+			Threshold: m.Threshold,
+			Keys:      m.Keys,
+			Script:    MultisigScript(m.Script),
+		}
+		if n := max(w.GapLimit, w.Receive, w.Change); n > 0 {
+			spec.Multisig.Range = []int{0, n - 1}
+		}
+	}
+	for _, d := range w.Descriptors {
+		spec.Descriptors = append(spec.Descriptors, DescriptorSpec(d))
+	}
+	a, err := NewAccount(ownerID, spec, now)
+	if err != nil {
+		return Account{}, err
+	}
+	// Derive as far as the wallet did, so that its labels find their
+	// addresses
+	if d := a.Derivation; d != nil {
+		for branch, n := range []int{w.Receive, w.Change} {
+			err := d.derive(a.Chain, a.Network, uint32(branch), n)
+			if err != nil {
+				return Account{}, err
+			}
+		}
+		a.Addresses = a.withDerived(a.Addresses)
+	}
+	a.Labels = append(a.Labels, walletLabels(a, w)...)
+	return a, a.Validate()
+}
+
+// walletLabels returns the labels of w that refer to transactions or to
+// addresses of a. Labels of other addresses are left out.
+func walletLabels(a Account, w wallet.Wallet) []label.Label {
+	var out []label.Label
+	for _, l := range w.Labels {
+		if l.Type == label.Addr {
+			pa, err := address.ParseOn(a.Chain, l.Ref)
+			if err != nil || !slices.Contains(a.Addresses, pa.Encoded) {
+				continue
+			}
+			l.Ref = pa.Encoded
+		}
+		out = append(out, l)
+	}
+	// Path labels are of the addresses of the wallet's own key or
+	// multisig keys
+	var derived []DerivedAddress
+	switch {
+	case a.Derivation != nil:
+		derived = a.Derivation.Addresses
+	case w.Multisig != nil && len(a.Descriptors) == 1:
+		derived = a.Descriptors[0].Addresses
+	}
+	for _, da := range derived {
+		key := [2]uint32{da.Branch, da.Index}
+		if text, ok := w.PathLabels[key]; ok {
+			out = append(out, label.New(label.Addr, da.Address, text))
+		}
+	}
+	return out
+}
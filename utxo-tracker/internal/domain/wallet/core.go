@@ -0,0 +1,54 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// coreLookahead is the number of indexes past the next unused one that
+// ranged descriptors of Bitcoin Core are watched at.
+const coreLookahead = 20
+
+// coreFile is the output of Bitcoin Core's listdescriptors.
+type coreFile struct {
+	WalletName  string `json:"wallet_name"`
+	Descriptors []struct {
+		Desc  string `json:"desc"`
+		Range []int  `json:"range"`
+		// Next is the index of the next unused address. Releases
+		// before 28 only have next, later ones both.
+		Next      *int `json:"next"`
+		NextIndex *int `json:"next_index"`
+	} `json:"descriptors"`
+}
+
+// readCore reads the output of listdescriptors. Ranged descriptors are
+// watched from the start of their range to coreLookahead indexes past
+// the next unused one.
+func readCore(data []byte) (Wallet, error) {
+	var f coreFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Wallet{}, errors.New(
+			"is not valid Bitcoin Core listdescriptors output")
+	}
+	w := Wallet{Format: BitcoinCore, Name: f.WalletName}
+	for _, d := range f.Descriptors {
+		wd := Descriptor{Descriptor: d.Desc}
+		if len(d.Range) == 2 {
+			next := d.Range[0]
+			switch {
+			case d.NextIndex != nil:
+				next = max(next, *d.NextIndex)
+			case d.Next != nil:
+				next = max(next, *d.Next)
+			}
+			wd.Range = []int{d.Range[0],
+				min(d.Range[1], next+coreLookahead-1)}
+		}
+		w.Descriptors = append(w.Descriptors, wd)
+	}
+	if len(w.Descriptors) == 0 {
+		return Wallet{}, errors.New("has no descriptors")
+	}
+	return w, nil
+}
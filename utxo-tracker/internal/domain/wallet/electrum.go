@@ -0,0 +1,145 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/descriptor"
+)
+
+// electrumFile holds the fields of an Electrum wallet file read here.
+// Multisig wallets keep their keystores in fields x1/, x2/ and so on.
+type electrumFile struct {
+	WalletType string            `json:"wallet_type"`
+	Keystore   *electrumKeystore `json:"keystore"`
+	Addresses  json.RawMessage   `json:"addresses"`
+	Labels     map[string]string `json:"labels"`
+	GapLimit   int               `json:"gap_limit"`
+}
+
+type electrumKeystore struct {
+	Type            string          `json:"type"`
+	XPub            string          `json:"xpub"`
+	Derivation      string          `json:"derivation"`
+	RootFingerprint string          `json:"root_fingerprint"`
+	XPrv            json.RawMessage `json:"xprv"`
+	Seed            json.RawMessage `json:"seed"`
+	Passphrase      json.RawMessage `json:"passphrase"`
+	Keypairs        json.RawMessage `json:"keypairs"`
+}
+
+// private reports whether the keystore holds private key material,
+// encrypted or not.
+func (k electrumKeystore) private() bool {
+	return present(k.XPrv) || present(k.Seed) || present(k.Passphrase) ||
+		present(k.Keypairs)
+}
+
+// readElectrum reads an Electrum wallet file.
+func readElectrum(c address.Chain, data []byte) (Wallet, error) {
+	var f electrumFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Wallet{}, errors.New("is not a valid Electrum wallet file")
+	}
+	w := Wallet{Format: Electrum, GapLimit: f.GapLimit}
+	for _, ref := range slices.Sorted(maps.Keys(f.Labels)) {
+		w.addLabel(ref, f.Labels[ref])
+	}
+	switch m, n, multi := electrumQuorum(f.WalletType); {
+	case f.WalletType == "standard":
+		if f.Keystore == nil {
+			return Wallet{}, errors.New("has no keystore")
+		}
+		if f.Keystore.private() {
+			return Wallet{}, ErrPrivateKey
+		}
+		if f.Keystore.XPub == "" {
+			return Wallet{}, fmt.Errorf(
+				"has a keystore of type %s, which is not supported",
+				f.Keystore.Type)
+		}
+		w.Key = f.Keystore.XPub
+	case f.WalletType == "imported":
+		if f.Keystore != nil && f.Keystore.private() {
+			return Wallet{}, ErrPrivateKey
+		}
+		var addrs map[string]json.RawMessage
+		if err := json.Unmarshal(f.Addresses, &addrs); err != nil {
+			return Wallet{}, errors.New("has no imported addresses")
+		}
+		w.Addresses = slices.Sorted(maps.Keys(addrs))
+		return w, nil
+	case multi:
+		ks, err := electrumCosigners(data, n)
+		if err != nil {
+			return Wallet{}, err
+		}
+		w.Multisig = &Multisig{Threshold: m}
+		for _, k := range ks {
+			w.Multisig.Keys = append(w.Multisig.Keys,
+				origin(k.RootFingerprint, k.Derivation, k.XPub))
+		}
+		// Electrum pays plain xpub multisig keys to P2SH, the others'
+		// versions tell their script.
+		ek, err := address.ParseExtendedKey(c, ks[0].XPub)
+		if err == nil && !ek.Multisig {
+			w.Multisig.Script = "p2sh"
+		}
+	default:
+		return Wallet{}, fmt.Errorf(
+			"has wallet type %q, which is not supported", f.WalletType)
+	}
+	var addrs struct {
+		Receiving []string `json:"receiving"`
+		Change    []string `json:"change"`
+	}
+	if json.Unmarshal(f.Addresses, &addrs) == nil {
+		w.Receive, w.Change = len(addrs.Receiving), len(addrs.Change)
+	}
+	return w, nil
+}
+
+// electrumQuorum parses the wallet type of multisig wallets, such as
+// 2of3, into the threshold and the number of keys.
+func electrumQuorum(walletType string) (int, int, bool) {
+	ms, ns, ok := strings.Cut(walletType, "of")
+	m, err1 := strconv.Atoi(ms)
+	n, err2 := strconv.Atoi(ns)
+	if !ok || err1 != nil || err2 != nil || m < 1 || m > n ||
+		n > descriptor.MaxMultiKeys {
+		return 0, 0, false
+	}
+	return m, n, true
+}
+
+// electrumCosigners returns the keystores x1/ to xn/ of a multisig
+// wallet file.
+func electrumCosigners(data []byte, n int) ([]electrumKeystore, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	ks := make([]electrumKeystore, 0, n)
+	for i := 1; i <= n; i++ {
+		name := fmt.Sprintf("x%d/", i)
+		var k electrumKeystore
+		if err := json.Unmarshal(fields[name], &k); err != nil {
+			return nil, fmt.Errorf("has no keystore %s", name)
+		}
+		if k.private() {
+			return nil, ErrPrivateKey
+		}
+		if k.XPub == "" {
+			return nil, fmt.Errorf("has no extended public key in %s",
+				name)
+		}
+		ks = append(ks, k)
+	}
+	return ks, nil
+}
@@ -0,0 +1,169 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// sparrowFile holds the fields of a Sparrow wallet export read here.
+type sparrowFile struct {
+	Name          string `json:"name"`
+	PolicyType    string `json:"policyType"`
+	ScriptType    string `json:"scriptType"`
+	DefaultPolicy struct {
+		Miniscript struct {
+			Script string `json:"script"`
+		} `json:"miniscript"`
+	} `json:"defaultPolicy"`
+	Keystores    []sparrowKeystore `json:"keystores"`
+	GapLimit     int               `json:"gapLimit"`
+	PurposeNodes []sparrowNode     `json:"purposeNodes"`
+	Transactions map[string]struct {
+		Label string `json:"label"`
+	} `json:"transactions"`
+}
+
+type sparrowKeystore struct {
+	KeyDerivation struct {
+		MasterFingerprint string `json:"masterFingerprint"`
+		DerivationPath    string `json:"derivationPath"`
+	} `json:"keyDerivation"`
+	ExtendedPublicKey        string          `json:"extendedPublicKey"`
+	Seed                     json.RawMessage `json:"seed"`
+	MasterPrivateExtendedKey json.RawMessage `json:"masterPrivateExtendedKey"`
+	MasterPrivateKey         json.RawMessage `json:"masterPrivateKey"`
+}
+
+// sparrowNode is a node of the derivation tree of a wallet, such as
+// m/0 for the receive addresses and m/0/5 for one of them.
+type sparrowNode struct {
+	DerivationPath string        `json:"derivationPath"`
+	Label          string        `json:"label"`
+	Children       []sparrowNode `json:"children"`
+}
+
+// sparrowPurposes maps the script types of single key wallets to the
+// purpose of their key.
+var sparrowPurposes = map[string]address.Purpose{
+	"P2PKH":       address.BIP44,
+	"P2SH_P2WPKH": address.BIP49,
+	"P2WPKH":      address.BIP84,
+	"P2TR":        address.BIP86,
+}
+
+// sparrowScripts maps the script types of multisig wallets to their
+// multisig script.
+var sparrowScripts = map[string]string{
+	"P2SH":       "p2sh",
+	"P2SH_P2WSH": "p2sh-p2wsh",
+	"P2WSH":      "p2wsh",
+}
+
+// sparrowThreshold finds the threshold of a multisig policy, such as
+// sortedmulti(2,Keystore1,Keystore2,Keystore3).
+var sparrowThreshold = regexp.MustCompile(`multi\((\d+),`)
+
+// readSparrow reads a Sparrow wallet export.
+func readSparrow(data []byte) (Wallet, error) {
+	var f sparrowFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Wallet{}, errors.New("is not a valid Sparrow wallet file")
+	}
+	for _, k := range f.Keystores {
+		if present(k.Seed) || present(k.MasterPrivateExtendedKey) ||
+			present(k.MasterPrivateKey) {
+			return Wallet{}, ErrPrivateKey
+		}
+	}
+	w := Wallet{Format: Sparrow, Name: f.Name, GapLimit: f.GapLimit}
+	switch f.PolicyType {
+	case "SINGLE":
+		purpose, ok := sparrowPurposes[f.ScriptType]
+		if !ok || len(f.Keystores) != 1 {
+			return Wallet{}, fmt.Errorf("has a single key wallet of "+
+				"script type %q, which is not supported", f.ScriptType)
+		}
+		w.Key, w.Purpose = f.Keystores[0].ExtendedPublicKey, purpose
+	case "MULTI":
+		script, ok := sparrowScripts[f.ScriptType]
+		if !ok {
+			return Wallet{}, fmt.Errorf("has a multisig wallet of "+
+				"script type %q, which is not supported", f.ScriptType)
+		}
+		m := sparrowThreshold.FindStringSubmatch(
+			f.DefaultPolicy.Miniscript.Script)
+		if m == nil {
+			return Wallet{}, errors.New(
+				"has a multisig wallet without threshold")
+		}
+		threshold, _ := strconv.Atoi(m[1])
+		w.Multisig = &Multisig{Threshold: threshold, Script: script}
+		for _, k := range f.Keystores {
+			kd := k.KeyDerivation
+			w.Multisig.Keys = append(w.Multisig.Keys, origin(
+				kd.MasterFingerprint, kd.DerivationPath,
+				k.ExtendedPublicKey))
+		}
+	default:
+		return Wallet{}, fmt.Errorf(
+			"has policy type %q, which is not supported", f.PolicyType)
+	}
+	for _, n := range f.PurposeNodes {
+		branch, _, ok := sparrowPath(n.DerivationPath, 1)
+		if !ok {
+			continue
+		}
+		for _, child := range n.Children {
+			b, i, ok := sparrowPath(child.DerivationPath, 2)
+			if !ok || b != branch {
+				continue
+			}
+			// Children may leave out addresses, the count goes as far
+			// as the last one
+			switch branch {
+			case 0:
+				w.Receive = max(w.Receive, int(i)+1)
+			case 1:
+				w.Change = max(w.Change, int(i)+1)
+			}
+			text := truncate(child.Label)
+			if text == "" {
+				continue
+			}
+			if w.PathLabels == nil {
+				w.PathLabels = make(map[[2]uint32]string)
+			}
+			w.PathLabels[[2]uint32{b, i}] = text
+		}
+	}
+	for _, txid := range slices.Sorted(maps.Keys(f.Transactions)) {
+		w.addLabel(txid, f.Transactions[txid].Label)
+	}
+	return w, nil
+}
+
+// sparrowPath parses a node path of depth steps, m/0 or m/0/5, into its
+// branch and index.
+func sparrowPath(path string, depth int) (uint32, uint32, bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) != depth+1 || parts[0] != "m" {
+		return 0, 0, false
+	}
+	var out [2]uint32
+	for i, p := range parts[1:] {
+		v, err := strconv.ParseUint(p, 10, 31)
+		if err != nil {
+			return 0, 0, false
+		}
+		out[i] = uint32(v)
+	}
+	return out[0], out[1], true
+}
@@ -0,0 +1,267 @@
+// Package wallet reads the watch-only part of the files other wallets
+// export: Electrum wallet files, Sparrow wallet exports and the output
+// of Bitcoin Core's listdescriptors. Files holding private key material
+// are rejected without interpreting them further.
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/label"
+)
+
+// Format is the format of a wallet file.
+type Format string
+
+const (
+	Electrum    Format = "electrum"
+	Sparrow     Format = "sparrow"
+	BitcoinCore Format = "bitcoin-core"
+)
+
+var (
+	// ErrPrivateKey is returned for files holding private keys or seeds.
+	// It never tells where, so that no part of them is echoed.
+	ErrPrivateKey = errors.New(
+		"holds private key material, only watch-only wallets are accepted")
+	// ErrUnknownFormat is returned for files of no supported format
+	ErrUnknownFormat = errors.New(
+		"is not an Electrum, Sparrow or Bitcoin Core wallet file")
+)
+
+// Wallet is what a wallet file tells about a watch-only wallet. Single
+// key wallets set Key, multisig wallets Multisig and descriptor wallets
+// Descriptors. Wallets of imported addresses only have Addresses.
+type Wallet struct {
+	Format Format
+	// Name is the wallet's name, if the file tells it
+	Name string
+	// Key is the extended public key of single key wallets
+	Key string
+	// Purpose is the script type of Key, or zero if its version tells
+	Purpose address.Purpose
+	// Multisig is set for multisig wallets
+	Multisig *Multisig
+	// Descriptors are the output descriptors of descriptor wallets
+	Descriptors []Descriptor
+	// Addresses are imported addresses
+	Addresses []string
+	// GapLimit is the wallet's gap limit, or zero if the file does not
+	// tell it.
+	GapLimit int
+	// Receive and Change are the numbers of receive and change
+	// addresses the wallet derived from Key or Multisig.
+	Receive int
+	Change  int
+	// Labels are the labels of addresses and transactions
+	Labels []label.Label
+	// PathLabels are labels of derived addresses, keyed by branch and
+	// index.
+	PathLabels map[[2]uint32]string
+}
+
+// Multisig is a multisig wallet of account level keys.
+type Multisig struct {
+	Threshold int
+	// Keys are the cosigner keys, preceded by their key origin where
+	// the file tells it.
+	Keys []string
+	// Script is p2wsh, p2sh-p2wsh or p2sh, or empty if the versions of
+	// the keys tell it.
+	Script string
+}
+
+// Descriptor is an output descriptor of a descriptor wallet.
+type Descriptor struct {
+	Descriptor string
+	// Range holds the first and last index to watch of ranged
+	// descriptors.
+	Range []int
+}
+
+// Read reads a wallet file of chain c, detecting its format.
+func Read(c address.Chain, data []byte) (Wallet, error) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return Wallet{}, errors.New("is not valid JSON")
+	}
+	if hasPrivateKey(v) {
+		return Wallet{}, ErrPrivateKey
+	}
+	top, ok := v.(map[string]any)
+	if !ok {
+		return Wallet{}, ErrUnknownFormat
+	}
+	switch {
+	case top["descriptors"] != nil:
+		return readCore(data)
+	case top["wallet_type"] != nil || top["seed_version"] != nil:
+		return readElectrum(c, data)
+	case top["keystores"] != nil && top["policyType"] != nil:
+		return readSparrow(data)
+	}
+	return Wallet{}, ErrUnknownFormat
+}
+
+// hasPrivateKey reports whether any key or string of the JSON value v
+// holds a WIF private key or an extended private key of any chain.
+func hasPrivateKey(v any) bool {
+	switch v := v.(type) {
+	case string:
+		return isPrivate(v)
+	case []any:
+		for _, e := range v {
+			if hasPrivateKey(e) {
+				return true
+			}
+		}
+	case map[string]any:
+		for k, e := range v {
+			if isPrivate(k) || hasPrivateKey(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPrivate reports whether s holds a private key among its base58
+// words, such as the keys of a descriptor.
+func isPrivate(s string) bool {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !strings.ContainsRune(base58, r)
+	})
+	for _, w := range words {
+		if (len(w) == 51 || len(w) == 52) && address.IsWIF(w) {
+			return true
+		}
+		if len(w) != 111 {
+			continue
+		}
+		for _, c := range address.Chains {
+			_, err := address.ParseExtendedKey(c, w)
+			if errors.Is(err, address.ErrPrivateKey) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const base58 = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// present reports whether a field holds a value other than null or an
+// empty string, object or array.
+func present(raw json.RawMessage) bool {
+	switch string(bytes.TrimSpace(raw)) {
+	case "", "null", `""`, "{}", "[]":
+		return false
+	}
+	return true
+}
+
+// addLabel adds the label of an address or transaction to w. Refs that
+// are neither are skipped.
+func (w *Wallet) addLabel(ref, text string) {
+	text = truncate(text)
+	if text == "" {
+		return
+	}
+	t := label.Addr
+	if b, err := hex.DecodeString(ref); err == nil && len(b) == 32 {
+		t = label.Tx
+	} else if _, err := address.ParseAny(ref); err != nil {
+		return
+	}
+	w.Labels = append(w.Labels, label.New(t, ref, text))
+}
+
+// truncate trims a label and cuts it to the length BIP329 asks
+// importers to accept.
+func truncate(text string) string {
+	text = strings.TrimSpace(text)
+	if r := []rune(text); len(r) > label.MaxLength {
+		text = string(r[:label.MaxLength])
+	}
+	return text
+}
+
+// origin returns key preceded by the key origin of the fingerprint and
+// path, which may use ' or h for hardened steps. Without fingerprint
+// the key is returned alone.
+func origin(fingerprint, path, key string) string {
+	if fingerprint == "" {
+		return key
+	}
+	path = strings.TrimPrefix(strings.TrimSpace(path), "m")
+	return "[" + strings.ToLower(fingerprint) + path + "]" + key
+}
+
+// DetectChain returns the chain of the keys and addresses in a wallet
+// file. Keys and addresses that are valid on several chains, such as
+// xpubs, do not tell. Files without others are taken to be Bitcoin's.
+func DetectChain(data []byte) address.Chain {
+	var v any
+	if json.Unmarshal(data, &v) != nil {
+		return address.Bitcoin
+	}
+	found := make(map[address.Chain]bool)
+	walkStrings(v, func(s string) {
+		words := strings.FieldsFunc(s, func(r rune) bool {
+			return r != ':' && !('0' <= r && r <= '9' ||
+				'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+		})
+		for _, w := range words {
+			if c, ok := onlyChain(w); ok {
+				found[c] = true
+			}
+		}
+	})
+	for _, c := range address.Chains {
+		if found[c] {
+			return c
+		}
+	}
+	return address.Bitcoin
+}
+
+// onlyChain returns the chain w is an extended public key or address
+// of, if it is valid on one chain only.
+func onlyChain(w string) (address.Chain, bool) {
+	var chains []address.Chain
+	for _, c := range address.Chains {
+		_, kerr := address.ParseExtendedKey(c, w)
+		_, aerr := address.ParseOn(c, w)
+		if kerr == nil || aerr == nil {
+			chains = append(chains, c)
+		}
+	}
+	if len(chains) != 1 {
+		return "", false
+	}
+	return chains[0], true
+}
+
+// walkStrings calls fn with every key and string of the JSON value v.
+func walkStrings(v any, fn func(string)) {
+	switch v := v.(type) {
+	case string:
+		fn(v)
+	case []any:
+		for _, e := range v {
+			walkStrings(e, fn)
+		}
+	case map[string]any:
+		for k, e := range v {
+			fn(k)
+			walkStrings(e, fn)
+		}
+	}
+}
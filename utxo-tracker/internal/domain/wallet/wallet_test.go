@@ -0,0 +1,142 @@
+package wallet
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/label"
+)
+
+// The fixtures hold the BIP84 account of "abandon abandon … about" and
+// the master keys of the BIP32 test vectors. Their private keys are the
+// WIF and xprv of BIP381 and BIP32 vector 1.
+
+const (
+	zpub84 = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	xpub84 = "xpub6CatWdiZiodmUeTDp8LT5or8nmbKNcuyvz7WyksVFkKB4RHwCD3XyuvPEbvqAQY3rAPshWcMLoP2fMFMKHPJ4ZeZXYVUhLv1VMrjPC7PW6V"
+	xpub1  = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	xpub2  = "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB"
+	xpub3  = "xpub661MyMwAqRbcEZVB4dScxMAdx6d4nFc9nvyvH3v4gJL378CSRZiYmhRoP7mBy6gSPSCYk6SzXPTf3ND1cZAceL7SfJ1Z3GC8vBgp2epUt13"
+	txid   = "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		file string
+		want Wallet
+	}{
+		{"electrum-standard.json", Wallet{
+			Format: Electrum, Key: zpub84, GapLimit: 30,
+			Receive: 2, Change: 1,
+			Labels: []label.Label{
+				label.New(label.Addr,
+					"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "Salary"),
+				label.New(label.Tx, txid, "First payment"),
+			}}},
+		{"electrum-2of3.json", Wallet{
+			Format: Electrum, GapLimit: 20,
+			Multisig: &Multisig{Threshold: 2, Script: "p2sh", Keys: []string{
+				"[3442193e/45']" + xpub1,
+				"[bd16bee5/45']" + xpub2,
+				xpub3,
+			}}}},
+		{"electrum-imported.json", Wallet{
+			Format: Electrum,
+			Addresses: []string{
+				"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH",
+				"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+			}}},
+		{"sparrow-single.json", Wallet{
+			Format: Sparrow, Name: "Savings", Key: xpub84,
+			Purpose: address.BIP84, GapLimit: 30, Receive: 4, Change: 1,
+			Labels: []label.Label{label.New(label.Tx, txid, "Coffee")},
+			PathLabels: map[[2]uint32]string{
+				{0, 0}: "Donations",
+				{1, 0}: "Change from rent",
+			}}},
+		{"sparrow-multi.json", Wallet{
+			Format: Sparrow, Name: "Treasury", GapLimit: 20,
+			Multisig: &Multisig{Threshold: 2, Script: "p2wsh", Keys: []string{
+				"[3442193e/48h/0h/0h/2h]" + xpub1,
+				"[bd16bee5/48h/0h/0h/2h]" + xpub2,
+				xpub3,
+			}}}},
+		{"core-listdescriptors.json", Wallet{
+			Format: BitcoinCore, Name: "watch",
+			Descriptors: []Descriptor{
+				{"wpkh([73c5da0a/84h/0h/0h]" + xpub84 + "/0/*)#afwvtk2s",
+					[]int{0, 24}},
+				{"wpkh([73c5da0a/84h/0h/0h]" + xpub84 + "/1/*)#vatdkr6g",
+					[]int{0, 19}},
+				{"addr(bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4)#uyjndxcw",
+					nil},
+			}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data := readFixture(t, tt.file)
+			if c := DetectChain(data); c != address.Bitcoin {
+				t.Errorf("DetectChain = %s, want %s", c, address.Bitcoin)
+			}
+			w, err := Read(address.Bitcoin, data)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if !reflect.DeepEqual(w, tt.want) {
+				t.Errorf("Read = %+v, want %+v", w, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPrivate(t *testing.T) {
+	secrets := []string{"xprv", "L4rK1y", "QmFzZTY0"}
+	for _, file := range []string{
+		"electrum-encrypted-seed.json",
+		"electrum-xprv.json",
+		"electrum-imported-keys.json",
+		"sparrow-seed.json",
+		"core-private.json",
+	} {
+		t.Run(file, func(t *testing.T) {
+			_, err := Read(address.Bitcoin, readFixture(t, file))
+			if !errors.Is(err, ErrPrivateKey) {
+				t.Fatalf("Read = %v, want ErrPrivateKey", err)
+			}
+			for _, s := range secrets {
+				if strings.Contains(err.Error(), s) {
+					t.Errorf("Read = %v, which repeats the key", err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadUnknown(t *testing.T) {
+	_, err := Read(address.Bitcoin, readFixture(t, "unknown.json"))
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Read = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestDetectChain(t *testing.T) {
+	data := []byte(`{"wallet_type": "imported", "addresses": {
+		"ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n9": {}}}`)
+	if c := DetectChain(data); c != address.Litecoin {
+		t.Errorf("DetectChain = %s, want %s", c, address.Litecoin)
+	}
+}
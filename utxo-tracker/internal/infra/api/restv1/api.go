@@ -1,11 +1,21 @@
 package restv1
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
 	"github.com/hannesdejager/utxo-tracker/internal/infra/jaeger"
 	"github.com/hannesdejager/utxo-tracker/internal/infra/logging"
 	"github.com/hannesdejager/utxo-tracker/internal/infra/prometheus"
@@ -14,12 +24,35 @@ import (
 
 //go:generate ../../../../scripts/gen-rest-v1-api.sh
 
-func NewHandler(log *slog.Logger, baseURL string) http.Handler {
+// NewHandler builds the REST v1 router. Account data is read and written
+// through the given repository.
+func NewHandler(
+	log *slog.Logger,
+	baseURL string,
+	accounts domain.AccountRepository,
+	options ...Option,
+) http.Handler {
+	si := &impl{
+		accounts: accounts,
+		log:      log,
+		fail:     errorWriter(log),
+		cursors:  cursorCodec{key: newRandomKey()},
+		receipts: receiptSigner{key: newRandomKey()},
+	}
+	for _, opt := range options {
+		opt(si)
+	}
+	// An enforcer passed in is shared with other writers, such as the
+	// rescan job, so that their writes are serialized with the API's
+	_, enforced := si.accounts.(*domain.QuotaEnforcer)
+	if !enforced && si.quota != (domain.Quota{}) {
+		si.accounts = domain.NewQuotaEnforcer(si.accounts, si.quota)
+	}
+
 	r := chi.NewRouter()
 	r.Use(prometheus.APIMiddleware)
 	r.Use(jaeger.TracingMiddleware)
 	r.Use(logging.APIRequestLogger(log))
-	r.Use(middleware.AllowContentType("application/json"))
 	r.Use(logging.Recoverer(log))
 	r.Get(baseURL+"/spec", SpecHandler())
 	r.Mount(baseURL+"/docs", restdocs.New(
@@ -30,35 +63,663 @@ func NewHandler(log *slog.Logger, baseURL string) http.Handler {
 	r.Get(baseURL, func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, baseURL+"/docs", http.StatusMovedPermanently)
 	})
-	return HandlerFromMuxWithBaseURL(
-		&impl{},
-		r,
-		baseURL,
+	return HandlerWithOptions(
+		si,
+		ChiServerOptions{
+			BaseURL:          baseURL,
+			BaseRouter:       r,
+			Middlewares:      []MiddlewareFunc{si.limitRequests},
+			ErrorHandlerFunc: paramErrorWriter,
+		},
 	)
 }
 
-// AccountService is our implementation of the ServerInterface.
-type impl struct{}
+// Option instances can be given to the NewHandler function.
+type Option func(*impl)
+
+// WithCursorKey sets the key pagination cursors are signed with. Without
+// it a random key is used and cursors only work on the replica that
+// issued them.
+func WithCursorKey(key []byte) Option {
+	return func(s *impl) {
+		s.cursors = cursorCodec{key: key}
+	}
+}
+
+// WithIdempotency enables Idempotency-Key handling on POST routes.
+// Responses are kept in store for ttl.
+func WithIdempotency(store domain.IdempotencyRepository,
+	ttl time.Duration) Option {
+	return func(s *impl) {
+		s.idempotency = idempotency{store: store, ttl: ttl}
+	}
+}
+
+// WithPortfolios serves the portfolio routes from repo. Balances are
+// read from chain, which may be nil to leave them out.
+func WithPortfolios(repo domain.PortfolioRepository,
+	chain domain.ChainSource) Option {
+	return func(s *impl) {
+		s.portfolios = repo
+		s.chain = chain
+	}
+}
+
+// WithMembers enables sharing accounts with the members stored in repo.
+// Without it users only see the accounts they own.
+func WithMembers(repo domain.MemberRepository) Option {
+	return func(s *impl) {
+		s.members = repo
+	}
+}
+
+// WithRetention lets owners restore deleted accounts for d. Without it
+// they can be restored until they are purged.
+func WithRetention(d time.Duration) Option {
+	return func(s *impl) {
+		s.retention = d
+	}
+}
 
-// GetAccounts returns a 501 status code indicating that the functionality is not implemented.
+// WithUserData serves the export and erasure of user data from repo and
+// tracks erasures in erasures.
+func WithUserData(repo domain.UserDataRepository,
+	erasures domain.ErasureRepository) Option {
+	return func(s *impl) {
+		s.userData = repo
+		s.erasures = erasures
+	}
+}
+
+// WithReceiptKey sets the key erasure receipts are signed with. Without
+// it a random key is used and receipts cannot be verified after a
+// restart or on other replicas.
+func WithReceiptKey(key []byte) Option {
+	return func(s *impl) {
+		s.receipts = receiptSigner{key: key}
+	}
+}
+
+// impl is our implementation of the ServerInterface.
+type impl struct {
+	accounts domain.AccountRepository
+	log      *slog.Logger
+	// fail writes the problem response matching a domain error
+	fail        func(w http.ResponseWriter, r *http.Request, err error)
+	cursors     cursorCodec
+	idempotency idempotency
+	portfolios  domain.PortfolioRepository
+	chain       domain.ChainSource
+	quota       domain.Quota
+	requests    requestCounter
+	members     domain.MemberRepository
+	retention   time.Duration
+	userData    domain.UserDataRepository
+	erasures    domain.ErasureRepository
+	receipts    receiptSigner
+	audit       domain.AuditRepository
+	auditKey    domain.AuditKey
+}
+
+// maxBodyBytes caps the size of JSON request bodies.
+const maxBodyBytes = 1 << 20
+
+// GetAccounts lists a page of the requesting user's accounts.
 func (s *impl) GetAccounts(
 	w http.ResponseWriter,
 	r *http.Request,
 	params GetAccountsParams,
 ) {
-	http.Error(
-		w,
-		"Not Implemented",
-		http.StatusNotImplemented,
-	)
+	q, fingerprint := accountQuery(params)
+	if err := q.Validate(); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if params.Cursor != nil {
+		pos, err := s.cursors.decode(fingerprint, *params.Cursor)
+		if err != nil {
+			writeProblem(w, newProblem(http.StatusBadRequest, err.Error()))
+			return
+		}
+		q.After = pos
+	}
+
+	// Ask for one more to find out if there is a next page
+	limit := q.Limit
+	q.Limit++
+	as, err := s.accounts.ListAccounts(r.Context(), q)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	roles, err := s.roles(r.Context(), params.XUserID, as)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	list := AccountList{Accounts: make([]Account, 0, limit)}
+	for i, a := range as {
+		if i == limit {
+			next := nextPageURL(r,
+				s.cursors.encode(fingerprint, as[i-1].Position()))
+			list.Next = &next
+			break
+		}
+		list.Accounts = append(list.Accounts, toAPIAccount(a, roles[a.ID]))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// accountQuery maps the listing parameters onto a domain query. It also
+// returns a fingerprint of the parameters that a cursor is bound to.
+func accountQuery(p GetAccountsParams) (domain.AccountQuery, string) {
+	q := domain.NewAccountQuery(p.XUserID)
+	if p.Limit != nil {
+		q.Limit = *p.Limit
+	}
+	if p.Sort != nil {
+		s := string(*p.Sort)
+		q.Descending = strings.HasPrefix(s, "-")
+		q.OrderBy = domain.AccountOrder(strings.TrimPrefix(s, "-"))
+	}
+	q.NamePrefix = deref(p.Name)
+	q.Chain = address.Chain(deref(p.Chain))
+	q.Network = address.Network(deref(p.Network))
+	q.HasAddress = deref(p.HasAddress)
+	fp := strings.Join([]string{
+		p.XUserID,
+		string(q.OrderBy),
+		strconv.FormatBool(q.Descending),
+		q.NamePrefix,
+		string(q.Chain),
+		string(q.Network),
+		q.HasAddress,
+	}, "\x00")
+	return q, fp
+}
+
+// nextPageURL returns the request URL with the cursor replaced.
+func nextPageURL(r *http.Request, cursor string) string {
+	v := r.URL.Query()
+	v.Set("cursor", cursor)
+	return r.URL.Path + "?" + v.Encode()
+}
+
+// CreateAccount validates and stores a new account for the requesting
+// user. Retries carrying the same Idempotency-Key get the first response.
+func (s *impl) CreateAccount(
+	w http.ResponseWriter,
+	r *http.Request,
+	params CreateAccountParams,
+) {
+	s.idempotent(w, r, params.XUserID, params.IdempotencyKey,
+		func(w http.ResponseWriter, r *http.Request) {
+			s.createAccount(w, r, params)
+		})
+}
+
+func (s *impl) createAccount(
+	w http.ResponseWriter,
+	r *http.Request,
+	params CreateAccountParams,
+) {
+	var req NewAccountRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	a, err := domain.NewAccount(
+		params.XUserID, newAccountSpec(req), time.Now())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	a = s.discover(r.Context(), a)
+	if deref(params.RejectTrackedAddresses) {
+		matches, err := s.accounts.FindAddresses(
+			r.Context(), a.OwnerID, a.Addresses...)
+		if err == nil {
+			err = domain.CheckUntracked(a, matches)
+		}
+		if err != nil {
+			s.fail(w, r, err)
+			return
+		}
+	}
+	e := auditEntry(r.Context(), params.XUserID, a.ID, domain.AuditCreate,
+		domain.AccountChanges(nil, a))
+	if err := s.accounts.CreateAccount(r.Context(), a, e); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Location", r.URL.Path+"/"+a.ID)
+	writeJSON(w, http.StatusCreated, toAPIAccount(a, domain.RoleOwner))
+}
+
+// GetAccountById returns a single account the requesting user owns or
+// is a member of.
+func (s *impl) GetAccountById(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params GetAccountByIdParams,
+) {
+	a, role, err := s.authorize(r.Context(), params.XUserID, accountId,
+		domain.RoleViewer)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(a.Version))
+	if params.IfNoneMatch != nil {
+		if t, ok := parseETags(*params.IfNoneMatch); ok &&
+			t.matches(a.Version) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, toAPIAccount(a, role))
+}
+
+// PatchAccount applies a JSON Merge Patch to an account. The change is
+// only stored if the account is still at the version named by If-Match.
+func (s *impl) PatchAccount(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params PatchAccountParams,
+) {
+	// Plain JSON is accepted too, as it was before the media types were
+	// checked per route
+	if !requireContentType(w, r,
+		"application/merge-patch+json", "application/json") {
+		return
+	}
+	ifMatch, ok := requireIfMatch(w, params.IfMatch)
+	if !ok {
+		return
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest,
+			"failed to read request body: "+err.Error()))
+		return
+	}
+	a, role, err := s.authorize(r.Context(), params.XUserID, accountId,
+		domain.RoleEditor)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if !ifMatch.matches(a.Version) {
+		s.fail(w, r, domain.ErrVersionMismatch)
+		return
+	}
+	p, err := applyMergePatch(a, patch)
+	if err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest,
+			"invalid merge patch: "+err.Error()))
+		return
+	}
+	updated, err := a.Update(domain.AccountSpec{
+		Name:          deref(p.Name),
+		Addresses:     deref(p.Addresses),
+		Chain:         address.Chain(deref(p.Chain)),
+		Network:       address.Network(deref(p.Network)),
+		Tags:          deref(p.Tags),
+		AddressLabels: derefValues(deref(p.AddressLabels)),
+	}, time.Now())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	e := auditEntry(r.Context(), params.XUserID, a.ID, domain.AuditUpdate,
+		domain.AccountChanges(&a, updated))
+	err = s.accounts.UpdateAccount(r.Context(), updated, a.Version, e)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(updated.Version))
+	writeJSON(w, http.StatusOK, toAPIAccount(updated, role))
+}
+
+// DeleteAccount deletes an account if it is still at the version named
+// by If-Match. Only the owner may delete it.
+func (s *impl) DeleteAccount(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params DeleteAccountParams,
+) {
+	ifMatch, ok := requireIfMatch(w, params.IfMatch)
+	if !ok {
+		return
+	}
+	a, _, err := s.authorize(r.Context(), params.XUserID, accountId,
+		domain.RoleOwner)
+	if err == nil && !ifMatch.matches(a.Version) {
+		err = domain.ErrVersionMismatch
+	}
+	if err == nil {
+		deleted := a.Delete(time.Now())
+		e := auditEntry(r.Context(), params.XUserID, a.ID,
+			domain.AuditDelete, domain.AccountChanges(&a, deleted))
+		err = s.accounts.DeleteAccount(r.Context(), deleted, a.Version, e)
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreAccount brings back an account the requesting user deleted
+// within the retention period. Retries carrying the same
+// Idempotency-Key get the first response.
+func (s *impl) RestoreAccount(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params RestoreAccountParams,
+) {
+	s.idempotent(w, r, params.XUserID, params.IdempotencyKey,
+		func(w http.ResponseWriter, r *http.Request) {
+			s.restoreAccount(w, r, accountId, params)
+		})
+}
+
+func (s *impl) restoreAccount(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params RestoreAccountParams,
+) {
+	a, err := s.accounts.GetDeletedAccount(
+		r.Context(), params.XUserID, accountId)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	restored, err := a.Restore(time.Now(), s.retention)
+	if err == nil {
+		e := auditEntry(r.Context(), params.XUserID, a.ID,
+			domain.AuditRestore, domain.AccountChanges(&a, restored))
+		err = s.accounts.RestoreAccount(r.Context(), restored, a.Version,
+			e)
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(restored.Version))
+	writeJSON(w, http.StatusOK, toAPIAccount(restored, domain.RoleOwner))
+}
+
+// GetAddress returns the accounts the requesting user can see that hold
+// an address.
+func (s *impl) GetAddress(
+	w http.ResponseWriter,
+	r *http.Request,
+	addr string,
+	params GetAddressParams,
+) {
+	chain := address.Bitcoin
+	if params.Chain != nil {
+		chain = address.Chain(*params.Chain)
+	}
+	pa, err := address.ParseOn(chain, addr)
+	if err != nil {
+		var v domain.ValidationError
+		v.Add("address", addr, err.Error())
+		s.fail(w, r, &v)
+		return
+	}
+	as, err := s.holders(r.Context(), params.XUserID, pa.Encoded)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if len(as) == 0 {
+		s.fail(w, r, domain.ErrAddressNotTracked)
+		return
+	}
+	roles, err := s.roles(r.Context(), params.XUserID, as)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	res := AddressLookup{
+		Address:  pa.Encoded,
+		Type:     AddressLookupType(pa.Type),
+		Chain:    Chain(pa.Chain),
+		Networks: make([]Network, 0, len(pa.Networks)),
+		Accounts: make([]AddressOwner, 0, len(as)),
+	}
+	for _, n := range pa.Networks {
+		res.Networks = append(res.Networks, Network(n))
+	}
+	for _, a := range as {
+		o := AddressOwner{
+			Account: toAPIAccount(a, roles[a.ID]),
+			Index:   slices.Index(a.Addresses, pa.Encoded),
+		}
+		if path := a.Path(pa.Encoded); path != "" {
+			o.DerivationPath = &path
+		}
+		res.Accounts = append(res.Accounts, o)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// holders returns the accounts the user owns or is an active member of
+// that hold a canonical address, in creation order.
+func (s *impl) holders(ctx context.Context, userID, addr string,
+) ([]domain.Account, error) {
+	q := domain.NewAccountQuery(userID)
+	q.HasAddress = addr
+	q.Limit = domain.MaxPageSize
+	var out []domain.Account
+	for {
+		as, err := s.accounts.ListAccounts(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, as...)
+		if len(as) < q.Limit {
+			return out, nil
+		}
+		q.After = as[len(as)-1].Position()
+	}
+}
+
+// applyMergePatch applies an RFC 7396 patch to the patchable fields of
+// an account. Fields that cannot be patched are rejected.
+func applyMergePatch(a domain.Account, patch []byte) (AccountPatch, error) {
+	labels := make(map[string]*string)
+	for ref, text := range a.AddressLabels() {
+		labels[ref] = &text
+	}
+	chain, network := Chain(a.Chain), Network(a.Network)
+	doc, err := json.Marshal(AccountPatch{
+		Name:          &a.Name,
+		Addresses:     &a.Addresses,
+		Chain:         &chain,
+		Network:       &network,
+		Tags:          &a.Tags,
+		AddressLabels: &labels,
+	})
+	if err != nil {
+		return AccountPatch{}, err
+	}
+	merged, err := jsonpatch.MergePatch(doc, patch)
+	if err != nil {
+		return AccountPatch{}, err
+	}
+	var p AccountPatch
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	return p, dec.Decode(&p)
+}
+
+// newAccountSpec returns the account fields of a creation request.
+func newAccountSpec(req NewAccountRequest) domain.AccountSpec {
+	spec := domain.AccountSpec{
+		Name:          req.Name,
+		Addresses:     deref(req.Addresses),
+		Chain:         address.Chain(deref(req.Chain)),
+		Network:       address.Network(deref(req.Network)),
+		Tags:          deref(req.Tags),
+		AddressLabels: deref(req.AddressLabels),
+	}
+	if d := req.Derivation; d != nil {
+		spec.Derivation = &domain.DerivationSpec{
+			ExtendedKey: d.ExtendedKey,
+			Purpose:     address.Purpose(deref(d.Purpose)),
+			GapLimit:    deref(d.GapLimit),
+		}
+	}
+	for _, d := range deref(req.Descriptors) {
+		spec.Descriptors = append(spec.Descriptors, domain.DescriptorSpec{
+			Descriptor: d.Descriptor,
+			Range:      deref(d.Range),
+		})
+	}
+	if m := req.Multisig; m != nil {
+		spec.Multisig = &domain.MultisigSpec{
+			Threshold: m.Threshold,
+			Keys:      m.Keys,
+			Script:    domain.MultisigScript(deref(m.ScriptType)),
+			Range:     deref(m.Range),
+		}
+	}
+	return spec
+}
+
+// discover adds the derived addresses found used on chain to a new
+// account. When the chain cannot be read the account keeps its first
+// addresses and the background rescan catches up.
+func (s *impl) discover(ctx context.Context, a domain.Account,
+) domain.Account {
+	b, _, err := domain.DiscoverAddresses(ctx, s.chain, a)
+	if err != nil {
+		s.log.WarnContext(ctx, "Failed to discover derived addresses",
+			"error", err)
+		return a
+	}
+	return b
+}
+
+// derefValues drops the nil values of m.
+func derefValues[K comparable, V any](m map[K]*V) map[K]V {
+	out := make(map[K]V, len(m))
+	for k, v := range m {
+		if v != nil {
+			out[k] = *v
+		}
+	}
+	return out
+}
+
+// nonZero returns a pointer to v, or nil if v is the zero value.
+func nonZero[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return &v
+}
+
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
+// decodeJSON reads the request body into v. It writes a 400 problem and
+// returns false if the body is not valid JSON.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if !requireContentType(w, r, "application/json") {
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err := dec.Decode(v); err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest,
+			"invalid request body: "+err.Error()))
+		return false
+	}
+	return true
 }
 
-// CreateAccount returns a 501 status code indicating that the functionality is not implemented.
-func (s *impl) CreateAccount(w http.ResponseWriter, r *http.Request, params CreateAccountParams) {
-	http.Error(w, "Not Implemented", http.StatusNotImplemented)
+func toAPIAccount(a domain.Account, role domain.Role) Account {
+	out := Account{
+		Role:          Role(role),
+		Id:            a.ID,
+		Name:          a.Name,
+		Addresses:     a.Addresses,
+		Chain:         Chain(a.Chain),
+		Network:       Network(a.Network),
+		Tags:          a.Tags,
+		AddressLabels: a.AddressLabels(),
+		Version:       a.Version,
+		CreatedAt:     a.CreatedAt,
+		UpdatedAt:     a.UpdatedAt,
+		DeletedAt:     a.DeletedAt,
+	}
+	paths := make(map[string]string)
+	if d := a.Derivation; d != nil {
+		purpose := Purpose(d.Purpose)
+		out.Derivation = &Derivation{
+			ExtendedKey: d.ExtendedKey,
+			Purpose:     &purpose,
+			GapLimit:    &d.GapLimit,
+		}
+		for _, da := range d.Addresses {
+			paths[da.Address] = da.Path
+		}
+	}
+	if len(a.Descriptors) > 0 {
+		ds := make([]OutputDescriptor, 0, len(a.Descriptors))
+		for _, d := range a.Descriptors {
+			od := OutputDescriptor{Descriptor: d.Descriptor}
+			if d.Ranged() {
+				od.Range = &[]int{int(d.Start), int(d.End)}
+			}
+			if m := d.Multisig; m != nil {
+				od.Multisig = toAPIMultisig(*m)
+			}
+			if len(d.Conditions) > 0 {
+				od.SpendingConditions = &d.Conditions
+			}
+			ds = append(ds, od)
+			for _, da := range d.Addresses {
+				if da.Path != "" {
+					paths[da.Address] = da.Path
+				}
+			}
+		}
+		out.Descriptors = &ds
+	}
+	if len(paths) > 0 {
+		out.DerivationPaths = &paths
+	}
+	return out
 }
 
-// GetAccountById returns a 501 status code indicating that the functionality is not implemented.
-func (s *impl) GetAccountById(w http.ResponseWriter, r *http.Request, accountId string, params GetAccountByIdParams) {
-	http.Error(w, "Not Implemented", http.StatusNotImplemented)
+func toAPIMultisig(m domain.Multisig) *Multisig {
+	out := &Multisig{
+		Quorum:     Quorum{Required: m.Threshold, Total: len(m.Cosigners)},
+		Cosigners:  make([]Cosigner, 0, len(m.Cosigners)),
+		ScriptType: MultisigScript(m.Script),
+		Sorted:     m.Sorted,
+	}
+	for _, c := range m.Cosigners {
+		out.Cosigners = append(out.Cosigners, Cosigner{
+			Fingerprint:    c.Fingerprint,
+			DerivationPath: nonZero(c.Path),
+			Key:            c.Key,
+		})
+	}
+	return out
 }
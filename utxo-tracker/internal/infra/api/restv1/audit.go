@@ -0,0 +1,96 @@
+package restv1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/logging"
+)
+
+// WithAudit serves the audit chains of accounts stored in repo. Their
+// heads must be signed with key.
+func WithAudit(repo domain.AuditRepository, key domain.AuditKey) Option {
+	return func(s *impl) {
+		s.audit = repo
+		s.auditKey = key
+	}
+}
+
+// GetAccountAudit returns the audit chain of an account along with the
+// result of verifying it.
+func (s *impl) GetAccountAudit(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params GetAccountAuditParams,
+) {
+	a, _, err := s.authorize(r.Context(), params.XUserID, accountId,
+		domain.RoleViewer)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	es := []domain.AuditEntry{}
+	var head *domain.AuditHead
+	if s.audit != nil {
+		es, head, err = s.audit.ListAudit(r.Context(), a.ID)
+		if err != nil {
+			s.fail(w, r, err)
+			return
+		}
+	}
+	b := domain.VerifyAuditChain(es, head, s.auditKey)
+	writeJSON(w, http.StatusOK, toAPIAuditLog(es, b))
+}
+
+// auditEntry returns the audit entry of a change to an account made by
+// the requesting user, to be stored along with the change.
+func auditEntry(ctx context.Context, actor, accountID string,
+	action domain.AuditAction, changes []domain.AuditChange,
+) domain.AuditEntry {
+	return domain.NewAuditEntry(accountID, action, actor,
+		logging.TraceID(ctx), changes, time.Now())
+}
+
+func toAPIAuditLog(es []domain.AuditEntry, b *domain.AuditBreak,
+) AuditLog {
+	out := AuditLog{Entries: make([]AuditEntry, 0, len(es)), Intact: true}
+	for _, e := range es {
+		changes := make([]AuditChange, 0, len(e.Changes))
+		for _, c := range e.Changes {
+			changes = append(changes, AuditChange{
+				Field:  c.Field,
+				Before: rawValue(c.Before),
+				After:  rawValue(c.After),
+			})
+		}
+		out.Entries = append(out.Entries, AuditEntry{
+			Seq:      e.Seq,
+			Action:   AuditEntryAction(e.Action),
+			Actor:    e.Actor,
+			TraceId:  nonZero(e.TraceID),
+			At:       e.At,
+			Changes:  changes,
+			PrevHash: e.PrevHash,
+			Hash:     e.Hash,
+		})
+	}
+	if b != nil {
+		out.Intact = false
+		out.BrokenLink = &AuditBreak{Seq: b.Seq, Reason: b.Reason}
+	}
+	return out
+}
+
+// rawValue passes a JSON value through as it is, or returns nil if
+// there is none.
+func rawValue(v json.RawMessage) *any {
+	if v == nil {
+		return nil
+	}
+	var out any = v
+	return &out
+}
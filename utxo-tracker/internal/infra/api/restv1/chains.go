@@ -0,0 +1,26 @@
+package restv1
+
+import (
+	"net/http"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// GetChains lists the parameters of the supported chain networks.
+func (s *impl) GetChains(w http.ResponseWriter, r *http.Request) {
+	list := ChainList{Chains: []ChainParams{}}
+	for _, p := range address.Registry() {
+		list.Chains = append(list.Chains, ChainParams{
+			Chain:             Chain(p.Chain),
+			Network:           Network(p.Network),
+			PubKeyHashVersion: int(p.PubKeyHash),
+			ScriptHashVersion: int(p.ScriptHash),
+			Bech32Hrp:         nonZero(p.HRP),
+			CashAddrPrefix:    nonZero(p.CashAddrPrefix),
+			CoinType:          int(p.CoinType),
+			DustLimit:         p.DustLimit,
+			BlockTimeSeconds:  int(p.BlockTime.Seconds()),
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
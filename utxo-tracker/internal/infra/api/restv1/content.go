@@ -0,0 +1,31 @@
+package restv1
+
+import (
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// requireContentType checks that the request body is of one of the given
+// media types and sends a 415 problem otherwise. Operations accept
+// different media types, so this is checked by each handler rather than
+// by a router wide middleware.
+func requireContentType(w http.ResponseWriter, r *http.Request,
+	types ...string) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err == nil && slices.Contains(types, strings.ToLower(mt)) {
+		return true
+	}
+	// Accept is a request header, the media types a resource takes are
+	// announced with Accept-Post and Accept-Patch (RFC 5789).
+	switch r.Method {
+	case http.MethodPost:
+		w.Header().Set("Accept-Post", strings.Join(types, ", "))
+	case http.MethodPatch:
+		w.Header().Set("Accept-Patch", strings.Join(types, ", "))
+	}
+	writeProblem(w, newProblem(http.StatusUnsupportedMediaType,
+		"Content-Type must be "+strings.Join(types, " or ")))
+	return false
+}
@@ -0,0 +1,85 @@
+package restv1
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+var errInvalidCursor = errors.New("the cursor is invalid or does not " +
+	"belong to this query, restart from the first page")
+
+// cursorCodec signs pagination cursors so that clients cannot forge
+// positions or reuse a cursor with different sort or filter parameters.
+// All replicas must share the key for cursors to work across them.
+type cursorCodec struct {
+	key []byte
+}
+
+// newRandomKey returns a key that is only valid in this process.
+func newRandomKey() []byte {
+	k := make([]byte, 32)
+	_, _ = rand.Read(k)
+	return k
+}
+
+type cursorPayload struct {
+	// Query is a digest of the parameters the cursor is valid for
+	Query     []byte    `json:"q"`
+	ID        string    `json:"i"`
+	Name      string    `json:"n,omitempty"`
+	CreatedAt time.Time `json:"c"`
+}
+
+func (c cursorCodec) encode(query string, p *domain.AccountPosition,
+) string {
+	b, _ := json.Marshal(cursorPayload{
+		Query:     c.digest(query),
+		ID:        p.ID,
+		Name:      p.Name,
+		CreatedAt: p.CreatedAt,
+	})
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(b) + "." + enc.EncodeToString(c.sign(b))
+}
+
+func (c cursorCodec) decode(query, token string,
+) (*domain.AccountPosition, error) {
+	enc := base64.RawURLEncoding
+	data, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+	b, err1 := enc.DecodeString(data)
+	s, err2 := enc.DecodeString(sig)
+	if err1 != nil || err2 != nil || !hmac.Equal(s, c.sign(b)) {
+		return nil, errInvalidCursor
+	}
+	var p cursorPayload
+	if err := json.Unmarshal(b, &p); err != nil ||
+		!hmac.Equal(p.Query, c.digest(query)) {
+		return nil, errInvalidCursor
+	}
+	return &domain.AccountPosition{
+		ID:        p.ID,
+		Name:      p.Name,
+		CreatedAt: p.CreatedAt,
+	}, nil
+}
+
+func (c cursorCodec) sign(b []byte) []byte {
+	m := hmac.New(sha256.New, c.key)
+	m.Write(b)
+	return m.Sum(nil)
+}
+
+func (c cursorCodec) digest(query string) []byte {
+	return c.sign([]byte("query:" + query))[:8]
+}
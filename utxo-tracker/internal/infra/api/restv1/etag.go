@@ -0,0 +1,87 @@
+package restv1
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag formats an account version as a strong entity tag.
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// entityTags is an If-Match or If-None-Match header value, either * or a
+// list of entity tags (RFC 9110 section 13.1.1).
+type entityTags struct {
+	any      bool
+	versions []int64
+}
+
+// matches reports whether the tags name the given version. Tags are
+// compared weakly, as the versions are the same for weak and strong tags.
+func (t entityTags) matches(version int64) bool {
+	if t.any {
+		return true
+	}
+	for _, v := range t.versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETags parses an If-Match or If-None-Match header value. Tags that
+// are not account versions never match.
+func parseETags(v string) (entityTags, bool) {
+	v = strings.TrimSpace(v)
+	if v == "*" {
+		return entityTags{any: true}, true
+	}
+	var (
+		t    entityTags
+		tags int
+	)
+	for ; ; tags++ {
+		v = strings.TrimLeft(v, " \t,")
+		if v == "" {
+			return t, tags > 0
+		}
+		v = strings.TrimPrefix(v, "W/")
+		if !strings.HasPrefix(v, `"`) {
+			return entityTags{}, false
+		}
+		end := strings.IndexByte(v[1:], '"')
+		if end < 0 {
+			return entityTags{}, false
+		}
+		if n, err := strconv.ParseInt(v[1:end+1], 10, 64); err == nil {
+			t.versions = append(t.versions, n)
+		}
+		v = v[end+2:]
+		if rest := strings.TrimLeft(v, " \t"); rest != "" &&
+			rest[0] != ',' {
+			return entityTags{}, false
+		}
+	}
+}
+
+// requireIfMatch returns the entity tags of the If-Match header. It
+// writes a 428 or 400 problem and returns false if the header is missing
+// or malformed.
+func requireIfMatch(w http.ResponseWriter, ifMatch *string,
+) (entityTags, bool) {
+	if ifMatch == nil {
+		writeProblem(w, newProblem(http.StatusPreconditionRequired,
+			"the If-Match header is required to modify an account"))
+		return entityTags{}, false
+	}
+	t, ok := parseETags(*ifMatch)
+	if !ok {
+		writeProblem(w, newProblem(http.StatusBadRequest,
+			"the If-Match header must hold * or ETags such as \"3\""))
+		return entityTags{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,187 @@
+package restv1
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+const (
+	// maxIdempotencyKeyLength bounds the keys clients may send.
+	maxIdempotencyKeyLength = 255
+	// idempotencyLockTTL bounds how long a request that never finishes,
+	// for example because the replica crashed, blocks its key. The
+	// reservation is extended while the request is being processed, so
+	// it does not bound how long handlers may take.
+	idempotencyLockTTL = time.Minute
+)
+
+// idempotency holds the settings for Idempotency-Key handling.
+type idempotency struct {
+	store domain.IdempotencyRepository
+	ttl   time.Duration
+}
+
+// idempotent runs next unless the owner already made the request with
+// the same Idempotency-Key, in which case the stored response is
+// replayed. Requests without a key, or made while no store is
+// configured, are passed through.
+func (s *impl) idempotent(
+	w http.ResponseWriter,
+	r *http.Request,
+	ownerID string,
+	key *string,
+	next http.HandlerFunc,
+) {
+	if key == nil || s.idempotency.store == nil {
+		next(w, r)
+		return
+	}
+	if *key == "" || len(*key) > maxIdempotencyKeyLength {
+		var v domain.ValidationError
+		v.Add("Idempotency-Key", *key, "must be 1 to 255 characters")
+		s.fail(w, r, &v)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest,
+			"failed to read request body: "+err.Error()))
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	now := time.Now()
+	rec := domain.IdempotencyRecord{
+		OwnerID:     ownerID,
+		Key:         *key,
+		Fingerprint: fingerprint(r, body),
+		ExpiresAt:   now.Add(idempotencyLockTTL),
+	}
+	store := s.idempotency.store
+	prev, err := store.ReserveIdempotencyKey(r.Context(), rec, now)
+	switch {
+	case err != nil:
+		s.fail(w, r, err)
+	case prev == nil:
+		s.record(w, r, rec, next)
+	case prev.Fingerprint != rec.Fingerprint:
+		s.fail(w, r, domain.ErrIdempotencyKeyReused)
+	case !prev.Completed():
+		s.fail(w, r, domain.ErrIdempotencyKeyInUse)
+	default:
+		h := w.Header()
+		maps.Copy(h, prev.Header)
+		h.Set("Idempotent-Replayed", "true")
+		w.WriteHeader(prev.Status)
+		_, _ = w.Write(prev.Body)
+	}
+}
+
+// record runs next and stores its response under the reserved key.
+// Server errors are not stored so that the request can be retried.
+func (s *impl) record(
+	w http.ResponseWriter,
+	r *http.Request,
+	rec domain.IdempotencyRecord,
+	next http.HandlerFunc,
+) {
+	// The outcome is stored even if the client went away meanwhile, as
+	// that is when it is most likely to retry
+	ctx := context.WithoutCancel(r.Context())
+	store := s.idempotency.store
+	rw := &responseRecorder{ResponseWriter: w}
+	stop := s.keepReserved(ctx, rec)
+	defer func() {
+		stop()
+		if rw.status == 0 || rw.status >= 500 {
+			_ = store.ReleaseIdempotencyKey(ctx, rec.OwnerID, rec.Key)
+			return
+		}
+		rec.Status = rw.status
+		rec.Header = rw.header
+		rec.Body = rw.body.Bytes()
+		rec.ExpiresAt = time.Now().Add(s.idempotency.ttl)
+		if err := store.CompleteIdempotencyKey(ctx, rec); err != nil {
+			s.log.ErrorContext(ctx, "Failed to store idempotent response",
+				"path", r.URL.Path, "error", err)
+			_ = store.ReleaseIdempotencyKey(ctx, rec.OwnerID, rec.Key)
+		}
+	}()
+	next(rw, r)
+}
+
+// keepReserved extends the reservation of rec until the returned
+// function is called, so that slow requests keep their key.
+func (s *impl) keepReserved(ctx context.Context,
+	rec domain.IdempotencyRecord) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(idempotencyLockTTL / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-t.C:
+				rec.ExpiresAt = now.Add(idempotencyLockTTL)
+				err := s.idempotency.store.ExtendIdempotencyKey(ctx, rec)
+				if err != nil {
+					s.log.WarnContext(ctx,
+						"Failed to extend idempotency key reservation",
+						"error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// fingerprint identifies a request by its target and payload.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping a copy of
+// it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rw *responseRecorder) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+		rw.header = rw.Header().Clone()
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
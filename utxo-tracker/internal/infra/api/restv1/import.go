@@ -0,0 +1,142 @@
+package restv1
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// importBatchSize is the number of lines after which import progress is
+// recorded on the trace and the results so far are flushed.
+const importBatchSize = 100
+
+// importStats counts the outcome of an import.
+type importStats struct {
+	lines, created, failed int
+}
+
+func (st importStats) attributes() trace.EventOption {
+	return trace.WithAttributes(
+		attribute.Int("import.lines", st.lines),
+		attribute.Int("import.created", st.created),
+		attribute.Int("import.failed", st.failed),
+	)
+}
+
+// ImportAccounts creates an account per NDJSON line and streams back a
+// result per line while the body is still being read. Retries carrying
+// the same Idempotency-Key get the first response.
+func (s *impl) ImportAccounts(
+	w http.ResponseWriter,
+	r *http.Request,
+	params ImportAccountsParams,
+) {
+	s.idempotent(w, r, params.XUserID, params.IdempotencyKey,
+		func(w http.ResponseWriter, r *http.Request) {
+			s.importAccounts(w, r, params, params.IdempotencyKey != nil)
+		})
+}
+
+// importAccounts runs an import. Keyed imports run to the end of the
+// body even if the client goes away, so that the stored response holds
+// the result of every line.
+func (s *impl) importAccounts(
+	w http.ResponseWriter,
+	r *http.Request,
+	params ImportAccountsParams,
+	keyed bool,
+) {
+	if !requireContentType(w, r, "application/x-ndjson") {
+		return
+	}
+	ctx := r.Context()
+	if keyed {
+		ctx = context.WithoutCancel(ctx)
+	}
+	ctx, span := otel.Tracer("account-service").Start(ctx, "import accounts")
+	defer span.End()
+
+	// HTTP/1.1 servers stop reading the body once the response starts
+	// unless full duplex is enabled. HTTP/2 does not need it. Clients
+	// waiting on "Expect: 100-continue" only send the body once it is
+	// read from, so that has to happen before the response starts too.
+	rc := http.NewResponseController(w)
+	_ = rc.EnableFullDuplex()
+	body := bufio.NewReader(r.Body)
+	_, _ = body.Peek(1)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+
+	var st importStats
+	sc := bufio.NewScanner(body)
+	sc.Buffer(nil, maxBodyBytes)
+	n := 0
+	for sc.Scan() && ctx.Err() == nil {
+		n++
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		res := s.importLine(ctx, r.URL.Path, params.XUserID, sc.Bytes())
+		res.Line = n
+		st.lines++
+		if res.Error != nil {
+			st.failed++
+		} else {
+			st.created++
+		}
+		if err := enc.Encode(res); err != nil && !keyed {
+			span.RecordError(err)
+			return
+		}
+		if st.lines%importBatchSize == 0 {
+			span.AddEvent("import batch", st.attributes())
+			_ = rc.Flush()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		// The rest of the body cannot be split into lines
+		span.RecordError(err)
+		p := newProblem(http.StatusBadRequest,
+			"failed to read line: "+err.Error())
+		_ = enc.Encode(ImportResult{Line: n + 1, Error: &p})
+	}
+	span.AddEvent("import done", st.attributes())
+	span.SetAttributes(
+		attribute.Int("import.created", st.created),
+		attribute.Int("import.failed", st.failed),
+	)
+}
+
+// importLine creates the account described by a single NDJSON line.
+func (s *impl) importLine(ctx context.Context, path, ownerID string,
+	line []byte) ImportResult {
+	var req NewAccountRequest
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		p := newProblem(http.StatusBadRequest,
+			"invalid account: "+err.Error())
+		return ImportResult{Error: &p}
+	}
+	a, err := domain.NewAccount(ownerID, newAccountSpec(req), time.Now())
+	if err == nil {
+		a = s.discover(ctx, a)
+		e := auditEntry(ctx, ownerID, a.ID, domain.AuditCreate,
+			domain.AccountChanges(nil, a))
+		err = s.accounts.CreateAccount(ctx, a, e)
+	}
+	if err != nil {
+		p := problemFor(ctx, s.log, path, err)
+		return ImportResult{Error: &p}
+	}
+	return ImportResult{Id: &a.ID}
+}
@@ -0,0 +1,92 @@
+package restv1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/label"
+)
+
+// GetAccountLabels exports the labels of an account as BIP329 JSON
+// Lines.
+func (s *impl) GetAccountLabels(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params GetAccountLabelsParams,
+) {
+	a, _, err := s.authorize(r.Context(), params.XUserID, accountId,
+		domain.RoleViewer)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.Header().Set("ETag", etag(a.Version))
+	w.WriteHeader(http.StatusOK)
+	_ = label.Write(w, a.Labels)
+}
+
+// PutAccountLabels replaces the labels of an account with the BIP329
+// records in the body if the account is still at the version named by
+// If-Match.
+func (s *impl) PutAccountLabels(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params PutAccountLabelsParams,
+) {
+	if !requireContentType(w, r, "application/jsonl",
+		"application/x-ndjson") {
+		return
+	}
+	ifMatch, ok := requireIfMatch(w, params.IfMatch)
+	if !ok {
+		return
+	}
+	ls, err := label.Read(
+		http.MaxBytesReader(w, r.Body, maxBodyBytes), maxBodyBytes)
+	if err != nil {
+		s.fail(w, r, labelViolations(err))
+		return
+	}
+	a, _, err := s.authorize(r.Context(), params.XUserID, accountId,
+		domain.RoleEditor)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if !ifMatch.matches(a.Version) {
+		s.fail(w, r, domain.ErrVersionMismatch)
+		return
+	}
+	updated, err := a.Relabel(ls, time.Now())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	e := auditEntry(r.Context(), params.XUserID, a.ID, domain.AuditUpdate,
+		domain.AccountChanges(&a, updated))
+	err = s.accounts.UpdateAccount(r.Context(), updated, a.Version, e)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(updated.Version))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// labelViolations turns the errors of label.Read into a validation error
+// with a violation per line.
+func labelViolations(err error) error {
+	var v domain.ValidationError
+	errs := []error{err}
+	if j, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = j.Unwrap()
+	}
+	for _, e := range errs {
+		v.Add("labels", "", e.Error())
+	}
+	return &v
+}
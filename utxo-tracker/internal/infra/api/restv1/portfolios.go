@@ -0,0 +1,267 @@
+package restv1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+// GetPortfolios lists the requesting user's portfolios along with the
+// summaries of their members.
+func (s *impl) GetPortfolios(
+	w http.ResponseWriter,
+	r *http.Request,
+	params GetPortfoliosParams,
+) {
+	ps, err := s.portfolios.ListPortfolios(r.Context(), params.XUserID)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	list := PortfolioList{Portfolios: make([]Portfolio, 0, len(ps))}
+	for _, p := range ps {
+		summary, err := s.summarize(r.Context(), p)
+		if err != nil {
+			s.fail(w, r, err)
+			return
+		}
+		res := toAPIPortfolio(p)
+		res.Summary = &summary
+		list.Portfolios = append(list.Portfolios, res)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// CreatePortfolio stores a new portfolio for the requesting user.
+// Retries carrying the same Idempotency-Key get the first response.
+func (s *impl) CreatePortfolio(
+	w http.ResponseWriter,
+	r *http.Request,
+	params CreatePortfolioParams,
+) {
+	s.idempotent(w, r, params.XUserID, params.IdempotencyKey,
+		func(w http.ResponseWriter, r *http.Request) {
+			s.createPortfolio(w, r, params)
+		})
+}
+
+func (s *impl) createPortfolio(
+	w http.ResponseWriter,
+	r *http.Request,
+	params CreatePortfolioParams,
+) {
+	var req NewPortfolioRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	p, err := domain.NewPortfolio(params.XUserID, domain.PortfolioSpec{
+		Name:       req.Name,
+		AccountIDs: req.AccountIds,
+	}, time.Now())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if err := s.portfolios.CreatePortfolio(r.Context(), p); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Location", r.URL.Path+"/"+p.ID)
+	writeJSON(w, http.StatusCreated, toAPIPortfolio(p))
+}
+
+// GetPortfolioById returns a portfolio of the requesting user along with
+// the summary of its members.
+func (s *impl) GetPortfolioById(
+	w http.ResponseWriter,
+	r *http.Request,
+	portfolioId string,
+	params GetPortfolioByIdParams,
+) {
+	p, err := s.portfolios.GetPortfolio(
+		r.Context(), params.XUserID, portfolioId)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	summary, err := s.summarize(r.Context(), p)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	res := toAPIPortfolio(p)
+	res.Summary = &summary
+	w.Header().Set("ETag", etag(p.Version))
+	writeJSON(w, http.StatusOK, res)
+}
+
+// PatchPortfolio applies a JSON Merge Patch to a portfolio. The change
+// is only stored if the portfolio is still at the version named by
+// If-Match.
+func (s *impl) PatchPortfolio(
+	w http.ResponseWriter,
+	r *http.Request,
+	portfolioId string,
+	params PatchPortfolioParams,
+) {
+	if !requireContentType(w, r,
+		"application/merge-patch+json", "application/json") {
+		return
+	}
+	ifMatch, ok := requireIfMatch(w, params.IfMatch)
+	if !ok {
+		return
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest,
+			"failed to read request body: "+err.Error()))
+		return
+	}
+	p, err := s.portfolios.GetPortfolio(
+		r.Context(), params.XUserID, portfolioId)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if !ifMatch.matches(p.Version) {
+		s.fail(w, r, domain.ErrVersionMismatch)
+		return
+	}
+	pp, err := applyPortfolioPatch(p, patch)
+	if err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest,
+			"invalid merge patch: "+err.Error()))
+		return
+	}
+	updated, err := p.Update(domain.PortfolioSpec{
+		Name:       deref(pp.Name),
+		AccountIDs: deref(pp.AccountIds),
+	}, time.Now())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	err = s.portfolios.UpdatePortfolio(r.Context(), updated, p.Version)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(updated.Version))
+	writeJSON(w, http.StatusOK, toAPIPortfolio(updated))
+}
+
+// DeletePortfolio removes a portfolio if it is still at the version
+// named by If-Match.
+func (s *impl) DeletePortfolio(
+	w http.ResponseWriter,
+	r *http.Request,
+	portfolioId string,
+	params DeletePortfolioParams,
+) {
+	ifMatch, ok := requireIfMatch(w, params.IfMatch)
+	if !ok {
+		return
+	}
+	p, err := s.portfolios.GetPortfolio(
+		r.Context(), params.XUserID, portfolioId)
+	if err == nil && !ifMatch.matches(p.Version) {
+		err = domain.ErrVersionMismatch
+	}
+	if err == nil {
+		err = s.portfolios.DeletePortfolio(
+			r.Context(), params.XUserID, portfolioId, p.Version)
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// summarize aggregates the member accounts of a portfolio per chain
+// network.
+// Members deleted since the portfolio was read are left out.
+func (s *impl) summarize(ctx context.Context, p domain.Portfolio,
+) ([]NetworkSummary, error) {
+	as := make([]domain.Account, 0, len(p.AccountIDs))
+	for _, id := range p.AccountIDs {
+		a, err := s.accounts.GetAccount(ctx, p.OwnerID, id)
+		if errors.Is(err, domain.ErrAccountNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	ns := domain.SummarizeAddresses(as)
+	out := make([]NetworkSummary, 0, len(ns))
+	for _, n := range ns {
+		if s.chain != nil {
+			bs, err := s.chain.AddressBalances(ctx, n.Chain, n.Network,
+				n.Addresses)
+			switch {
+			case err == nil:
+				n.AddBalances(bs)
+			case !errors.Is(err, domain.ErrNoChainSource):
+				return nil, err
+			}
+		}
+		out = append(out, toAPINetworkSummary(n))
+	}
+	return out, nil
+}
+
+// applyPortfolioPatch applies an RFC 7396 patch to the patchable fields
+// of a portfolio. Fields that cannot be patched are rejected.
+func applyPortfolioPatch(p domain.Portfolio, patch []byte,
+) (PortfolioPatch, error) {
+	doc, err := json.Marshal(PortfolioPatch{
+		Name:       &p.Name,
+		AccountIds: &p.AccountIDs,
+	})
+	if err != nil {
+		return PortfolioPatch{}, err
+	}
+	merged, err := jsonpatch.MergePatch(doc, patch)
+	if err != nil {
+		return PortfolioPatch{}, err
+	}
+	var pp PortfolioPatch
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	return pp, dec.Decode(&pp)
+}
+
+func toAPIPortfolio(p domain.Portfolio) Portfolio {
+	return Portfolio{
+		Id:         p.ID,
+		Name:       p.Name,
+		AccountIds: p.AccountIDs,
+		Version:    p.Version,
+		CreatedAt:  p.CreatedAt,
+		UpdatedAt:  p.UpdatedAt,
+	}
+}
+
+func toAPINetworkSummary(n domain.NetworkSummary) NetworkSummary {
+	out := NetworkSummary{
+		Chain:        Chain(n.Chain),
+		Network:      Network(n.Network),
+		AddressCount: len(n.Addresses),
+	}
+	if b := n.Balance; b != nil {
+		out.ConfirmedBalance = &b.Confirmed
+		out.UnconfirmedBalance = &b.Unconfirmed
+		out.UtxoCount = &b.UTXOs
+	}
+	return out
+}
@@ -0,0 +1,254 @@
+package restv1
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/label"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/jaeger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// ExportUserData sends a ZIP archive of everything stored for the
+// requesting user.
+func (s *impl) ExportUserData(
+	w http.ResponseWriter,
+	r *http.Request,
+	params ExportUserDataParams,
+) {
+	d, err := s.userData.ExportUserData(r.Context(), params.XUserID)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		`attachment; filename="utxo-tracker-export.zip"`)
+	w.WriteHeader(http.StatusOK)
+	// Failures past this point can only cut the archive short, which
+	// the client notices when reading it.
+	if err := s.writeExport(w, params.XUserID, d, time.Now()); err != nil {
+		s.log.WarnContext(r.Context(), "Failed to write data export",
+			"error", err)
+	}
+}
+
+// writeExport writes the files of a data export as described in the
+// API specification.
+func (s *impl) writeExport(w http.ResponseWriter, userID string,
+	d domain.UserData, now time.Time) error {
+	zw := zip.NewWriter(w)
+	add := func(name string, v any) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	accounts := AccountList{Accounts: make([]Account, 0, len(d.Accounts))}
+	for _, a := range d.Accounts {
+		accounts.Accounts = append(accounts.Accounts,
+			toAPIAccount(a, domain.RoleOwner))
+	}
+	members := MemberList{Members: make([]Member, 0, len(d.Members))}
+	for _, m := range d.Members {
+		members.Members = append(members.Members, toAPIMember(m))
+	}
+	memberships := InvitationList{
+		Invitations: make([]Member, 0, len(d.Memberships))}
+	for _, m := range d.Memberships {
+		memberships.Invitations = append(memberships.Invitations,
+			toAPIMember(m))
+	}
+	portfolios := PortfolioList{
+		Portfolios: make([]Portfolio, 0, len(d.Portfolios))}
+	for _, p := range d.Portfolios {
+		portfolios.Portfolios = append(portfolios.Portfolios,
+			toAPIPortfolio(p))
+	}
+	manifest := struct {
+		UserID     string    `json:"userId"`
+		ExportedAt time.Time `json:"exportedAt"`
+	}{userID, now.UTC()}
+	for _, f := range []struct {
+		name string
+		v    any
+	}{
+		{"manifest.json", manifest},
+		{"accounts.json", accounts},
+		{"members.json", members},
+		{"memberships.json", memberships},
+		{"portfolios.json", portfolios},
+	} {
+		if err := add(f.name, f.v); err != nil {
+			return err
+		}
+	}
+	audit := make(map[string][]domain.AuditEntry)
+	for _, e := range d.Audit {
+		audit[e.AccountID] = append(audit[e.AccountID], e)
+	}
+	heads := make(map[string]*domain.AuditHead)
+	for i, h := range d.AuditHeads {
+		heads[h.AccountID] = &d.AuditHeads[i]
+	}
+	// The chains of purged accounts follow the ones of the accounts
+	ids := make([]string, 0, len(d.Accounts))
+	seen := make(map[string]bool)
+	for _, a := range d.Accounts {
+		f, err := zw.Create("labels/" + a.ID + ".jsonl")
+		if err != nil {
+			return err
+		}
+		if err := label.Write(f, a.Labels); err != nil {
+			return err
+		}
+		ids = append(ids, a.ID)
+		seen[a.ID] = true
+	}
+	for _, e := range d.Audit {
+		if !seen[e.AccountID] {
+			ids = append(ids, e.AccountID)
+			seen[e.AccountID] = true
+		}
+	}
+	for _, id := range ids {
+		b := domain.VerifyAuditChain(audit[id], heads[id], s.auditKey)
+		err := add("audit/"+id+".json", toAPIAuditLog(audit[id], b))
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// EraseUserData starts erasing everything stored for the requesting
+// user in the background.
+func (s *impl) EraseUserData(
+	w http.ResponseWriter,
+	r *http.Request,
+	params EraseUserDataParams,
+) {
+	e := domain.NewErasure(params.XUserID, time.Now())
+	if err := s.erasures.CreateErasure(r.Context(), e); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	go s.erase(r.Context(), e)
+	w.Header().Set("Location", r.URL.Path+"/erasures/"+e.ID)
+	writeJSON(w, http.StatusAccepted, s.toAPIErasure(e))
+}
+
+// GetErasure reports the progress of an erasure of the requesting
+// user's data.
+func (s *impl) GetErasure(
+	w http.ResponseWriter,
+	r *http.Request,
+	erasureId string,
+	params GetErasureParams,
+) {
+	e, err := s.erasures.GetErasure(r.Context(), params.XUserID, erasureId)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.toAPIErasure(e))
+}
+
+// erase runs an erasure requested by the request in ctx. It runs in a
+// span of its own, so it outlives the request and shows up as a trace
+// of its own. An erasure this process does not get to finish is taken
+// over once its lease ran out, see domain.ErasureLease.
+func (s *impl) erase(ctx context.Context, e domain.Erasure) {
+	ctx, span := jaeger.StartJob(ctx, "erase user data")
+	defer span.End()
+	span.SetAttributes(attribute.String("erasure.id", e.ID))
+
+	e, ok, err := domain.RunErasure(ctx, s.erasures, s.userData, e)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "erasure failed")
+		s.log.ErrorContext(ctx, "Failed to erase user data",
+			"erasure", e.ID, "status", e.Status, "error", err)
+	}
+	if ok && e.Status == domain.ErasureCompleted {
+		s.requests.forget(e.UserID)
+	}
+}
+
+func (s *impl) toAPIErasure(e domain.Erasure) Erasure {
+	out := Erasure{
+		Id:          e.ID,
+		Status:      ErasureStatus(e.Status),
+		RequestedAt: e.RequestedAt,
+		CompletedAt: e.CompletedAt,
+	}
+	if e.Status == domain.ErasureCompleted {
+		r := s.receipts.sign(e)
+		out.Receipt = &r
+	}
+	return out
+}
+
+// receiptSigner signs the receipts of completed erasures. All replicas
+// must share the key for receipts to verify across them.
+type receiptSigner struct {
+	key []byte
+}
+
+// receiptPayload is what the signature of a receipt covers. The order of
+// the fields is part of the API.
+type receiptPayload struct {
+	ErasureID   string    `json:"erasureId"`
+	UserID      string    `json:"userId"`
+	RequestedAt time.Time `json:"requestedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	Erased      struct {
+		Accounts        int `json:"accounts"`
+		Portfolios      int `json:"portfolios"`
+		Memberships     int `json:"memberships"`
+		IdempotencyKeys int `json:"idempotencyKeys"`
+		AuditEntries    int `json:"auditEntries"`
+	} `json:"erased"`
+}
+
+func (c receiptSigner) sign(e domain.Erasure) ErasureReceipt {
+	p := receiptPayload{
+		ErasureID:   e.ID,
+		UserID:      e.UserID,
+		RequestedAt: e.RequestedAt.UTC(),
+		CompletedAt: e.CompletedAt.UTC(),
+	}
+	p.Erased.Accounts = e.Erased.Accounts
+	p.Erased.Portfolios = e.Erased.Portfolios
+	p.Erased.Memberships = e.Erased.Memberships
+	p.Erased.IdempotencyKeys = e.Erased.IdempotencyKeys
+	p.Erased.AuditEntries = e.Erased.AuditEntries
+	b, _ := json.Marshal(p)
+	m := hmac.New(sha256.New, c.key)
+	m.Write(b)
+	return ErasureReceipt{
+		ErasureId:   p.ErasureID,
+		UserId:      p.UserID,
+		RequestedAt: p.RequestedAt,
+		CompletedAt: p.CompletedAt,
+		Erased: ErasedData{
+			Accounts:        p.Erased.Accounts,
+			Portfolios:      p.Erased.Portfolios,
+			Memberships:     p.Erased.Memberships,
+			IdempotencyKeys: p.Erased.IdempotencyKeys,
+			AuditEntries:    p.Erased.AuditEntries,
+		},
+		Signature: base64.RawURLEncoding.EncodeToString(m.Sum(nil)),
+	}
+}
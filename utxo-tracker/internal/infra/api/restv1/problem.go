@@ -0,0 +1,120 @@
+package restv1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+// writeJSON sends v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeProblem sends an RFC 9457 problem response.
+func writeProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+func newProblem(status int, detail string) Problem {
+	p := Problem{Status: status, Title: http.StatusText(status)}
+	if detail != "" {
+		p.Detail = &detail
+	}
+	return p
+}
+
+func withViolations(p Problem, vs []domain.Violation) Problem {
+	out := make([]Violation, 0, len(vs))
+	for _, v := range vs {
+		pv := Violation{Field: v.Field, Message: v.Message}
+		if v.Value != "" {
+			pv.Value = &v.Value
+		}
+		out = append(out, pv)
+	}
+	p.Violations = &out
+	return p
+}
+
+// errorWriter writes the problem response matching a domain error.
+func errorWriter(log *slog.Logger) func(
+	w http.ResponseWriter, r *http.Request, err error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		writeProblem(w, problemFor(r.Context(), log, r.URL.Path, err))
+	}
+}
+
+// problemFor maps a domain error onto a problem. Errors it does not know
+// about are logged and reported as 500 without details.
+func problemFor(ctx context.Context, log *slog.Logger, path string,
+	err error) Problem {
+	var (
+		verr *domain.ValidationError
+		terr *domain.TrackedAddressError
+		qerr *domain.QuotaExceededError
+	)
+	switch {
+	case errors.As(err, &qerr):
+		status := http.StatusForbidden
+		if qerr.RetryAfter > 0 {
+			status = http.StatusTooManyRequests
+		}
+		p := newProblem(status, qerr.Error())
+		p.Quota = &QuotaLimit{
+			Resource: QuotaLimitResource(qerr.Resource),
+			Limit:    qerr.Limit,
+			Used:     qerr.Used,
+		}
+		return p
+	case errors.As(err, &verr):
+		return withViolations(
+			newProblem(http.StatusBadRequest, verr.Error()),
+			verr.Violations)
+	case errors.As(err, &terr):
+		return withViolations(
+			newProblem(http.StatusConflict, terr.Error()),
+			terr.Violations())
+	case errors.Is(err, domain.ErrPermissionDenied):
+		return newProblem(http.StatusForbidden, err.Error())
+	case errors.Is(err, domain.ErrAccountNotFound),
+		errors.Is(err, domain.ErrMemberNotFound),
+		errors.Is(err, domain.ErrAddressNotTracked),
+		errors.Is(err, domain.ErrPortfolioNotFound),
+		errors.Is(err, domain.ErrErasureNotFound):
+		return newProblem(http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrDuplicateAccount),
+		errors.Is(err, domain.ErrDuplicatePortfolio),
+		errors.Is(err, domain.ErrDuplicateMember),
+		errors.Is(err, domain.ErrIdempotencyKeyInUse):
+		return newProblem(http.StatusConflict, err.Error())
+	case errors.Is(err, domain.ErrUnknownMember):
+		return newProblem(http.StatusBadRequest, err.Error())
+	case errors.Is(err, domain.ErrChainUnavailable):
+		log.WarnContext(ctx, "Chain source failed", "path", path,
+			"error", err)
+		return newProblem(http.StatusBadGateway,
+			domain.ErrChainUnavailable.Error())
+	case errors.Is(err, domain.ErrIdempotencyKeyReused):
+		return newProblem(http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, domain.ErrVersionMismatch):
+		return newProblem(http.StatusPreconditionFailed, err.Error())
+	default:
+		log.ErrorContext(ctx, "Request failed", "path", path, "error", err)
+		return newProblem(http.StatusInternalServerError, "")
+	}
+}
+
+// paramErrorWriter reports request parameter errors raised by the
+// generated router wrapper as 400 problems.
+func paramErrorWriter(w http.ResponseWriter, _ *http.Request, err error) {
+	writeProblem(w, newProblem(http.StatusBadRequest, err.Error()))
+}
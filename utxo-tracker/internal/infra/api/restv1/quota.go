@@ -0,0 +1,124 @@
+package restv1
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+// WithQuota enforces q on the requesting users. Storage limits are
+// checked on every account write, unless the accounts passed to
+// NewHandler are a domain.QuotaEnforcer already. The request rate is
+// counted per replica, so each replica allows q.RequestsPerMinute.
+func WithQuota(q domain.Quota) Option {
+	return func(s *impl) {
+		s.quota = q
+	}
+}
+
+// requestCounter counts the requests of each user in the current
+// minute.
+type requestCounter struct {
+	mu     sync.Mutex
+	minute time.Time
+	counts map[string]int
+}
+
+// take counts a request of the user at now unless it would exceed the
+// rate limit of q.
+func (c *requestCounter) take(userID string, now time.Time, q domain.Quota,
+) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.window(now)[userID]
+	err := q.CheckRequests(n, c.minute.Add(time.Minute).Sub(now))
+	if err == nil {
+		c.counts[userID] = n + 1
+	}
+	return err
+}
+
+// used returns the requests the user made in the minute of now.
+func (c *requestCounter) used(userID string, now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.window(now)[userID]
+}
+
+// forget drops the count of the user.
+func (c *requestCounter) forget(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.counts, userID)
+}
+
+// window returns the counts of the minute of now. All users share the
+// window, so a new minute resets every count. It must be called with
+// the lock held.
+func (c *requestCounter) window(now time.Time) map[string]int {
+	if m := now.Truncate(time.Minute); !m.Equal(c.minute) {
+		c.minute = m
+		c.counts = make(map[string]int)
+	}
+	return c.counts
+}
+
+// limitRequests rejects requests of users over their request rate. The
+// generated wrappers run it once the parameters are bound, so
+// operations taking an X-User-ID have already rejected a missing, empty
+// or repeated one with 400. Requests without a user, which only reach
+// operations that need none, are not limited rather than sharing a
+// count.
+func (s *impl) limitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get("X-User-ID")
+		if userID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		err := s.requests.take(userID, time.Now(), s.quota)
+		var qerr *domain.QuotaExceededError
+		if errors.As(err, &qerr) {
+			secs := int(math.Ceil(qerr.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			s.fail(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetQuota reports the usage of the requesting user against the quota.
+func (s *impl) GetQuota(
+	w http.ResponseWriter,
+	r *http.Request,
+	params GetQuotaParams,
+) {
+	u, err := s.accounts.AccountUsage(r.Context(), params.XUserID)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	requests := s.requests.used(params.XUserID, time.Now())
+	writeJSON(w, http.StatusOK, Quota{
+		Accounts: quotaUsage(s.quota.MaxAccounts, u.Accounts),
+		AddressesPerAccount: quotaUsage(
+			s.quota.MaxAddressesPerAccount, u.LargestAccount),
+		Addresses: quotaUsage(s.quota.MaxAddresses, u.Addresses),
+		RequestsPerMinute: quotaUsage(
+			s.quota.RequestsPerMinute, requests),
+	})
+}
+
+func quotaUsage(limit, used int) QuotaUsage {
+	q := QuotaUsage{Used: used}
+	if limit > 0 {
+		q.Limit = &limit
+	}
+	return q
+}
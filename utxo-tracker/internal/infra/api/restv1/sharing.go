@@ -0,0 +1,318 @@
+package restv1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+// authorize returns an account the user owns or is an active member of,
+// along with their role, if the role permits what need permits.
+// Accounts the user cannot see at all are reported as not found.
+func (s *impl) authorize(ctx context.Context, userID, accountID string,
+	need domain.Role) (domain.Account, domain.Role, error) {
+	a, err := s.accounts.GetAccount(ctx, userID, accountID)
+	role := domain.RoleOwner
+	if errors.Is(err, domain.ErrAccountNotFound) && s.members != nil {
+		a, role, err = s.members.GetSharedAccount(ctx, userID, accountID)
+	}
+	if err != nil {
+		return domain.Account{}, "", err
+	}
+	if !role.Allows(need) {
+		return domain.Account{}, "", domain.ErrPermissionDenied
+	}
+	return a, role, nil
+}
+
+// roles returns the role of the user on each of the given accounts by
+// account ID.
+func (s *impl) roles(ctx context.Context, userID string,
+	as []domain.Account) (map[string]domain.Role, error) {
+	out := make(map[string]domain.Role, len(as))
+	shared := false
+	for _, a := range as {
+		if a.OwnerID == userID {
+			out[a.ID] = domain.RoleOwner
+		} else {
+			shared = true
+		}
+	}
+	if !shared || s.members == nil {
+		return out, nil
+	}
+	ms, err := s.members.ListMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range ms {
+		if _, ok := out[m.AccountID]; !ok && !m.Pending() {
+			out[m.AccountID] = m.Role
+		}
+	}
+	return out, nil
+}
+
+// GetAccountMembers lists the owner and the members of an account.
+func (s *impl) GetAccountMembers(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params GetAccountMembersParams,
+) {
+	a, _, err := s.authorize(r.Context(), params.XUserID, accountId,
+		domain.RoleViewer)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	list := MemberList{Members: []Member{{
+		AccountId: a.ID,
+		UserId:    a.OwnerID,
+		Role:      Role(domain.RoleOwner),
+		Status:    Active,
+	}}}
+	if s.members != nil {
+		ms, err := s.members.ListMembers(r.Context(), a.ID)
+		if err != nil {
+			s.fail(w, r, err)
+			return
+		}
+		for _, m := range ms {
+			list.Members = append(list.Members, toAPIMember(m))
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// InviteAccountMember invites a user to share an account of the
+// requesting user. Retries carrying the same Idempotency-Key get the
+// first response.
+func (s *impl) InviteAccountMember(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params InviteAccountMemberParams,
+) {
+	s.idempotent(w, r, params.XUserID, params.IdempotencyKey,
+		func(w http.ResponseWriter, r *http.Request) {
+			s.inviteAccountMember(w, r, accountId, params)
+		})
+}
+
+func (s *impl) inviteAccountMember(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params InviteAccountMemberParams,
+) {
+	var req InvitationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	a, _, err := s.authorize(r.Context(), params.XUserID, accountId,
+		domain.RoleOwner)
+	if err == nil && s.members == nil {
+		err = domain.ErrPermissionDenied
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	m, err := domain.NewInvitation(
+		a, req.UserId, domain.Role(req.Role), time.Now())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	e := auditEntry(r.Context(), params.XUserID, a.ID, domain.AuditShare,
+		domain.MemberChanges(nil, &m))
+	if err := s.members.AddMember(r.Context(), m, e); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path,
+		"invitations")+"members/"+m.UserID)
+	writeJSON(w, http.StatusCreated, toAPIMember(m))
+}
+
+// DeleteAccountMember removes a member or invitation. The owner may
+// remove anyone else and members may remove themselves.
+func (s *impl) DeleteAccountMember(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	userId string,
+	params DeleteAccountMemberParams,
+) {
+	need := domain.RoleOwner
+	if userId == params.XUserID {
+		need = domain.RoleViewer
+	}
+	a, _, err := s.authorize(r.Context(), params.XUserID, accountId, need)
+	if err == nil && userId == a.OwnerID {
+		var v domain.ValidationError
+		v.Add("userId", userId, "is the owner of the account")
+		err = &v
+	}
+	var m domain.Member
+	if err == nil {
+		m, err = s.member(r.Context(), a.ID, userId)
+	}
+	if err == nil {
+		e := auditEntry(r.Context(), params.XUserID, a.ID,
+			domain.AuditUnshare, domain.MemberChanges(&m, nil))
+		err = s.members.RemoveMember(r.Context(), a.ID, userId, e)
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetInvitations lists the pending invitations of the requesting user.
+func (s *impl) GetInvitations(
+	w http.ResponseWriter,
+	r *http.Request,
+	params GetInvitationsParams,
+) {
+	list := InvitationList{Invitations: []Member{}}
+	ms, err := s.invitations(r.Context(), params.XUserID)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	for _, m := range ms {
+		list.Invitations = append(list.Invitations, toAPIMember(m))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// AcceptInvitation makes the requesting user an active member of the
+// account they were invited to. Retries carrying the same
+// Idempotency-Key get the first response.
+func (s *impl) AcceptInvitation(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params AcceptInvitationParams,
+) {
+	s.idempotent(w, r, params.XUserID, params.IdempotencyKey,
+		func(w http.ResponseWriter, r *http.Request) {
+			s.acceptInvitation(w, r, accountId, params)
+		})
+}
+
+func (s *impl) acceptInvitation(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params AcceptInvitationParams,
+) {
+	invited, err := s.invitation(r.Context(), params.XUserID, accountId)
+	m := invited.Accept(time.Now())
+	if err == nil {
+		e := auditEntry(r.Context(), params.XUserID, accountId,
+			domain.AuditJoin, domain.MemberChanges(&invited, &m))
+		err = s.members.AcceptInvitation(r.Context(), m, e)
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIMember(m))
+}
+
+// DeclineInvitation removes a pending invitation of the requesting user.
+func (s *impl) DeclineInvitation(
+	w http.ResponseWriter,
+	r *http.Request,
+	accountId string,
+	params DeclineInvitationParams,
+) {
+	m, err := s.invitation(r.Context(), params.XUserID, accountId)
+	if err == nil {
+		e := auditEntry(r.Context(), params.XUserID, accountId,
+			domain.AuditUnshare, domain.MemberChanges(&m, nil))
+		err = s.members.RemoveMember(r.Context(), accountId,
+			params.XUserID, e)
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// member returns a member or invitation of an account.
+func (s *impl) member(ctx context.Context, accountID, userID string,
+) (domain.Member, error) {
+	if s.members == nil {
+		return domain.Member{}, domain.ErrMemberNotFound
+	}
+	ms, err := s.members.ListMembers(ctx, accountID)
+	if err != nil {
+		return domain.Member{}, err
+	}
+	for _, m := range ms {
+		if m.UserID == userID {
+			return m, nil
+		}
+	}
+	return domain.Member{}, domain.ErrMemberNotFound
+}
+
+// invitations returns the pending invitations of the user.
+func (s *impl) invitations(ctx context.Context, userID string,
+) ([]domain.Member, error) {
+	if s.members == nil {
+		return nil, nil
+	}
+	ms, err := s.members.ListMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := ms[:0]
+	for _, m := range ms {
+		if m.Pending() {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// invitation returns the pending invitation of the user to an account.
+func (s *impl) invitation(ctx context.Context, userID, accountID string,
+) (domain.Member, error) {
+	ms, err := s.invitations(ctx, userID)
+	if err != nil {
+		return domain.Member{}, err
+	}
+	for _, m := range ms {
+		if m.AccountID == accountID {
+			return m, nil
+		}
+	}
+	return domain.Member{}, domain.ErrMemberNotFound
+}
+
+func toAPIMember(m domain.Member) Member {
+	out := Member{
+		AccountId:  m.AccountID,
+		UserId:     m.UserID,
+		Role:       Role(m.Role),
+		Status:     Active,
+		InvitedBy:  &m.InvitedBy,
+		InvitedAt:  &m.InvitedAt,
+		AcceptedAt: m.AcceptedAt,
+	}
+	if m.Pending() {
+		out.Status = Invited
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package restv1
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+)
+
+// CreateAccountFromWalletFile creates an account from an Electrum,
+// Sparrow or Bitcoin Core wallet export.
+func (s *impl) CreateAccountFromWalletFile(
+	w http.ResponseWriter,
+	r *http.Request,
+	params CreateAccountFromWalletFileParams,
+) {
+	s.idempotent(w, r, params.XUserID, params.IdempotencyKey,
+		func(w http.ResponseWriter, r *http.Request) {
+			s.createWalletAccount(w, r, params)
+		})
+}
+
+func (s *impl) createWalletAccount(
+	w http.ResponseWriter,
+	r *http.Request,
+	params CreateAccountFromWalletFileParams,
+) {
+	if !requireContentType(w, r, "application/json") {
+		return
+	}
+	// The file is kept out of every error and log, as it may hold
+	// private keys
+	file, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest,
+			"failed to read request body: "+err.Error()))
+		return
+	}
+	a, err := domain.NewWalletAccount(params.XUserID, deref(params.Name),
+		address.Chain(deref(params.Chain)), file, time.Now())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	a = s.discover(r.Context(), a)
+	e := auditEntry(r.Context(), params.XUserID, a.ID, domain.AuditCreate,
+		domain.AccountChanges(nil, a))
+	if err := s.accounts.CreateAccount(r.Context(), a, e); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path,
+		":from-wallet-file")+"/"+a.ID)
+	writeJSON(w, http.StatusCreated, toAPIAccount(a, domain.RoleOwner))
+}
@@ -3,9 +3,12 @@ package env
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hannesdejager/utxo-tracker/internal/app/config"
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
 )
 
 // HTTPConfig loads HTTP server config.
@@ -38,6 +41,79 @@ func TracingConfig() config.Tracing {
 	}
 }
 
+// DatabaseConfig loads the account database configuration from
+// the environment
+func DatabaseConfig() config.Database {
+	life := asIntOrDef("POSTGRES_MAX_CONN_LIFETIME", 3600)
+	idle := asIntOrDef("POSTGRES_MAX_CONN_IDLE_TIME", 600)
+	return config.Database{
+		PostgresDSN: os.Getenv("POSTGRES_DSN"),
+		SQLitePath:  os.Getenv("SQLITE_PATH"),
+		Pool: config.DatabasePool{
+			MaxConns:        asIntOrDef("POSTGRES_MAX_CONNS", 10),
+			MinConns:        asIntOrDef("POSTGRES_MIN_CONNS", 1),
+			MaxConnLifetime: time.Duration(life) * time.Second,
+			MaxConnIdleTime: time.Duration(idle) * time.Second,
+		},
+	}
+}
+
+// EncryptionConfig loads the encryption at rest configuration from the
+// environment
+func EncryptionConfig() config.Encryption {
+	return config.Encryption{
+		KeyFile:         os.Getenv("KMS_KEY_FILE"),
+		AuditSigningKey: os.Getenv("AUDIT_SIGNING_KEY"),
+	}
+}
+
+// APIConfig loads the REST API configuration from the environment
+func APIConfig() config.API {
+	ttl := asIntOrDef("API_IDEMPOTENCY_TTL", 86400)
+	retention := asIntOrDef("ACCOUNT_RETENTION", 30*86400)
+	return config.API{
+		CursorSigningKey:  os.Getenv("API_CURSOR_SIGNING_KEY"),
+		ReceiptSigningKey: os.Getenv("API_RECEIPT_SIGNING_KEY"),
+		IdempotencyTTL:    time.Duration(ttl) * time.Second,
+		Quota: domain.Quota{
+			MaxAccounts: asIntOrDef("QUOTA_MAX_ACCOUNTS", 100),
+			MaxAddressesPerAccount: asIntOrDef(
+				"QUOTA_MAX_ADDRESSES_PER_ACCOUNT", 1000),
+			MaxAddresses: asIntOrDef("QUOTA_MAX_ADDRESSES", 10000),
+			RequestsPerMinute: asIntOrDef(
+				"QUOTA_REQUESTS_PER_MINUTE", 600),
+		},
+		AccountRetention: time.Duration(retention) * time.Second,
+	}
+}
+
+// ChainConfig loads the chain source configuration from the
+// environment. Bitcoin networks are read from ESPLORA_<NETWORK>_URL and
+// the networks of other chains from ESPLORA_<CHAIN>_<NETWORK>_URL.
+func ChainConfig() config.Chain {
+	urls := make(map[address.Chain]map[address.Network]string)
+	for _, p := range address.Registry() {
+		key := "ESPLORA_" + strings.ToUpper(string(p.Network)) + "_URL"
+		if p.Chain != address.Bitcoin {
+			key = "ESPLORA_" + strings.ToUpper(string(p.Chain)) + "_" +
+				strings.ToUpper(string(p.Network)) + "_URL"
+		}
+		if v := os.Getenv(key); v != "" {
+			if urls[p.Chain] == nil {
+				urls[p.Chain] = make(map[address.Network]string)
+			}
+			urls[p.Chain][p.Network] = v
+		}
+	}
+	timeout := asIntOrDef("ESPLORA_TIMEOUT", 10)
+	rescan := asIntOrDef("DERIVATION_RESCAN_INTERVAL", 600)
+	return config.Chain{
+		EsploraURLs:    urls,
+		Timeout:        time.Duration(timeout) * time.Second,
+		RescanInterval: time.Duration(rescan) * time.Second,
+	}
+}
+
 func asIntOrDef(key string, defaultVal int) int {
 	valueStr := os.Getenv(key)
 	if value, err := strconv.Atoi(valueStr); err == nil {
@@ -0,0 +1,157 @@
+// Package esplora reads address state from Esplora compatible HTTP APIs,
+// such as the ones of blockstream.info, mempool.space and
+// litecoinspace.org.
+package esplora
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxConcurrent bounds the requests made at once for a single call, to
+// stay within the rate limits of public instances.
+const maxConcurrent = 8
+
+// Client is a domain.ChainSource backed by Esplora instances.
+type Client struct {
+	http *http.Client
+	// urls holds the API base URL per network of each chain
+	urls map[address.Chain]map[address.Network]string
+}
+
+// NewClient returns a Client that uses the API at urls[c][n] for network
+// n of chain c. Networks without a URL are reported with
+// domain.ErrNoChainSource.
+func NewClient(urls map[address.Chain]map[address.Network]string,
+	timeout time.Duration) *Client {
+	return &Client{
+		http: &http.Client{Timeout: timeout},
+		urls: urls,
+	}
+}
+
+var _ domain.ChainSource = (*Client)(nil)
+
+// AddressBalances implements domain.ChainSource.
+func (c *Client) AddressBalances(ctx context.Context, ch address.Chain,
+	n address.Network, addrs []string,
+) (map[string]domain.AddressBalance, error) {
+	base, ok := c.urls[ch][n]
+	if !ok || base == "" {
+		return nil, domain.ErrNoChainSource
+	}
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		out   = make(map[string]domain.AddressBalance, len(addrs))
+		first error
+		sem   = make(chan struct{}, maxConcurrent)
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, addr := range addrs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			b, err := c.addressBalance(ctx, ch, n, base, addr)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if first == nil {
+					first = err
+					cancel()
+				}
+				return
+			}
+			out[addr] = b
+		}()
+	}
+	wg.Wait()
+	if first != nil {
+		return nil, first
+	}
+	return out, nil
+}
+
+// stats are the funding statistics Esplora reports for an address.
+type stats struct {
+	FundedTxoCount int   `json:"funded_txo_count"`
+	FundedTxoSum   int64 `json:"funded_txo_sum"`
+	SpentTxoCount  int   `json:"spent_txo_count"`
+	SpentTxoSum    int64 `json:"spent_txo_sum"`
+}
+
+func (c *Client) addressBalance(ctx context.Context, ch address.Chain,
+	n address.Network, base, addr string) (domain.AddressBalance, error) {
+	ctx, span := otel.Tracer("esplora").Start(ctx, "esplora GET address",
+		trace.WithSpanKind(trace.SpanKindClient),
+		// The address is left out, traces outlive the erasure of the
+		// users it belongs to.
+		trace.WithAttributes(
+			attribute.String("chain.name", string(ch)),
+			attribute.String("chain.network", string(n))))
+	defer span.End()
+
+	var res struct {
+		ChainStats   stats `json:"chain_stats"`
+		MempoolStats stats `json:"mempool_stats"`
+	}
+	u := strings.TrimSuffix(base, "/") + "/address/" + url.PathEscape(addr)
+	if err := c.get(ctx, u, &res); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return domain.AddressBalance{}, err
+	}
+	cs, ms := res.ChainStats, res.MempoolStats
+	return domain.AddressBalance{
+		Confirmed:   cs.FundedTxoSum - cs.SpentTxoSum,
+		Unconfirmed: ms.FundedTxoSum - ms.SpentTxoSum,
+		UTXOs: cs.FundedTxoCount - cs.SpentTxoCount +
+			ms.FundedTxoCount - ms.SpentTxoCount,
+		Used: cs.FundedTxoCount+ms.FundedTxoCount > 0,
+	}, nil
+}
+
+func (c *Client) get(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// The URL holds the address, keep it out of errors and spans
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return fmt.Errorf("%w: %w", domain.ErrChainUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: esplora returned %s: %s",
+			domain.ErrChainUnavailable, resp.Status,
+			strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: failed to decode esplora response: %w",
+			domain.ErrChainUnavailable, err)
+	}
+	return nil
+}
@@ -6,14 +6,19 @@ import (
 
 	"github.com/hannesdejager/utxo-tracker/internal/app/config"
 	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 )
 
-func InitTracing(c config.Tracing, info domain.ServiceInstance) (
+// InitTracing installs a tracer provider that exports to the endpoint in
+// c. The resource names the chain networks chain has a source for.
+func InitTracing(c config.Tracing, chain config.Chain,
+	info domain.ServiceInstance) (
 	*trace.TracerProvider,
 	error,
 ) {
@@ -37,9 +42,23 @@ func InitTracing(c config.Tracing, info domain.ServiceInstance) (
 			semconv.ServiceNamespaceKey.String("utxo-tracker"),
 			semconv.ServiceVersionKey.String(
 				info.Version.CommitShortHash),
+			attribute.StringSlice("chain.networks",
+				chainNetworks(chain)),
 		)),
 	)
 	otel.SetTracerProvider(tp)
 
 	return tp, nil
 }
+
+// chainNetworks lists the networks chain has a source for, each as
+// chain/network.
+func chainNetworks(chain config.Chain) []string {
+	var out []string
+	for _, p := range address.Registry() {
+		if chain.EsploraURLs[p.Chain][p.Network] != "" {
+			out = append(out, string(p.Chain)+"/"+string(p.Network))
+		}
+	}
+	return out
+}
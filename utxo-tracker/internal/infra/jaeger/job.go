@@ -0,0 +1,20 @@
+package jaeger
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartJob starts the span of background work requested by the request
+// in ctx. The span starts a trace of its own that links to the request,
+// and the returned context is not cancelled along with the request.
+func StartJob(ctx context.Context, name string,
+) (context.Context, trace.Span) {
+	return otel.Tracer("account-service").Start(
+		context.WithoutCancel(ctx), name,
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+	)
+}
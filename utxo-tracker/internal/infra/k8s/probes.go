@@ -1,9 +1,27 @@
 package k8s
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"time"
+)
 
-func ReadinessProbe() http.HandlerFunc {
+// Check reports whether a dependency of the service is usable.
+type Check func(ctx context.Context) error
+
+// ReadinessProbe responds with 503 while any of the checks fail so that
+// Kubernetes stops routing traffic to the pod.
+func ReadinessProbe(checks ...Check) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		for _, c := range checks {
+			if err := c(ctx); err != nil {
+				http.Error(w, err.Error(),
+					http.StatusServiceUnavailable)
+				return
+			}
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
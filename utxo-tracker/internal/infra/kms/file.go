@@ -0,0 +1,121 @@
+package kms
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// File is a Service whose key-encryption keys are read from a local
+// file. Each line holds a version and a base64 encoded 32 byte key,
+// separated by white space, such as
+//
+//	v1 mrK0b5ndJ5s0t+Fc4jJ1u3Wb1m4Xbq5M1hS0x3p2nQY=
+//
+// The key of the last line is the current one. Blank lines and lines
+// starting with # are skipped. A new key can be made with
+//
+//	echo "v2 $(head -c 32 /dev/urandom | base64)" >> keys
+type File struct {
+	keys    map[string]cipher.AEAD
+	current string
+}
+
+var _ Service = (*File)(nil)
+
+// OpenFile reads the keys of the file at path.
+func OpenFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	f := &File{keys: make(map[string]cipher.AEAD)}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// The key is left out of the errors, so that it is not logged
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf(
+				"line %d of the key file is not a version and a key", n)
+		}
+		version := fields[0]
+		if _, ok := f.keys[version]; ok {
+			return nil, fmt.Errorf(
+				"line %d of the key file repeats version %s", n, version)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf(
+				"line %d of the key file has no base64 encoded 32 byte key",
+				n)
+		}
+		f.keys[version], err = newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		f.current = version
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if f.current == "" {
+		return nil, errors.New("key file holds no key")
+	}
+	return f, nil
+}
+
+// Version implements Service.
+func (f *File) Version() string {
+	return f.current
+}
+
+// Wrap implements Service. The version is authenticated along with the
+// data key.
+func (f *File) Wrap(_ context.Context, dataKey []byte,
+) ([]byte, string, error) {
+	aead := f.keys[f.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(f.current)), f.current,
+		nil
+}
+
+// Unwrap implements Service.
+func (f *File) Unwrap(_ context.Context, wrapped []byte, version string,
+) ([]byte, error) {
+	aead, ok := f.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownVersion, version)
+	}
+	n := aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, errors.New("wrapped data key is truncated")
+	}
+	key, err := aead.Open(nil, wrapped[:n], wrapped[n:], []byte(version))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,34 @@
+// Package kms holds the key-encryption keys that wrap the data keys
+// sensitive fields are encrypted with at rest. Service is implemented by
+// key management services, File keeps the keys in a local file for
+// development and tests.
+//
+// Keys are rotated by adding a new version, restarting the service so
+// that new data keys are wrapped with it, and running
+// account-service rotate-keys to re-wrap the existing ones. Old versions
+// can be removed once no record uses them anymore.
+package kms
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnknownVersion is returned for data keys wrapped with a version of
+// the key-encryption key that is not known.
+var ErrUnknownVersion = errors.New("unknown key-encryption key version")
+
+// Service wraps data keys with a key-encryption key that never leaves
+// it.
+type Service interface {
+	// Version returns the version of the key-encryption key new data keys
+	// are wrapped with.
+	Version() string
+	// Wrap encrypts a data key with the current key-encryption key and
+	// returns it along with the version of that key.
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, string, error)
+	// Unwrap decrypts a data key wrapped with the given version of the
+	// key-encryption key.
+	Unwrap(ctx context.Context, wrapped []byte, version string,
+	) ([]byte, error)
+}
@@ -48,6 +48,16 @@ func NewLogger(i domain.ServiceInstance) *slog.Logger {
 	return log
 }
 
+// TraceID returns the ID of the trace in ctx, which CorrelationHandler
+// logs as trace_id, or "" if there is none.
+func TraceID(ctx context.Context) string {
+	s := trace.SpanFromContext(ctx).SpanContext()
+	if !s.HasTraceID() {
+		return ""
+	}
+	return s.TraceID().String()
+}
+
 type CorrelationHandler struct {
 	slog.Handler
 }
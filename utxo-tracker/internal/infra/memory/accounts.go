@@ -0,0 +1,363 @@
+// Package memory holds repository implementations that keep their data in
+// process memory. Nothing survives a restart and replicas do not share
+// state, so these are meant for local development.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+// Store is an in-memory domain.AccountRepository that is safe for
+// concurrent use.
+type Store struct {
+	mu       sync.RWMutex
+	accounts map[string]domain.Account
+	// deleted holds the deleted accounts until they are purged. They are
+	// in neither byOwner nor byAddress.
+	deleted map[string]domain.Account
+	// byOwner holds account IDs per owner in insertion order
+	byOwner map[string][]string
+	// byAddress holds the IDs of the accounts holding an address
+	byAddress map[addressKey]map[string]struct{}
+	// idempotency holds records by owner and idempotency key
+	idempotency map[idempotencyKey]domain.IdempotencyRecord
+	portfolios  map[string]domain.Portfolio
+	// portfoliosByOwner holds portfolio IDs per owner in insertion order
+	portfoliosByOwner map[string][]string
+	// members holds the members of each account in invitation order
+	members map[string][]domain.Member
+	// memberships holds the IDs of the accounts shared with each user
+	memberships map[string][]string
+	erasures    map[string]domain.Erasure
+	// audit holds the audit chain of each account
+	audit map[string][]domain.AuditEntry
+	// auditOwners holds the owner of the account of each audit chain,
+	// which outlives the account when it is purged
+	auditOwners map[string]string
+}
+
+// addressKey scopes an address to the owner tracking it.
+type addressKey struct {
+	ownerID string
+	address string
+}
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{
+		accounts:  make(map[string]domain.Account),
+		deleted:   make(map[string]domain.Account),
+		byOwner:   make(map[string][]string),
+		byAddress: make(map[addressKey]map[string]struct{}),
+		idempotency: make(
+			map[idempotencyKey]domain.IdempotencyRecord),
+		portfolios:        make(map[string]domain.Portfolio),
+		portfoliosByOwner: make(map[string][]string),
+		members:           make(map[string][]domain.Member),
+		memberships:       make(map[string][]string),
+		erasures:          make(map[string]domain.Erasure),
+		audit:             make(map[string][]domain.AuditEntry),
+		auditOwners:       make(map[string]string),
+	}
+}
+
+var _ domain.AccountRepository = (*Store)(nil)
+
+// CreateAccount implements domain.AccountRepository.
+func (s *Store) CreateAccount(_ context.Context, a domain.Account,
+	e domain.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[a.ID]; ok {
+		return domain.ErrDuplicateAccount
+	}
+	if _, ok := s.deleted[a.ID]; ok || s.nameTaken(a) {
+		return domain.ErrDuplicateAccount
+	}
+	s.accounts[a.ID] = clone(a)
+	s.byOwner[a.OwnerID] = append(s.byOwner[a.OwnerID], a.ID)
+	s.index(a)
+	s.appendAudit(e)
+	return nil
+}
+
+// GetAccount implements domain.AccountRepository.
+func (s *Store) GetAccount(_ context.Context, ownerID, id string,
+) (domain.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.accounts[id]
+	if !ok || a.OwnerID != ownerID {
+		return domain.Account{}, domain.ErrAccountNotFound
+	}
+	return clone(a), nil
+}
+
+// ListAccounts implements domain.AccountRepository.
+func (s *Store) ListAccounts(_ context.Context, q domain.AccountQuery,
+) ([]domain.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []domain.Account
+	for _, id := range s.byOwner[q.UserID] {
+		if a := s.accounts[id]; q.Matches(a) {
+			out = append(out, clone(a))
+		}
+	}
+	for _, id := range s.memberships[q.UserID] {
+		m := s.members[id][s.member(id, q.UserID)]
+		a, ok := s.accounts[id]
+		if ok && !m.Pending() && q.Matches(a) {
+			out = append(out, clone(a))
+		}
+	}
+	slices.SortFunc(out, func(a, b domain.Account) int {
+		return q.Compare(a.Position(), b.Position())
+	})
+	if len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+// UpdateAccount implements domain.AccountRepository.
+func (s *Store) UpdateAccount(_ context.Context, a domain.Account,
+	version int64, e domain.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkVersion(a.OwnerID, a.ID, version); err != nil {
+		return err
+	}
+	if s.nameTaken(a) {
+		return domain.ErrDuplicateAccount
+	}
+	s.unindex(s.accounts[a.ID])
+	s.accounts[a.ID] = clone(a)
+	s.index(a)
+	s.appendAudit(e)
+	return nil
+}
+
+// DeleteAccount implements domain.AccountRepository.
+func (s *Store) DeleteAccount(_ context.Context, a domain.Account,
+	version int64, e domain.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkVersion(a.OwnerID, a.ID, version); err != nil {
+		return err
+	}
+	s.unindex(s.accounts[a.ID])
+	delete(s.accounts, a.ID)
+	s.deleted[a.ID] = clone(a)
+	s.byOwner[a.OwnerID] = slices.DeleteFunc(
+		s.byOwner[a.OwnerID], func(v string) bool { return v == a.ID })
+	for _, pid := range s.portfoliosByOwner[a.OwnerID] {
+		if p, ok := s.portfolios[pid].RemoveAccount(a.ID); ok {
+			s.portfolios[pid] = p
+		}
+	}
+	s.appendAudit(e)
+	return nil
+}
+
+// GetDeletedAccount implements domain.AccountRepository.
+func (s *Store) GetDeletedAccount(_ context.Context, ownerID, id string,
+) (domain.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.deleted[id]
+	if !ok || a.OwnerID != ownerID {
+		return domain.Account{}, domain.ErrAccountNotFound
+	}
+	return clone(a), nil
+}
+
+// RestoreAccount implements domain.AccountRepository.
+func (s *Store) RestoreAccount(_ context.Context, a domain.Account,
+	version int64, e domain.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.deleted[a.ID]
+	if !ok || cur.OwnerID != a.OwnerID {
+		return domain.ErrAccountNotFound
+	}
+	if cur.Version != version {
+		return domain.ErrVersionMismatch
+	}
+	delete(s.deleted, a.ID)
+	s.accounts[a.ID] = clone(a)
+	s.byOwner[a.OwnerID] = append(s.byOwner[a.OwnerID], a.ID)
+	s.index(a)
+	s.appendAudit(e)
+	return nil
+}
+
+// PurgeDeletedAccounts implements domain.AccountRepository.
+func (s *Store) PurgeDeletedAccounts(_ context.Context, before time.Time,
+) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, a := range s.deleted {
+		if a.DeletedAt.Before(before) {
+			s.appendAudit(domain.NewAuditEntry(id, domain.AuditPurge,
+				domain.SystemActor, "", []domain.AuditChange{},
+				time.Now()))
+			delete(s.deleted, id)
+			s.removeMembers(id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ListDerivedAccounts implements domain.AccountRepository.
+func (s *Store) ListDerivedAccounts(_ context.Context,
+	after *domain.AccountPosition, limit int) ([]domain.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	q := domain.AccountQuery{OrderBy: domain.OrderByCreated}
+	var out []domain.Account
+	for _, a := range s.accounts {
+		if a.Derivation != nil &&
+			(after == nil || q.Compare(after, a.Position()) < 0) {
+			out = append(out, clone(a))
+		}
+	}
+	slices.SortFunc(out, func(x, y domain.Account) int {
+		return q.Compare(x.Position(), y.Position())
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// FindAddresses implements domain.AccountRepository.
+func (s *Store) FindAddresses(_ context.Context, ownerID string,
+	addrs ...string) ([]domain.AddressMatch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []domain.AddressMatch
+	for _, addr := range slices.Compact(slices.Sorted(slices.Values(addrs))) {
+		var found []domain.AddressMatch
+		for id := range s.byAddress[addressKey{ownerID, addr}] {
+			a := s.accounts[id]
+			found = append(found, domain.AddressMatch{
+				Address:        addr,
+				Account:        clone(a),
+				Index:          slices.Index(a.Addresses, addr),
+				DerivationPath: a.Path(addr),
+			})
+		}
+		slices.SortFunc(found, func(x, y domain.AddressMatch) int {
+			return cmp.Or(
+				x.Account.CreatedAt.Compare(y.Account.CreatedAt),
+				strings.Compare(x.Account.ID, y.Account.ID))
+		})
+		out = append(out, found...)
+	}
+	return out, nil
+}
+
+// AccountUsage implements domain.AccountRepository.
+func (s *Store) AccountUsage(_ context.Context, ownerID string,
+) (domain.Usage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := domain.Usage{Accounts: len(s.byOwner[ownerID])}
+	for _, id := range s.byOwner[ownerID] {
+		n := len(s.accounts[id].Addresses)
+		u.Addresses += n
+		u.LargestAccount = max(u.LargestAccount, n)
+	}
+	return u, nil
+}
+
+// nameTaken reports whether another account of the owner, deleted or
+// not, has the name of a. It must be called with the lock held.
+func (s *Store) nameTaken(a domain.Account) bool {
+	for _, id := range s.byOwner[a.OwnerID] {
+		if id != a.ID && s.accounts[id].Name == a.Name {
+			return true
+		}
+	}
+	for id, d := range s.deleted {
+		if id != a.ID && d.OwnerID == a.OwnerID && d.Name == a.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// index adds the addresses of a to byAddress. It must be called with
+// the lock held.
+func (s *Store) index(a domain.Account) {
+	for _, addr := range a.Addresses {
+		k := addressKey{a.OwnerID, addr}
+		if s.byAddress[k] == nil {
+			s.byAddress[k] = make(map[string]struct{})
+		}
+		s.byAddress[k][a.ID] = struct{}{}
+	}
+}
+
+// unindex removes the addresses of a from byAddress. It must be called
+// with the lock held.
+func (s *Store) unindex(a domain.Account) {
+	for _, addr := range a.Addresses {
+		k := addressKey{a.OwnerID, addr}
+		delete(s.byAddress[k], a.ID)
+		if len(s.byAddress[k]) == 0 {
+			delete(s.byAddress, k)
+		}
+	}
+}
+
+// checkVersion must be called with the lock held.
+func (s *Store) checkVersion(ownerID, id string, version int64) error {
+	cur, ok := s.accounts[id]
+	if !ok || cur.OwnerID != ownerID {
+		return domain.ErrAccountNotFound
+	}
+	if cur.Version != version {
+		return domain.ErrVersionMismatch
+	}
+	return nil
+}
+
+// clone copies the slices of an account so callers cannot modify stored
+// data through shared backing arrays.
+func clone(a domain.Account) domain.Account {
+	a.Addresses = slices.Clone(a.Addresses)
+	a.Tags = slices.Clone(a.Tags)
+	a.Labels = slices.Clone(a.Labels)
+	if a.DeletedAt != nil {
+		t := *a.DeletedAt
+		a.DeletedAt = &t
+	}
+	if a.Derivation != nil {
+		d := *a.Derivation
+		d.Addresses = slices.Clone(d.Addresses)
+		a.Derivation = &d
+	}
+	a.Descriptors = slices.Clone(a.Descriptors)
+	for i := range a.Descriptors {
+		d := &a.Descriptors[i]
+		d.Addresses = slices.Clone(d.Addresses)
+		d.Conditions = slices.Clone(d.Conditions)
+		if d.Multisig != nil {
+			m := *d.Multisig
+			m.Cosigners = slices.Clone(m.Cosigners)
+			d.Multisig = &m
+		}
+	}
+	return a
+}
@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+var _ domain.AuditRepository = (*Store)(nil)
+
+// appendAudit chains e to the last entry of its account and stores it.
+// The caller must hold the write lock.
+func (s *Store) appendAudit(e domain.AuditEntry) {
+	var prev *domain.AuditEntry
+	if es := s.audit[e.AccountID]; len(es) > 0 {
+		prev = &es[len(es)-1]
+	}
+	e = e.Chain(prev)
+	if a, ok := s.accounts[e.AccountID]; ok {
+		s.auditOwners[e.AccountID] = a.OwnerID
+	} else if a, ok := s.deleted[e.AccountID]; ok {
+		s.auditOwners[e.AccountID] = a.OwnerID
+	}
+	s.audit[e.AccountID] = append(s.audit[e.AccountID], cloneAudit(e))
+}
+
+// ListAudit implements domain.AuditRepository. Entries kept in memory
+// cannot be removed behind the store's back, so the head of a chain is
+// its last entry and is not signed.
+func (s *Store) ListAudit(_ context.Context, accountID string,
+) ([]domain.AuditEntry, *domain.AuditHead, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]domain.AuditEntry, 0, len(s.audit[accountID]))
+	for _, e := range s.audit[accountID] {
+		out = append(out, cloneAudit(e))
+	}
+	var head *domain.AuditHead
+	if n := len(out); n > 0 {
+		h := out[n-1].Head()
+		head = &h
+	}
+	return out, head, nil
+}
+
+func cloneAudit(e domain.AuditEntry) domain.AuditEntry {
+	e.Changes = slices.Clone(e.Changes)
+	return e
+}
@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+// idempotencyKey scopes an idempotency key to the owner using it.
+type idempotencyKey struct {
+	ownerID string
+	key     string
+}
+
+var _ domain.IdempotencyRepository = (*Store)(nil)
+
+// ReserveIdempotencyKey implements domain.IdempotencyRepository.
+func (s *Store) ReserveIdempotencyKey(_ context.Context,
+	rec domain.IdempotencyRecord, now time.Time,
+) (*domain.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{rec.OwnerID, rec.Key}
+	if cur, ok := s.idempotency[k]; ok && cur.ExpiresAt.After(now) {
+		cur = cloneRecord(cur)
+		return &cur, nil
+	}
+	s.idempotency[k] = cloneRecord(rec)
+	return nil, nil
+}
+
+// CompleteIdempotencyKey implements domain.IdempotencyRepository.
+func (s *Store) CompleteIdempotencyKey(_ context.Context,
+	rec domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{rec.OwnerID, rec.Key}
+	if _, ok := s.idempotency[k]; ok {
+		s.idempotency[k] = cloneRecord(rec)
+	}
+	return nil
+}
+
+// ExtendIdempotencyKey implements domain.IdempotencyRepository.
+func (s *Store) ExtendIdempotencyKey(_ context.Context,
+	rec domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{rec.OwnerID, rec.Key}
+	cur, ok := s.idempotency[k]
+	if ok && !cur.Completed() && cur.Fingerprint == rec.Fingerprint {
+		cur.ExpiresAt = rec.ExpiresAt
+		s.idempotency[k] = cur
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey implements domain.IdempotencyRepository.
+func (s *Store) ReleaseIdempotencyKey(_ context.Context,
+	ownerID, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.idempotency, idempotencyKey{ownerID, key})
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys implements domain.IdempotencyRepository.
+func (s *Store) DeleteExpiredIdempotencyKeys(_ context.Context,
+	now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.DeleteFunc(s.idempotency,
+		func(_ idempotencyKey, r domain.IdempotencyRecord) bool {
+			return !r.ExpiresAt.After(now)
+		})
+	return nil
+}
+
+func cloneRecord(r domain.IdempotencyRecord) domain.IdempotencyRecord {
+	r.Body = slices.Clone(r.Body)
+	if r.Header != nil {
+		h := make(map[string][]string, len(r.Header))
+		for k, v := range r.Header {
+			h[k] = slices.Clone(v)
+		}
+		r.Header = h
+	}
+	return r
+}
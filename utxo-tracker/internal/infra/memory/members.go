@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+var _ domain.MemberRepository = (*Store)(nil)
+
+// AddMember implements domain.MemberRepository.
+func (s *Store) AddMember(_ context.Context, m domain.Member,
+	e domain.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[m.AccountID]; !ok {
+		return domain.ErrAccountNotFound
+	}
+	if s.member(m.AccountID, m.UserID) >= 0 {
+		return domain.ErrDuplicateMember
+	}
+	s.members[m.AccountID] = append(s.members[m.AccountID], cloneMember(m))
+	s.memberships[m.UserID] = append(s.memberships[m.UserID], m.AccountID)
+	s.appendAudit(e)
+	return nil
+}
+
+// AcceptInvitation implements domain.MemberRepository.
+func (s *Store) AcceptInvitation(_ context.Context, m domain.Member,
+	e domain.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.member(m.AccountID, m.UserID)
+	if i < 0 || !s.members[m.AccountID][i].Pending() {
+		return domain.ErrMemberNotFound
+	}
+	s.members[m.AccountID][i].AcceptedAt = cloneMember(m).AcceptedAt
+	s.appendAudit(e)
+	return nil
+}
+
+// RemoveMember implements domain.MemberRepository.
+func (s *Store) RemoveMember(_ context.Context, accountID, userID string,
+	e domain.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.member(accountID, userID)
+	if i < 0 {
+		return domain.ErrMemberNotFound
+	}
+	s.members[accountID] = slices.Delete(s.members[accountID], i, i+1)
+	s.memberships[userID] = slices.DeleteFunc(s.memberships[userID],
+		func(v string) bool { return v == accountID })
+	s.appendAudit(e)
+	return nil
+}
+
+// ListMembers implements domain.MemberRepository.
+func (s *Store) ListMembers(_ context.Context, accountID string,
+) ([]domain.Member, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]domain.Member, 0, len(s.members[accountID]))
+	for _, m := range s.members[accountID] {
+		out = append(out, cloneMember(m))
+	}
+	return out, nil
+}
+
+// ListMemberships implements domain.MemberRepository.
+func (s *Store) ListMemberships(_ context.Context, userID string,
+) ([]domain.Member, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]domain.Member, 0, len(s.memberships[userID]))
+	for _, id := range s.memberships[userID] {
+		if _, ok := s.accounts[id]; !ok {
+			continue
+		}
+		m := s.members[id][s.member(id, userID)]
+		out = append(out, cloneMember(m))
+	}
+	slices.SortStableFunc(out, func(a, b domain.Member) int {
+		return a.InvitedAt.Compare(b.InvitedAt)
+	})
+	return out, nil
+}
+
+// GetSharedAccount implements domain.MemberRepository.
+func (s *Store) GetSharedAccount(_ context.Context, userID,
+	accountID string) (domain.Account, domain.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.accounts[accountID]
+	i := s.member(accountID, userID)
+	if !ok || i < 0 || s.members[accountID][i].Pending() {
+		return domain.Account{}, "", domain.ErrAccountNotFound
+	}
+	return clone(a), s.members[accountID][i].Role, nil
+}
+
+// member returns the index of the user in the members of the account,
+// or -1. It must be called with the lock held.
+func (s *Store) member(accountID, userID string) int {
+	return slices.IndexFunc(s.members[accountID],
+		func(m domain.Member) bool { return m.UserID == userID })
+}
+
+// removeMembers drops the members of a purged account. It must be
+// called with the lock held.
+func (s *Store) removeMembers(accountID string) {
+	for _, m := range s.members[accountID] {
+		s.memberships[m.UserID] = slices.DeleteFunc(
+			s.memberships[m.UserID],
+			func(v string) bool { return v == accountID })
+	}
+	delete(s.members, accountID)
+}
+
+func cloneMember(m domain.Member) domain.Member {
+	if m.AcceptedAt != nil {
+		t := *m.AcceptedAt
+		m.AcceptedAt = &t
+	}
+	return m
+}
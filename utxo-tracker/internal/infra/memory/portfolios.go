@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+var _ domain.PortfolioRepository = (*Store)(nil)
+
+// CreatePortfolio implements domain.PortfolioRepository.
+func (s *Store) CreatePortfolio(_ context.Context, p domain.Portfolio,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkPortfolio(p); err != nil {
+		return err
+	}
+	if _, ok := s.portfolios[p.ID]; ok {
+		return domain.ErrDuplicatePortfolio
+	}
+	s.portfolios[p.ID] = clonePortfolio(p)
+	s.portfoliosByOwner[p.OwnerID] = append(
+		s.portfoliosByOwner[p.OwnerID], p.ID)
+	return nil
+}
+
+// GetPortfolio implements domain.PortfolioRepository.
+func (s *Store) GetPortfolio(_ context.Context, ownerID, id string,
+) (domain.Portfolio, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.portfolios[id]
+	if !ok || p.OwnerID != ownerID {
+		return domain.Portfolio{}, domain.ErrPortfolioNotFound
+	}
+	return clonePortfolio(p), nil
+}
+
+// ListPortfolios implements domain.PortfolioRepository.
+func (s *Store) ListPortfolios(_ context.Context, ownerID string,
+) ([]domain.Portfolio, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]domain.Portfolio, 0, len(s.portfoliosByOwner[ownerID]))
+	for _, id := range s.portfoliosByOwner[ownerID] {
+		out = append(out, clonePortfolio(s.portfolios[id]))
+	}
+	return out, nil
+}
+
+// UpdatePortfolio implements domain.PortfolioRepository.
+func (s *Store) UpdatePortfolio(_ context.Context, p domain.Portfolio,
+	version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.portfolios[p.ID]
+	if !ok || cur.OwnerID != p.OwnerID {
+		return domain.ErrPortfolioNotFound
+	}
+	if cur.Version != version {
+		return domain.ErrVersionMismatch
+	}
+	if err := s.checkPortfolio(p); err != nil {
+		return err
+	}
+	s.portfolios[p.ID] = clonePortfolio(p)
+	return nil
+}
+
+// DeletePortfolio implements domain.PortfolioRepository.
+func (s *Store) DeletePortfolio(_ context.Context, ownerID, id string,
+	version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.portfolios[id]
+	if !ok || cur.OwnerID != ownerID {
+		return domain.ErrPortfolioNotFound
+	}
+	if cur.Version != version {
+		return domain.ErrVersionMismatch
+	}
+	delete(s.portfolios, id)
+	s.portfoliosByOwner[ownerID] = slices.DeleteFunc(
+		s.portfoliosByOwner[ownerID],
+		func(v string) bool { return v == id })
+	return nil
+}
+
+// checkPortfolio checks that the portfolio name is free and that its
+// members exist. It must be called with the lock held.
+func (s *Store) checkPortfolio(p domain.Portfolio) error {
+	for _, id := range s.portfoliosByOwner[p.OwnerID] {
+		if id != p.ID && s.portfolios[id].Name == p.Name {
+			return domain.ErrDuplicatePortfolio
+		}
+	}
+	for _, id := range p.AccountIDs {
+		if a, ok := s.accounts[id]; !ok || a.OwnerID != p.OwnerID {
+			return domain.ErrUnknownMember
+		}
+	}
+	return nil
+}
+
+func clonePortfolio(p domain.Portfolio) domain.Portfolio {
+	p.AccountIDs = slices.Clone(p.AccountIDs)
+	return p
+}
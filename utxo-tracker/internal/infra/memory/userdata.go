@@ -0,0 +1,217 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+var (
+	_ domain.UserDataRepository = (*Store)(nil)
+	_ domain.ErasureRepository  = (*Store)(nil)
+)
+
+// ExportUserData implements domain.UserDataRepository.
+func (s *Store) ExportUserData(_ context.Context, userID string,
+) (domain.UserData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d := domain.UserData{
+		Accounts:    []domain.Account{},
+		Members:     []domain.Member{},
+		Portfolios:  []domain.Portfolio{},
+		Memberships: []domain.Member{},
+		Audit:       []domain.AuditEntry{},
+	}
+	for _, id := range s.ownedAccounts(userID) {
+		a, ok := s.accounts[id]
+		if !ok {
+			a = s.deleted[id]
+		}
+		d.Accounts = append(d.Accounts, clone(a))
+		for _, m := range s.members[id] {
+			d.Members = append(d.Members, cloneMember(m))
+		}
+	}
+	for _, id := range s.auditedAccounts(userID) {
+		es := s.audit[id]
+		for _, e := range es {
+			d.Audit = append(d.Audit, cloneAudit(e))
+		}
+		if len(es) > 0 {
+			d.AuditHeads = append(d.AuditHeads, es[len(es)-1].Head())
+		}
+	}
+	slices.SortStableFunc(d.Accounts, func(a, b domain.Account) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	for _, id := range s.portfoliosByOwner[userID] {
+		d.Portfolios = append(d.Portfolios, clonePortfolio(s.portfolios[id]))
+	}
+	for _, id := range s.memberships[userID] {
+		m := s.members[id][s.member(id, userID)]
+		d.Memberships = append(d.Memberships, cloneMember(m))
+	}
+	return d, nil
+}
+
+// EraseUserData implements domain.UserDataRepository.
+func (s *Store) EraseUserData(_ context.Context, userID string,
+) (domain.ErasedData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var d domain.ErasedData
+	for _, id := range s.ownedAccounts(userID) {
+		s.unindex(s.accounts[id])
+		delete(s.accounts, id)
+		delete(s.deleted, id)
+		s.removeMembers(id)
+		d.Accounts++
+	}
+	for _, id := range s.auditedAccounts(userID) {
+		delete(s.audit, id)
+		delete(s.auditOwners, id)
+	}
+	// The chains left belong to accounts of other users
+	for id, es := range s.audit {
+		redacted, seqs := domain.RedactAudit(es, userID)
+		if len(seqs) == 0 {
+			continue
+		}
+		s.audit[id] = redacted
+		s.appendAudit(domain.NewRedactEntry(id, seqs, time.Now()))
+		d.AuditEntries += len(seqs)
+	}
+	delete(s.byOwner, userID)
+	for _, id := range s.portfoliosByOwner[userID] {
+		delete(s.portfolios, id)
+		d.Portfolios++
+	}
+	delete(s.portfoliosByOwner, userID)
+	for _, id := range s.memberships[userID] {
+		i := s.member(id, userID)
+		s.members[id] = slices.Delete(s.members[id], i, i+1)
+		d.Memberships++
+	}
+	delete(s.memberships, userID)
+	for k := range s.idempotency {
+		if k.ownerID == userID {
+			delete(s.idempotency, k)
+			d.IdempotencyKeys++
+		}
+	}
+	return d, nil
+}
+
+// ownedAccounts returns the IDs of the accounts of the owner, deleted
+// ones included. It must be called with the lock held.
+func (s *Store) ownedAccounts(ownerID string) []string {
+	ids := slices.Clone(s.byOwner[ownerID])
+	for id, a := range s.deleted {
+		if a.OwnerID == ownerID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// auditedAccounts returns the IDs of the accounts of the owner with an
+// audit chain, purged ones last. It must be called with the lock held.
+func (s *Store) auditedAccounts(ownerID string) []string {
+	var ids, purged []string
+	for _, id := range s.ownedAccounts(ownerID) {
+		if _, ok := s.audit[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	for id, o := range s.auditOwners {
+		_, live := s.accounts[id]
+		_, deleted := s.deleted[id]
+		if o == ownerID && !live && !deleted {
+			purged = append(purged, id)
+		}
+	}
+	slices.Sort(purged)
+	return append(ids, purged...)
+}
+
+// CreateErasure implements domain.ErasureRepository.
+func (s *Store) CreateErasure(_ context.Context, e domain.Erasure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.erasures[e.ID] = cloneErasure(e)
+	return nil
+}
+
+// UpdateErasure implements domain.ErasureRepository.
+func (s *Store) UpdateErasure(_ context.Context, e domain.Erasure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.erasures[e.ID]; !ok || cur.UserID != e.UserID {
+		return domain.ErrErasureNotFound
+	}
+	s.erasures[e.ID] = cloneErasure(e)
+	return nil
+}
+
+// GetErasure implements domain.ErasureRepository.
+func (s *Store) GetErasure(_ context.Context, userID, id string,
+) (domain.Erasure, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.erasures[id]
+	if !ok || e.UserID != userID {
+		return domain.Erasure{}, domain.ErrErasureNotFound
+	}
+	return cloneErasure(e), nil
+}
+
+// ClaimErasure implements domain.ErasureRepository.
+func (s *Store) ClaimErasure(_ context.Context, e domain.Erasure,
+	stale time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.erasures[e.ID]
+	switch {
+	case !ok || cur.UserID != e.UserID:
+		return false, nil
+	case cur.Status == domain.ErasurePending,
+		cur.Status == domain.ErasureRunning && cur.StartedAt.Before(stale):
+		cur.Status, cur.StartedAt = domain.ErasureRunning, e.StartedAt
+		s.erasures[e.ID] = cloneErasure(cur)
+		return true, nil
+	}
+	return false, nil
+}
+
+// ListUnfinishedErasures implements domain.ErasureRepository.
+func (s *Store) ListUnfinishedErasures(_ context.Context,
+) ([]domain.Erasure, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []domain.Erasure
+	for _, e := range s.erasures {
+		switch e.Status {
+		case domain.ErasurePending, domain.ErasureRunning:
+			out = append(out, cloneErasure(e))
+		}
+	}
+	slices.SortFunc(out, func(a, b domain.Erasure) int {
+		return a.RequestedAt.Compare(b.RequestedAt)
+	})
+	return out, nil
+}
+
+func cloneErasure(e domain.Erasure) domain.Erasure {
+	if e.StartedAt != nil {
+		t := *e.StartedAt
+		e.StartedAt = &t
+	}
+	if e.CompletedAt != nil {
+		t := *e.CompletedAt
+		e.CompletedAt = &t
+	}
+	return e
+}
@@ -0,0 +1,17 @@
+ALTER TABLE accounts ADD COLUMN network TEXT NOT NULL DEFAULT 'mainnet';
+
+-- Addresses of the test networks are encoded alike, such accounts are
+-- classified as testnet unless they hold a regtest address.
+UPDATE accounts SET network = 'testnet' WHERE id IN (
+	SELECT account_id FROM account_addresses
+	WHERE address LIKE 'tb1%' OR substr(address, 1, 1) IN ('m', 'n', '2'));
+UPDATE accounts SET network = 'regtest' WHERE id IN (
+	SELECT account_id FROM account_addresses WHERE address LIKE 'bcrt1%');
+
+-- The names of accounts as folded by the service, which name prefixes
+-- are matched in. The names of existing accounts are folded by the
+-- service after migrating, as lower() only folds ASCII on SQLite.
+ALTER TABLE accounts ADD COLUMN name_key TEXT;
+
+CREATE INDEX accounts_owner_name ON accounts (owner_id, name, id);
+CREATE INDEX account_addresses_address ON account_addresses (address);
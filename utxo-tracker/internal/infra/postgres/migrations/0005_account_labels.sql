@@ -0,0 +1,10 @@
+ALTER TABLE accounts ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+
+CREATE TABLE account_labels (
+	account_id TEXT NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	type       TEXT NOT NULL,
+	ref        TEXT NOT NULL,
+	record     TEXT NOT NULL,
+	PRIMARY KEY (account_id, position)
+);
@@ -0,0 +1,22 @@
+CREATE TABLE portfolios (
+	id         TEXT PRIMARY KEY,
+	owner_id   TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	version    BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	UNIQUE (owner_id, name)
+);
+
+CREATE INDEX portfolios_owner_created ON portfolios (owner_id, created_at);
+
+-- Deleting an account removes it from its portfolios through the
+-- cascade. The account store bumps their versions beforehand.
+CREATE TABLE portfolio_accounts (
+	portfolio_id TEXT NOT NULL REFERENCES portfolios (id) ON DELETE CASCADE,
+	account_id   TEXT NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+	position     INTEGER NOT NULL,
+	PRIMARY KEY (portfolio_id, account_id)
+);
+
+CREATE INDEX portfolio_accounts_account ON portfolio_accounts (account_id);
@@ -0,0 +1,13 @@
+-- Users an account is shared with. A row with no accepted_at is a
+-- pending invitation. The owner is not listed.
+CREATE TABLE account_members (
+	account_id  TEXT NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+	user_id     TEXT NOT NULL,
+	role        TEXT NOT NULL,
+	invited_by  TEXT NOT NULL,
+	invited_at  TIMESTAMPTZ NOT NULL,
+	accepted_at TIMESTAMPTZ,
+	PRIMARY KEY (account_id, user_id)
+);
+
+CREATE INDEX account_members_user ON account_members (user_id, invited_at);
@@ -0,0 +1,18 @@
+-- Requests of users to have their data erased. They outlive the data
+-- as proof of the erasure. The counts are set once it completed.
+CREATE TABLE erasures (
+	id               TEXT PRIMARY KEY,
+	user_id          TEXT NOT NULL,
+	status           TEXT NOT NULL,
+	requested_at     TIMESTAMPTZ NOT NULL,
+	completed_at     TIMESTAMPTZ,
+	-- When the erasure started running, so that another process takes
+	-- it over once it ran for longer than its lease
+	started_at       TIMESTAMPTZ,
+	accounts         INTEGER NOT NULL DEFAULT 0,
+	portfolios       INTEGER NOT NULL DEFAULT 0,
+	memberships      INTEGER NOT NULL DEFAULT 0,
+	idempotency_keys INTEGER NOT NULL DEFAULT 0,
+	-- Audit entries of accounts of other users the user was removed from
+	audit_entries    INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,38 @@
+-- The audit chain of each account. Every entry holds the hash of the
+-- entry before, see domain.AuditEntry. Entries outlive the accounts they
+-- record, so that purging an account keeps its history. They are removed
+-- when the data of the owner of the account is erased, who is recorded
+-- in the head of the chain for that.
+CREATE TABLE audit_entries (
+	account_id TEXT NOT NULL,
+	seq        BIGINT NOT NULL,
+	action     TEXT NOT NULL,
+	actor      TEXT NOT NULL,
+	-- The user whose membership the entry records a change of, as the
+	-- changes may be sealed
+	member_id  TEXT,
+	trace_id   TEXT NOT NULL,
+	at         TIMESTAMPTZ NOT NULL,
+	changes    TEXT NOT NULL,
+	prev_hash  TEXT NOT NULL,
+	hash       TEXT NOT NULL,
+	PRIMARY KEY (account_id, seq)
+);
+
+-- The entries of a user are looked up when the user's data is erased
+CREATE INDEX audit_entries_actor ON audit_entries (actor);
+CREATE INDEX audit_entries_member ON audit_entries (member_id);
+
+-- The head of the audit chain of each account, see domain.AuditHead. It
+-- is moved along with every append. Heads written without an audit
+-- signing key are not signed until account-service sign-audit-heads is
+-- run.
+CREATE TABLE audit_heads (
+	account_id TEXT NOT NULL PRIMARY KEY,
+	seq        BIGINT NOT NULL,
+	hash       TEXT NOT NULL,
+	mac        TEXT NOT NULL DEFAULT '',
+	owner_id   TEXT
+);
+
+CREATE INDEX audit_heads_owner ON audit_heads (owner_id);
@@ -0,0 +1,2 @@
+-- Accounts created before chains could be chosen are Bitcoin accounts.
+ALTER TABLE accounts ADD COLUMN chain TEXT NOT NULL DEFAULT 'bitcoin';
@@ -0,0 +1,3 @@
+-- The output descriptors of accounts that expand them into addresses,
+-- with their ranges and expanded addresses, as JSON.
+ALTER TABLE accounts ADD COLUMN descriptors TEXT;
@@ -0,0 +1,78 @@
+// Package postgres connects the service to PostgreSQL through a pgx
+// connection pool. The pool is exposed as a *sql.DB so that the sqldb
+// repositories can be shared with SQLite.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+
+	"github.com/hannesdejager/utxo-tracker/internal/app/config"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/sqldb"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLockID is the advisory lock key that serialises migrations
+// when several replicas start at the same time.
+const migrationLockID = 0x7574786f // "utxo"
+
+// Dialect describes PostgreSQL to the sqldb package.
+var Dialect = sqldb.Dialect{
+	IsUniqueViolation: func(err error) bool {
+		var e *pgconn.PgError
+		return errors.As(err, &e) && e.Code == "23505"
+	},
+}
+
+// Open creates a connection pool for the configured DSN. Every query run
+// through the pool gets a tracing span.
+func Open(ctx context.Context, c config.Database) (
+	*pgxpool.Pool, *sql.DB, error) {
+	pc, err := pgxpool.ParseConfig(c.PostgresDSN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid postgres DSN: %w", err)
+	}
+	pc.MaxConns = int32(c.Pool.MaxConns) //nolint:gosec
+	pc.MinConns = int32(c.Pool.MinConns) //nolint:gosec
+	pc.MaxConnLifetime = c.Pool.MaxConnLifetime
+	pc.MaxConnIdleTime = c.Pool.MaxConnIdleTime
+	pc.ConnConfig.Tracer = queryTracer{}
+
+	pool, err := pgxpool.NewWithConfig(ctx, pc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create pool: %w", err)
+	}
+	return pool, stdlib.OpenDBFromPool(pool), nil
+}
+
+// Migrate brings the schema up to date using the embedded migrations.
+// Replicas take turns through an advisory lock.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	ms, err := sqldb.LoadMigrations(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx,
+		`SELECT pg_advisory_lock($1)`, migrationLockID)
+	if err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(),
+			`SELECT pg_advisory_unlock($1)`, migrationLockID)
+	}()
+	return sqldb.Migrate(ctx, db, ms)
+}
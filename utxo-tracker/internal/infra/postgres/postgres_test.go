@@ -0,0 +1,266 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/label"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/sqldb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// The BIP84 account key of "abandon abandon … about" and its first
+// receive address.
+const (
+	testXpub    = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	testAddress = "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"
+)
+
+// openDB returns a database for the DSN in POSTGRES_TEST_DSN whose
+// connections use a schema of their own, which is dropped again when
+// the test ends. The test is skipped when the variable is not set.
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	ctx := context.Background()
+	pc, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + domain.NewID()
+	schema = pgx.Identifier{schema}.Sanitize()
+	admin, err := pgx.ConnectConfig(ctx, pc.ConnConfig.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close(ctx)
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn, err := pgx.ConnectConfig(ctx, pc.ConnConfig.Copy())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close(ctx)
+		_, err = conn.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	pc.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := stdlib.OpenDBFromPool(pool)
+	t.Cleanup(func() {
+		db.Close()
+		pool.Close()
+	})
+	return db
+}
+
+func testAccount(name string) domain.Account {
+	now := time.Now().UTC().Truncate(time.Second)
+	return domain.Account{
+		ID:        domain.NewID(),
+		OwnerID:   "alice",
+		Name:      name,
+		Addresses: []string{testAddress},
+		Labels: []label.Label{
+			label.New(label.Addr, testAddress, "Salary")},
+		Chain:     address.Bitcoin,
+		Network:   address.Mainnet,
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Derivation: &domain.Derivation{
+			ExtendedKey: testXpub,
+			Purpose:     address.BIP84,
+			GapLimit:    20,
+			Addresses: []domain.DerivedAddress{
+				{Address: testAddress, Path: "m/84'/0'/0'/0/0"}},
+		},
+	}
+}
+
+func audit(a domain.Account, action domain.AuditAction,
+) domain.AuditEntry {
+	return domain.NewAuditEntry(a.ID, action, a.OwnerID, "",
+		[]domain.AuditChange{}, a.UpdatedAt)
+}
+
+func TestMigrate(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	for i := range 2 {
+		if err := Migrate(ctx, db); err != nil {
+			t.Fatalf("Migrate run %d: %v", i+1, err)
+		}
+	}
+	ms, err := sqldb.LoadMigrations(migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	err = db.QueryRowContext(ctx,
+		`SELECT count(*) FROM schema_migrations`).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(ms) {
+		t.Errorf("applied %d migrations, want %d", n, len(ms))
+	}
+}
+
+func TestStore(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	s := sqldb.NewStore(db, Dialect)
+
+	a := testAccount("Savings")
+	err := s.CreateAccount(ctx, a, audit(a, domain.AuditCreate))
+	if err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	dup := testAccount("Savings")
+	err = s.CreateAccount(ctx, dup, audit(dup, domain.AuditCreate))
+	if !errors.Is(err, domain.ErrDuplicateAccount) {
+		t.Errorf("CreateAccount with a taken name = %v, want %v", err,
+			domain.ErrDuplicateAccount)
+	}
+
+	got, err := s.GetAccount(ctx, a.OwnerID, a.ID)
+	if err != nil {
+		t.Fatalf("GetAccount: %v", err)
+	}
+	if got.Name != a.Name || got.Derivation == nil ||
+		got.Derivation.ExtendedKey != testXpub ||
+		len(got.Labels) != 1 || got.Labels[0].Label != "Salary" {
+		t.Errorf("GetAccount = %+v, want %+v", got, a)
+	}
+	if !got.CreatedAt.Equal(a.CreatedAt) {
+		t.Errorf("CreatedAt = %v, want %v", got.CreatedAt, a.CreatedAt)
+	}
+
+	q := domain.NewAccountQuery(a.OwnerID)
+	q.NamePrefix = "sav"
+	as, err := s.ListAccounts(ctx, q)
+	if err != nil || len(as) != 1 || as[0].ID != a.ID {
+		t.Errorf("ListAccounts = %v, %v, want %s", as, err, a.ID)
+	}
+	ms, err := s.FindAddresses(ctx, a.OwnerID, testAddress)
+	if err != nil || len(ms) != 1 ||
+		ms[0].DerivationPath != "m/84'/0'/0'/0/0" {
+		t.Errorf("FindAddresses = %+v, %v", ms, err)
+	}
+
+	renamed := got
+	renamed.Name = "Pension"
+	renamed.Version++
+	err = s.UpdateAccount(ctx, renamed, got.Version,
+		audit(renamed, domain.AuditUpdate))
+	if err != nil {
+		t.Fatalf("UpdateAccount: %v", err)
+	}
+	err = s.UpdateAccount(ctx, renamed, got.Version,
+		audit(renamed, domain.AuditUpdate))
+	if !errors.Is(err, domain.ErrVersionMismatch) {
+		t.Errorf("UpdateAccount of a stale version = %v, want %v", err,
+			domain.ErrVersionMismatch)
+	}
+
+	deleted := renamed.Delete(time.Now())
+	err = s.DeleteAccount(ctx, deleted, renamed.Version,
+		audit(deleted, domain.AuditDelete))
+	if err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	_, err = s.GetAccount(ctx, a.OwnerID, a.ID)
+	if !errors.Is(err, domain.ErrAccountNotFound) {
+		t.Errorf("GetAccount after delete = %v, want %v", err,
+			domain.ErrAccountNotFound)
+	}
+	if _, err := s.GetDeletedAccount(ctx, a.OwnerID, a.ID); err != nil {
+		t.Errorf("GetDeletedAccount: %v", err)
+	}
+
+	es, _, err := s.ListAudit(ctx, a.ID)
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	want := []domain.AuditAction{
+		domain.AuditCreate, domain.AuditUpdate, domain.AuditDelete}
+	if len(es) != len(want) {
+		t.Fatalf("ListAudit returned %d entries, want %d", len(es),
+			len(want))
+	}
+	for i, e := range es {
+		if e.Action != want[i] {
+			t.Errorf("entry %d is %s, want %s", i, e.Action, want[i])
+		}
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	s := sqldb.NewStore(db, Dialect)
+	now := time.Now().UTC().Truncate(time.Second)
+	rec := domain.IdempotencyRecord{
+		OwnerID:     "alice",
+		Key:         "k1",
+		Fingerprint: "f",
+		ExpiresAt:   now.Add(time.Hour),
+	}
+	prev, err := s.ReserveIdempotencyKey(ctx, rec, now)
+	if err != nil || prev != nil {
+		t.Fatalf("ReserveIdempotencyKey = %v, %v, want nil", prev, err)
+	}
+	prev, err = s.ReserveIdempotencyKey(ctx, rec, now)
+	if err != nil || prev == nil || prev.Completed() {
+		t.Fatalf("ReserveIdempotencyKey while reserved = %+v, %v", prev,
+			err)
+	}
+	rec.Status = 201
+	rec.Header = map[string][]string{"Content-Type": {"application/json"}}
+	rec.Body = []byte(`{"id":"a1"}`)
+	if err := s.CompleteIdempotencyKey(ctx, rec); err != nil {
+		t.Fatalf("CompleteIdempotencyKey: %v", err)
+	}
+	prev, err = s.ReserveIdempotencyKey(ctx, rec, now)
+	if err != nil || prev == nil || prev.Status != 201 ||
+		string(prev.Body) != string(rec.Body) {
+		t.Errorf("ReserveIdempotencyKey when completed = %+v, %v", prev,
+			err)
+	}
+	err = s.DeleteExpiredIdempotencyKeys(ctx, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteExpiredIdempotencyKeys: %v", err)
+	}
+	prev, err = s.ReserveIdempotencyKey(ctx, rec, now)
+	if err != nil || prev != nil {
+		t.Errorf("ReserveIdempotencyKey after expiry = %+v, %v, want nil",
+			prev, err)
+	}
+}
@@ -0,0 +1,71 @@
+package prometheus
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dbPoolCollector exposes the statistics of a pgx connection pool.
+type dbPoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired     *prometheus.Desc
+	idle         *prometheus.Desc
+	total        *prometheus.Desc
+	max          *prometheus.Desc
+	acquires     *prometheus.Desc
+	emptyWaits   *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+// NewDBPoolCollector returns a collector that reads the pool statistics
+// on every scrape.
+func NewDBPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	d := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("db_pool_"+name, help, nil, nil)
+	}
+	return &dbPoolCollector{
+		pool: pool,
+		acquired: d("acquired_connections",
+			"Number of connections currently in use"),
+		idle: d("idle_connections",
+			"Number of idle connections in the pool"),
+		total: d("connections",
+			"Number of connections in the pool"),
+		max: d("max_connections",
+			"Maximum size of the pool"),
+		acquires: d("acquires_total",
+			"Number of successful connection acquires"),
+		emptyWaits: d("empty_acquires_total",
+			"Number of acquires that had to wait for a connection"),
+		waitDuration: d("acquire_duration_seconds_total",
+			"Total time spent acquiring connections"),
+	}
+}
+
+func (c *dbPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquires
+	ch <- c.emptyWaits
+	ch <- c.waitDuration
+}
+
+func (c *dbPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v)
+	}
+	gauge(c.acquired, float64(s.AcquiredConns()))
+	gauge(c.idle, float64(s.IdleConns()))
+	gauge(c.total, float64(s.TotalConns()))
+	gauge(c.max, float64(s.MaxConns()))
+	counter(c.acquires, float64(s.AcquireCount()))
+	counter(c.emptyWaits, float64(s.EmptyAcquireCount()))
+	counter(c.waitDuration, s.AcquireDuration().Seconds())
+}
@@ -8,14 +8,19 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func NewHandler(info domain.ServiceInstance) http.Handler {
+// NewHandler serves the service metrics along with any extra collectors,
+// such as those of the storage backend.
+func NewHandler(info domain.ServiceInstance,
+	extra ...prometheus.Collector) http.Handler {
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(
 		newBuildInfoGauge(info),
 		apiRequestsTotal,
 		apiErrorsTotal,
 		apiRequestDuration,
+		accountsPurgedTotal,
 	)
+	reg.MustRegister(extra...)
 	return promhttp.HandlerFor(
 		reg,
 		promhttp.HandlerOpts{Registry: reg},
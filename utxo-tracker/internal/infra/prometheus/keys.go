@@ -0,0 +1,48 @@
+package prometheus
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// staleKeysCollector exposes the number of records not encrypted under
+// the current key-encryption key.
+type staleKeysCollector struct {
+	count func(context.Context) (map[string]int, error)
+	stale *prometheus.Desc
+}
+
+// NewStaleKeysCollector returns a collector that counts the records on
+// old key versions of each table on every scrape.
+func NewStaleKeysCollector(
+	count func(context.Context) (map[string]int, error),
+) prometheus.Collector {
+	return &staleKeysCollector{
+		count: count,
+		stale: prometheus.NewDesc("records_on_old_key_version",
+			"Number of records not encrypted under the current "+
+				"key-encryption key, including plaintext ones",
+			[]string{"table"}, nil),
+	}
+}
+
+func (c *staleKeysCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.stale
+}
+
+func (c *staleKeysCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The metric is left out while the records cannot be counted, so
+	// that the other metrics are still served.
+	counts, err := c.count(ctx)
+	if err != nil {
+		return
+	}
+	for table, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.stale,
+			prometheus.GaugeValue, float64(n), table)
+	}
+}
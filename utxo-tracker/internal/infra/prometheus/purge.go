@@ -0,0 +1,15 @@
+package prometheus
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var accountsPurgedTotal = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "accounts_purged_total",
+		Help: "Number of deleted accounts purged after retention",
+	},
+)
+
+// AccountsPurged counts n accounts purged for good.
+func AccountsPurged(n int) {
+	accountsPurgedTotal.Add(float64(n))
+}
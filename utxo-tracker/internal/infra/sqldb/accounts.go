@@ -0,0 +1,896 @@
+// Package sqldb implements the domain repositories on top of database/sql.
+// The SQL is kept portable between SQLite and PostgreSQL, driver specific
+// behaviour is supplied through a Dialect.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/label"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/kms"
+)
+
+// Dialect captures the behaviour that differs between database drivers.
+type Dialect struct {
+	// IsUniqueViolation reports whether err was caused by a unique
+	// constraint.
+	IsUniqueViolation func(err error) bool
+}
+
+// Store is a domain.AccountRepository backed by an SQL database.
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+	kms     kms.Service
+	// auditKey signs the heads of the audit chains
+	auditKey domain.AuditKey
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithKMS encrypts the sensitive columns of the records written with
+// data keys wrapped by k. Without it they are written in plaintext.
+func WithKMS(k kms.Service) Option {
+	return func(s *Store) {
+		s.kms = k
+	}
+}
+
+// WithAuditKey signs the heads of the audit chains with key. Without it
+// they are not signed.
+func WithAuditKey(key domain.AuditKey) Option {
+	return func(s *Store) {
+		s.auditKey = key
+	}
+}
+
+// NewStore returns a Store that uses db. The schema is expected to have
+// been migrated already.
+func NewStore(db *sql.DB, d Dialect, opts ...Option) *Store {
+	s := &Store{db: db, dialect: d}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+var _ domain.AccountRepository = (*Store)(nil)
+
+// CreateAccount implements domain.AccountRepository.
+func (s *Store) CreateAccount(ctx context.Context, a domain.Account,
+	e domain.AuditEntry) error {
+	tags, err := json.Marshal(a.Tags)
+	if err != nil {
+		return err
+	}
+	derivation, err := encodeDerivation(a.Derivation)
+	if err != nil {
+		return err
+	}
+	descriptors, err := encodeDescriptors(a.Descriptors)
+	if err != nil {
+		return err
+	}
+	k, err := s.newDataKey(ctx)
+	if err != nil {
+		return err
+	}
+	derivation, descriptors, err = sealAccount(k, a.ID, derivation,
+		descriptors)
+	if err != nil {
+		return err
+	}
+	return s.auditedTx(ctx, e, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO accounts (id, owner_id, name, name_key, chain,
+			 network, tags, derivation, descriptors, data_key,
+			 key_version, version, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
+			 $13, $14)`,
+			a.ID, a.OwnerID, a.Name, domain.FoldName(a.Name),
+			string(a.Chain), string(a.Network),
+			string(tags), derivation, descriptors, k.wrapped, k.version,
+			a.Version, a.CreatedAt, a.UpdatedAt)
+		if err != nil {
+			if s.dialect.IsUniqueViolation(err) {
+				return domain.ErrDuplicateAccount
+			}
+			return fmt.Errorf("failed to insert account: %w", err)
+		}
+		return insertDetails(ctx, tx, a, k)
+	})
+}
+
+// GetAccount implements domain.AccountRepository.
+func (s *Store) GetAccount(ctx context.Context, ownerID, id string,
+) (domain.Account, error) {
+	a, err := s.scanAccount(ctx, s.db.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM accounts a
+		 WHERE a.id = $1 AND a.owner_id = $2 AND a.deleted_at IS NULL`,
+		id, ownerID))
+	return s.accountRead(ctx, a, err)
+}
+
+// GetDeletedAccount implements domain.AccountRepository.
+func (s *Store) GetDeletedAccount(ctx context.Context, ownerID, id string,
+) (domain.Account, error) {
+	a, err := s.scanAccount(ctx, s.db.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM accounts a
+		 WHERE a.id = $1 AND a.owner_id = $2
+		 AND a.deleted_at IS NOT NULL`,
+		id, ownerID))
+	return s.accountRead(ctx, a, err)
+}
+
+// accountRead completes an account read by scanAccount from a single
+// row.
+func (s *Store) accountRead(ctx context.Context, a domain.Account,
+	err error) (domain.Account, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Account{}, domain.ErrAccountNotFound
+	}
+	if err != nil {
+		return domain.Account{}, fmt.Errorf(
+			"failed to read account: %w", err)
+	}
+	as := []domain.Account{a}
+	if err := s.loadDetails(ctx, as); err != nil {
+		return domain.Account{}, err
+	}
+	return as[0], nil
+}
+
+// ListAccounts implements domain.AccountRepository.
+func (s *Store) ListAccounts(ctx context.Context, q domain.AccountQuery,
+) ([]domain.Account, error) {
+	var b queryBuilder
+	user := b.arg(q.UserID)
+	b.where("a.deleted_at IS NULL")
+	b.where(`(a.owner_id = ` + user + ` OR EXISTS (SELECT 1
+		FROM account_members m WHERE m.account_id = a.id
+		AND m.user_id = ` + user + ` AND m.accepted_at IS NOT NULL))`)
+	if q.NamePrefix != "" {
+		// Names are folded by the service rather than by lower(),
+		// which only folds ASCII on SQLite
+		p := b.arg(domain.FoldName(q.NamePrefix))
+		b.where(fmt.Sprintf(
+			"substr(a.name_key, 1, length(CAST(%[1]s AS TEXT))) = "+
+				"CAST(%[1]s AS TEXT)", p))
+	}
+	if q.Chain != "" {
+		b.where("a.chain = " + b.arg(string(q.Chain)))
+	}
+	if q.Network != "" {
+		b.where("a.network = " + b.arg(string(q.Network)))
+	}
+	if q.HasAddress != "" {
+		b.where(`EXISTS (SELECT 1 FROM account_addresses f
+			WHERE f.account_id = a.id AND f.address = ` +
+			b.arg(q.HasAddress) + ")")
+	}
+	col, dir, cmp := "a.created_at", "ASC", ">"
+	if q.OrderBy == domain.OrderByName {
+		col = "a.name"
+	}
+	if q.Descending {
+		dir, cmp = "DESC", "<"
+	}
+	if q.After != nil {
+		var v any = q.After.CreatedAt
+		if q.OrderBy == domain.OrderByName {
+			v = q.After.Name
+		}
+		pv, pid := b.arg(v), b.arg(q.After.ID)
+		b.where(fmt.Sprintf("(%[1]s %[2]s %[3]s OR "+
+			"(%[1]s = %[3]s AND a.id %[2]s %[4]s))", col, cmp, pv, pid))
+	}
+	query := `SELECT ` + accountColumns + ` FROM accounts a` + b.sql() +
+		fmt.Sprintf(" ORDER BY %[1]s %[2]s, a.id %[2]s LIMIT %[3]s",
+			col, dir, b.arg(q.Limit))
+
+	rows, err := s.db.QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	defer rows.Close()
+	var out []domain.Account
+	for rows.Next() {
+		a, err := s.scanAccount(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, s.loadDetails(ctx, out)
+}
+
+// UpdateAccount implements domain.AccountRepository.
+func (s *Store) UpdateAccount(ctx context.Context, a domain.Account,
+	version int64, e domain.AuditEntry) error {
+	tags, err := json.Marshal(a.Tags)
+	if err != nil {
+		return err
+	}
+	derivation, err := encodeDerivation(a.Derivation)
+	if err != nil {
+		return err
+	}
+	descriptors, err := encodeDescriptors(a.Descriptors)
+	if err != nil {
+		return err
+	}
+	k, err := s.newDataKey(ctx)
+	if err != nil {
+		return err
+	}
+	derivation, descriptors, err = sealAccount(k, a.ID, derivation,
+		descriptors)
+	if err != nil {
+		return err
+	}
+	return s.auditedTx(ctx, e, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE accounts SET name = $1, name_key = $2, chain = $3,
+			 network = $4, tags = $5, derivation = $6, descriptors = $7,
+			 data_key = $8, key_version = $9, version = $10,
+			 updated_at = $11
+			 WHERE id = $12 AND owner_id = $13 AND version = $14
+			 AND deleted_at IS NULL`,
+			a.Name, domain.FoldName(a.Name), string(a.Chain),
+			string(a.Network), string(tags), derivation, descriptors,
+			k.wrapped, k.version, a.Version, a.UpdatedAt, a.ID,
+			a.OwnerID, version)
+		if err != nil {
+			if s.dialect.IsUniqueViolation(err) {
+				return domain.ErrDuplicateAccount
+			}
+			return fmt.Errorf("failed to update account: %w", err)
+		}
+		err = versionMatched(ctx, tx, res, a.OwnerID, a.ID, false)
+		if err != nil {
+			return err
+		}
+		for _, t := range []string{"account_addresses", "account_labels"} {
+			_, err = tx.ExecContext(ctx,
+				`DELETE FROM `+t+` WHERE account_id = $1`, a.ID)
+			if err != nil {
+				return fmt.Errorf("failed to delete from %s: %w", t, err)
+			}
+		}
+		return insertDetails(ctx, tx, a, k)
+	})
+}
+
+// DeleteAccount implements domain.AccountRepository.
+func (s *Store) DeleteAccount(ctx context.Context, a domain.Account,
+	version int64, e domain.AuditEntry) error {
+	return s.auditedTx(ctx, e, func(tx *sql.Tx) error {
+		// The portfolios get a new version so that cached copies are
+		// refreshed. This is rolled back with the rest if the version
+		// does not match.
+		_, err := tx.ExecContext(ctx,
+			`UPDATE portfolios SET version = version + 1
+			 WHERE id IN (SELECT portfolio_id FROM portfolio_accounts
+			 WHERE account_id = $1)`, a.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update portfolios: %w", err)
+		}
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM portfolio_accounts WHERE account_id = $1`, a.ID)
+		if err != nil {
+			return fmt.Errorf("failed to delete from portfolios: %w", err)
+		}
+		res, err := tx.ExecContext(ctx,
+			`UPDATE accounts SET deleted_at = $1, version = $2,
+			 updated_at = $3
+			 WHERE id = $4 AND owner_id = $5 AND version = $6
+			 AND deleted_at IS NULL`,
+			a.DeletedAt, a.Version, a.UpdatedAt, a.ID, a.OwnerID, version)
+		if err != nil {
+			return fmt.Errorf("failed to delete account: %w", err)
+		}
+		return versionMatched(ctx, tx, res, a.OwnerID, a.ID, false)
+	})
+}
+
+// RestoreAccount implements domain.AccountRepository.
+func (s *Store) RestoreAccount(ctx context.Context, a domain.Account,
+	version int64, e domain.AuditEntry) error {
+	return s.auditedTx(ctx, e, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE accounts SET deleted_at = NULL, version = $1,
+			 updated_at = $2
+			 WHERE id = $3 AND owner_id = $4 AND version = $5
+			 AND deleted_at IS NOT NULL`,
+			a.Version, a.UpdatedAt, a.ID, a.OwnerID, version)
+		if err != nil {
+			return fmt.Errorf("failed to restore account: %w", err)
+		}
+		return versionMatched(ctx, tx, res, a.OwnerID, a.ID, true)
+	})
+}
+
+// PurgeDeletedAccounts implements domain.AccountRepository.
+func (s *Store) PurgeDeletedAccounts(ctx context.Context, before time.Time,
+) (int, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id FROM accounts
+		 WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list deleted accounts: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read account: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, id := range ids {
+		purged, err := s.purgeAccount(ctx, id, before)
+		if err != nil {
+			return n, err
+		}
+		if purged {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// errNotPurged rolls back the purge of an account restored meanwhile.
+var errNotPurged = errors.New("account is no longer due for purging")
+
+// purgeAccount removes an account deleted before the given time and
+// appends the purge to its audit chain. Accounts restored or changed
+// meanwhile are left for the next purge.
+func (s *Store) purgeAccount(ctx context.Context, id string,
+	before time.Time) (bool, error) {
+	e := domain.NewAuditEntry(id, domain.AuditPurge, domain.SystemActor,
+		"", []domain.AuditChange{}, time.Now())
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		// The entry goes first, while the owner of the account can
+		// still be recorded in the head of the chain
+		if err := s.appendAudit(ctx, tx, e); err != nil {
+			return err
+		}
+		// Addresses, labels and members go with the cascade
+		res, err := tx.ExecContext(ctx,
+			`DELETE FROM accounts WHERE id = $1
+			 AND deleted_at IS NOT NULL AND deleted_at < $2`, id, before)
+		if err != nil {
+			return fmt.Errorf("failed to purge account: %w", err)
+		}
+		return affected(res, errNotPurged)
+	})
+	if errors.Is(err, errNotPurged) || errors.Is(err, errAuditRace) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ListDerivedAccounts implements domain.AccountRepository.
+func (s *Store) ListDerivedAccounts(ctx context.Context,
+	after *domain.AccountPosition, limit int) ([]domain.Account, error) {
+	var b queryBuilder
+	b.where("a.derivation IS NOT NULL")
+	b.where("a.deleted_at IS NULL")
+	if after != nil {
+		pc, pid := b.arg(after.CreatedAt), b.arg(after.ID)
+		b.where(fmt.Sprintf("(a.created_at > %[1]s OR "+
+			"(a.created_at = %[1]s AND a.id > %[2]s))", pc, pid))
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+accountColumns+` FROM accounts a`+b.sql()+
+			` ORDER BY a.created_at, a.id LIMIT `+b.arg(limit), b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	defer rows.Close()
+	var out []domain.Account
+	for rows.Next() {
+		a, err := s.scanAccount(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, s.loadDetails(ctx, out)
+}
+
+// FindAddresses implements domain.AccountRepository.
+func (s *Store) FindAddresses(ctx context.Context, ownerID string,
+	addrs ...string) ([]domain.AddressMatch, error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	var b queryBuilder
+	owner := b.arg(ownerID)
+	in := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		in = append(in, b.arg(addr))
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT f.address, f.position, `+accountColumns+`
+		 FROM account_addresses f JOIN accounts a ON a.id = f.account_id
+		 WHERE a.owner_id = `+owner+` AND a.deleted_at IS NULL
+		 AND f.address IN (`+strings.Join(in, ", ")+`)
+		 ORDER BY f.address, a.created_at, a.id`, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find addresses: %w", err)
+	}
+	defer rows.Close()
+	var (
+		out []domain.AddressMatch
+		as  []domain.Account
+		idx = make(map[string]int)
+	)
+	for rows.Next() {
+		var m domain.AddressMatch
+		m.Account, err = s.scanAccount(ctx, rows, &m.Address, &m.Index)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := idx[m.Account.ID]; !ok {
+			idx[m.Account.ID] = len(as)
+			as = append(as, m.Account)
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.loadDetails(ctx, as); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Account = as[idx[out[i].Account.ID]]
+		out[i].DerivationPath = out[i].Account.Path(out[i].Address)
+	}
+	return out, nil
+}
+
+// AccountUsage implements domain.AccountRepository.
+func (s *Store) AccountUsage(ctx context.Context, ownerID string,
+) (domain.Usage, error) {
+	var u domain.Usage
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(n), 0), COALESCE(MAX(n), 0)
+		 FROM (SELECT COUNT(f.address) AS n
+		       FROM accounts a LEFT JOIN account_addresses f
+		       ON f.account_id = a.id
+		       WHERE a.owner_id = $1 AND a.deleted_at IS NULL
+		       GROUP BY a.id) AS per_account`,
+		ownerID).Scan(&u.Accounts, &u.Addresses, &u.LargestAccount)
+	if err != nil {
+		return domain.Usage{}, fmt.Errorf("failed to count usage: %w", err)
+	}
+	return u, nil
+}
+
+// versionMatched tells apart the reasons why a versioned statement did
+// not affect a row. Accounts count as existing only if they are deleted
+// or not as given.
+func versionMatched(ctx context.Context, tx *sql.Tx, res sql.Result,
+	ownerID, id string, deleted bool) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	state := "deleted_at IS NULL"
+	if deleted {
+		state = "deleted_at IS NOT NULL"
+	}
+	var exists int
+	err = tx.QueryRowContext(ctx,
+		`SELECT 1 FROM accounts WHERE id = $1 AND owner_id = $2 AND `+
+			state, id, ownerID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return domain.ErrVersionMismatch
+}
+
+// loadDetails fills in the addresses and labels of the given accounts.
+func (s *Store) loadDetails(ctx context.Context, as []domain.Account,
+) error {
+	if len(as) == 0 {
+		return nil
+	}
+	err := s.loadRows(ctx, "account_addresses", "address", as,
+		func(i int, v string) error {
+			as[i].Addresses = append(as[i].Addresses, v)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	return s.loadRows(ctx, "account_labels", "record", as,
+		func(i int, v string) error {
+			var l label.Label
+			if err := json.Unmarshal([]byte(v), &l); err != nil {
+				return fmt.Errorf("failed to decode label: %w", err)
+			}
+			as[i].Labels = append(as[i].Labels, l)
+			return nil
+		})
+}
+
+// loadRows reads column of the rows in table that belong to the given
+// accounts, in position order, and passes each value to add along with
+// the index of its account. Sealed columns are opened. The accounts are
+// read in batches of maxInArgs.
+func (s *Store) loadRows(ctx context.Context, table, column string,
+	as []domain.Account, add func(i int, v string) error) error {
+	for start := 0; start < len(as); start += maxInArgs {
+		batch := as[start:min(start+maxInArgs, len(as))]
+		err := s.loadBatch(ctx, table, column, batch,
+			func(i int, v string) error {
+				return add(start+i, v)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadBatch does the work of loadRows for a single batch of accounts.
+func (s *Store) loadBatch(ctx context.Context, table, column string,
+	as []domain.Account, add func(i int, v string) error) error {
+	var b queryBuilder
+	idx := make(map[string]int, len(as))
+	ids := make([]string, 0, len(as))
+	for i, a := range as {
+		idx[a.ID] = i
+		ids = append(ids, b.arg(a.ID))
+	}
+	sealed := isSealed(table, column)
+	columns := `account_id, position, ` + column
+	if sealed {
+		columns += `, data_key, key_version`
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+columns+` FROM `+table+`
+		 WHERE account_id IN (`+strings.Join(ids, ", ")+`)
+		 ORDER BY account_id, position`, b.args...)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	defer rows.Close()
+	// The rows of an account mostly share its data key
+	keys := make(map[string]dataKey)
+	for rows.Next() {
+		var (
+			id                  string
+			pos                 int
+			v                   sql.NullString
+			wrapped, keyVersion sql.NullString
+		)
+		dest := []any{&id, &pos, &v}
+		if sealed {
+			dest = append(dest, &wrapped, &keyVersion)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if wrapped.Valid {
+			k, ok := keys[wrapped.String]
+			if !ok {
+				k, err = s.openDataKey(ctx, wrapped, keyVersion)
+				if err != nil {
+					return err
+				}
+				keys[wrapped.String] = k
+			}
+			v, err = k.open(v, additionalData(table, column, id, pos))
+			if err != nil {
+				return err
+			}
+		}
+		if i, ok := idx[id]; ok {
+			if err := add(i, v.String); err != nil {
+				return err
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// accountColumns lists the columns read by scanAccount.
+const accountColumns = `a.id, a.owner_id, a.name, a.chain, a.network,
+	a.tags, a.derivation, a.descriptors, a.data_key, a.key_version,
+	a.version, a.created_at, a.updated_at, a.deleted_at`
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanAccount reads a row of accountColumns, preceded by the columns
+// scanned into lead. Addresses are loaded separately.
+func (s *Store) scanAccount(ctx context.Context, row scanner, lead ...any,
+) (domain.Account, error) {
+	a := domain.Account{Addresses: []string{}}
+	var (
+		chain, network, tags    string
+		derivation, descriptors sql.NullString
+		wrapped, keyVersion     sql.NullString
+		deleted                 sql.NullTime
+	)
+	err := row.Scan(append(lead, &a.ID, &a.OwnerID, &a.Name, &chain,
+		&network, &tags, &derivation, &descriptors, &wrapped,
+		&keyVersion, &a.Version, &a.CreatedAt, &a.UpdatedAt,
+		&deleted)...)
+	if err != nil {
+		return a, err
+	}
+	k, err := s.openDataKey(ctx, wrapped, keyVersion)
+	if err != nil {
+		return a, err
+	}
+	derivation, err = k.open(derivation,
+		additionalData("accounts", "derivation", a.ID))
+	if err != nil {
+		return a, err
+	}
+	descriptors, err = k.open(descriptors,
+		additionalData("accounts", "descriptors", a.ID))
+	if err != nil {
+		return a, err
+	}
+	if deleted.Valid {
+		a.DeletedAt = &deleted.Time
+	}
+	a.Chain = address.Chain(chain)
+	a.Network = address.Network(network)
+	if err := json.Unmarshal([]byte(tags), &a.Tags); err != nil {
+		return a, fmt.Errorf("failed to decode tags: %w", err)
+	}
+	if derivation.Valid {
+		a.Derivation, err = decodeDerivation(derivation.String)
+		if err != nil {
+			return a, err
+		}
+	}
+	if descriptors.Valid {
+		a.Descriptors, err = decodeDescriptors(descriptors.String)
+	}
+	return a, err
+}
+
+// sealAccount encrypts the derivation and descriptors columns of the
+// account with the given ID.
+func sealAccount(k dataKey, id string, derivation,
+	descriptors sql.NullString) (sql.NullString, sql.NullString, error) {
+	derivation, err := k.seal(derivation,
+		additionalData("accounts", "derivation", id))
+	if err != nil {
+		return derivation, descriptors, err
+	}
+	descriptors, err = k.seal(descriptors,
+		additionalData("accounts", "descriptors", id))
+	return derivation, descriptors, err
+}
+
+// derivationRecord is how a derivation is stored in the derivation
+// column.
+type derivationRecord struct {
+	ExtendedKey string          `json:"extendedKey"`
+	Purpose     uint32          `json:"purpose"`
+	GapLimit    int             `json:"gapLimit"`
+	Addresses   []derivedRecord `json:"addresses"`
+}
+
+type derivedRecord struct {
+	Address string `json:"address"`
+	Branch  uint32 `json:"branch"`
+	Index   uint32 `json:"index"`
+	Path    string `json:"path"`
+}
+
+func encodeDerivation(d *domain.Derivation) (sql.NullString, error) {
+	if d == nil {
+		return sql.NullString{}, nil
+	}
+	r := derivationRecord{
+		ExtendedKey: d.ExtendedKey,
+		Purpose:     uint32(d.Purpose),
+		GapLimit:    d.GapLimit,
+		Addresses:   make([]derivedRecord, 0, len(d.Addresses)),
+	}
+	for _, da := range d.Addresses {
+		r.Addresses = append(r.Addresses, derivedRecord(da))
+	}
+	b, err := json.Marshal(r)
+	return sql.NullString{String: string(b), Valid: true}, err
+}
+
+func decodeDerivation(s string) (*domain.Derivation, error) {
+	var r derivationRecord
+	if err := json.Unmarshal([]byte(s), &r); err != nil {
+		return nil, fmt.Errorf("failed to decode derivation: %w", err)
+	}
+	d := &domain.Derivation{
+		ExtendedKey: r.ExtendedKey,
+		Purpose:     address.Purpose(r.Purpose),
+		GapLimit:    r.GapLimit,
+		Addresses:   make([]domain.DerivedAddress, 0, len(r.Addresses)),
+	}
+	for _, da := range r.Addresses {
+		d.Addresses = append(d.Addresses, domain.DerivedAddress(da))
+	}
+	return d, nil
+}
+
+// descriptorRecord is how a descriptor is stored in the descriptors
+// column, which holds a list of them.
+type descriptorRecord struct {
+	Descriptor string          `json:"descriptor"`
+	Start      uint32          `json:"start"`
+	End        uint32          `json:"end"`
+	Addresses  []derivedRecord `json:"addresses"`
+	Multisig   *multisigRecord `json:"multisig,omitempty"`
+	Conditions []string        `json:"conditions,omitempty"`
+}
+
+type multisigRecord struct {
+	Threshold int              `json:"threshold"`
+	Cosigners []cosignerRecord `json:"cosigners"`
+	Script    string           `json:"script"`
+	Sorted    bool             `json:"sorted"`
+}
+
+type cosignerRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Path        string `json:"path"`
+	Key         string `json:"key"`
+}
+
+func encodeDescriptors(ds []domain.AccountDescriptor,
+) (sql.NullString, error) {
+	if len(ds) == 0 {
+		return sql.NullString{}, nil
+	}
+	rs := make([]descriptorRecord, 0, len(ds))
+	for _, d := range ds {
+		r := descriptorRecord{
+			Descriptor: d.Descriptor,
+			Start:      d.Start,
+			End:        d.End,
+			Addresses:  make([]derivedRecord, 0, len(d.Addresses)),
+			Conditions: d.Conditions,
+		}
+		for _, da := range d.Addresses {
+			r.Addresses = append(r.Addresses, derivedRecord(da))
+		}
+		if m := d.Multisig; m != nil {
+			r.Multisig = &multisigRecord{
+				Threshold: m.Threshold,
+				Cosigners: make([]cosignerRecord, 0, len(m.Cosigners)),
+				Script:    string(m.Script),
+				Sorted:    m.Sorted,
+			}
+			for _, c := range m.Cosigners {
+				r.Multisig.Cosigners = append(r.Multisig.Cosigners,
+					cosignerRecord(c))
+			}
+		}
+		rs = append(rs, r)
+	}
+	b, err := json.Marshal(rs)
+	return sql.NullString{String: string(b), Valid: true}, err
+}
+
+func decodeDescriptors(s string) ([]domain.AccountDescriptor, error) {
+	var rs []descriptorRecord
+	if err := json.Unmarshal([]byte(s), &rs); err != nil {
+		return nil, fmt.Errorf("failed to decode descriptors: %w", err)
+	}
+	ds := make([]domain.AccountDescriptor, 0, len(rs))
+	for _, r := range rs {
+		d := domain.AccountDescriptor{
+			Descriptor: r.Descriptor,
+			Start:      r.Start,
+			End:        r.End,
+			Addresses: make([]domain.DerivedAddress, 0,
+				len(r.Addresses)),
+			Conditions: r.Conditions,
+		}
+		for _, da := range r.Addresses {
+			d.Addresses = append(d.Addresses, domain.DerivedAddress(da))
+		}
+		if m := r.Multisig; m != nil {
+			d.Multisig = &domain.Multisig{
+				Threshold: m.Threshold,
+				Cosigners: make([]domain.Cosigner, 0, len(m.Cosigners)),
+				Script:    domain.MultisigScript(m.Script),
+				Sorted:    m.Sorted,
+			}
+			for _, c := range m.Cosigners {
+				d.Multisig.Cosigners = append(d.Multisig.Cosigners,
+					domain.Cosigner(c))
+			}
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// insertDetails stores the addresses and labels of an account. The
+// labels are sealed with the data key of the account.
+func insertDetails(ctx context.Context, tx *sql.Tx, a domain.Account,
+	k dataKey) error {
+	for i, addr := range a.Addresses {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO account_addresses (account_id, position, address)
+			 VALUES ($1, $2, $3)`,
+			a.ID, i, addr)
+		if err != nil {
+			return fmt.Errorf("failed to insert address: %w", err)
+		}
+	}
+	for i, l := range a.Labels {
+		b, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		record, err := k.seal(sql.NullString{String: string(b), Valid: true},
+			additionalData("account_labels", "record", a.ID, i))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO account_labels
+			 (account_id, position, type, ref, record, data_key,
+			 key_version)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			a.ID, i, string(l.Type), l.Ref, record, k.wrapped, k.version)
+		if err != nil {
+			return fmt.Errorf("failed to insert label: %w", err)
+		}
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction that is committed if fn succeeds and
+// rolled back otherwise.
+func (s *Store) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,52 @@
+package sqldb
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+func TestListDerivedAccounts(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(openSQLite(t), testDialect)
+	var as []domain.Account
+	for _, name := range []string{"a", "b", "c"} {
+		as = append(as, testAccount(t, s, name))
+	}
+	q := domain.NewAccountQuery("")
+	slices.SortFunc(as, func(x, y domain.Account) int {
+		return q.Compare(x.Position(), y.Position())
+	})
+	var want []string
+	for _, a := range as {
+		want = append(want, a.ID)
+	}
+
+	var got []string
+	first, err := s.ListDerivedAccounts(ctx, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("first page has %d accounts, want 2", len(first))
+	}
+	for _, a := range first {
+		if len(a.Addresses) != 1 || len(a.Labels) != 1 {
+			t.Errorf("account %s has %d addresses and %d labels, "+
+				"want 1 each", a.ID, len(a.Addresses), len(a.Labels))
+		}
+		got = append(got, a.ID)
+	}
+	rest, err := s.ListDerivedAccounts(ctx, first[1].Position(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range rest {
+		got = append(got, a.ID)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("pages hold %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,332 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+var _ domain.AuditRepository = (*Store)(nil)
+
+// maxAuditAttempts bounds the retries of appends that lose the race for
+// the next sequence number.
+const maxAuditAttempts = 5
+
+// errAuditRace is returned when another append took the sequence number.
+var errAuditRace = errors.New("audit entry appended concurrently")
+
+// auditedTx runs fn in a transaction that also chains e to the last
+// entry of its account, stores it and moves the head of the chain to
+// it, so that a change is stored along with its audit entry or not at
+// all. The transaction is retried if another one took the sequence
+// number meanwhile.
+func (s *Store) auditedTx(ctx context.Context, e domain.AuditEntry,
+	fn func(tx *sql.Tx) error) error {
+	var err error
+	for range maxAuditAttempts {
+		err = s.inTx(ctx, func(tx *sql.Tx) error {
+			if err := fn(tx); err != nil {
+				return err
+			}
+			return s.appendAudit(ctx, tx, e)
+		})
+		if !errors.Is(err, errAuditRace) {
+			return err
+		}
+	}
+	return err
+}
+
+// appendAudit chains e to the last entry of its account, stores it and
+// moves the head of the chain to it.
+func (s *Store) appendAudit(ctx context.Context, tx *sql.Tx,
+	e domain.AuditEntry) error {
+	prev, err := s.lastAudit(ctx, tx, e.AccountID)
+	if err != nil {
+		return err
+	}
+	chained := e.Chain(prev)
+	if err := s.insertAudit(ctx, tx, chained); err != nil {
+		return err
+	}
+	return s.moveAuditHead(ctx, tx, chained.Head())
+}
+
+// ListAudit implements domain.AuditRepository.
+func (s *Store) ListAudit(ctx context.Context, accountID string,
+) ([]domain.AuditEntry, *domain.AuditHead, error) {
+	es, head, err := s.listAudit(ctx, accountID)
+	if err == nil && head == nil && len(es) > 0 {
+		// The first entry may have been appended after the head was read
+		es, head, err = s.listAudit(ctx, accountID)
+	}
+	return es, head, err
+}
+
+// listAudit reads the head of a chain before its entries, which are
+// read up to the head, so that entries appended meanwhile are left out.
+func (s *Store) listAudit(ctx context.Context, accountID string,
+) ([]domain.AuditEntry, *domain.AuditHead, error) {
+	head, err := s.auditHead(ctx, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	last := int64(math.MaxInt64)
+	if head != nil {
+		last = head.Seq
+	}
+	es, err := s.queryAudit(ctx, s.db,
+		`SELECT `+auditColumns+` FROM audit_entries e
+		 WHERE e.account_id = $1 AND e.seq <= $2 ORDER BY e.seq`,
+		accountID, last)
+	return es, head, err
+}
+
+// SignAuditHeads signs the heads of all audit chains with the audit key
+// and returns how many there are. It is meant to be run once the key is
+// set or changed, as heads signed otherwise fail verification.
+func (s *Store) SignAuditHeads(ctx context.Context) (int, error) {
+	if len(s.auditKey) == 0 {
+		return 0, errors.New("no audit key is configured")
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT account_id, seq, hash, mac FROM audit_heads`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read audit heads: %w", err)
+	}
+	var heads []domain.AuditHead
+	for rows.Next() {
+		var h domain.AuditHead
+		err := rows.Scan(&h.AccountID, &h.Seq, &h.Hash, &h.MAC)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read audit head: %w", err)
+		}
+		heads = append(heads, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for i, h := range heads {
+		signed := s.auditKey.Sign(h)
+		// Heads moved meanwhile are signed already
+		_, err := s.db.ExecContext(ctx,
+			`UPDATE audit_heads SET mac = $1
+			 WHERE account_id = $2 AND seq = $3 AND hash = $4`,
+			signed.MAC, h.AccountID, h.Seq, h.Hash)
+		if err != nil {
+			return i, fmt.Errorf("failed to sign audit head: %w", err)
+		}
+	}
+	return len(heads), nil
+}
+
+// redactAudit removes the user from the audit chains of the accounts of
+// other users, see domain.RedactAudit, and returns the number of entries
+// changed. The chains must be the only ones left that mention the user.
+func (s *Store) redactAudit(ctx context.Context, tx *sql.Tx,
+	userID string) (int, error) {
+	// Changes are sealed, so the entries of members are found by the
+	// member they were stored with
+	rows, err := tx.QueryContext(ctx,
+		`SELECT DISTINCT account_id FROM audit_entries
+		 WHERE actor = $1 OR member_id = $1`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find audit entries: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to find audit entries: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, id := range ids {
+		es, err := s.queryAudit(ctx, tx,
+			`SELECT `+auditColumns+` FROM audit_entries e
+			 WHERE e.account_id = $1 ORDER BY e.seq`, id)
+		if err != nil {
+			return 0, err
+		}
+		redacted, seqs := domain.RedactAudit(es, userID)
+		if len(seqs) == 0 {
+			continue
+		}
+		// The entries from the first one redacted on are stored again
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM audit_entries WHERE account_id = $1 AND seq >= $2`,
+			id, seqs[0])
+		if err != nil {
+			return 0, fmt.Errorf("failed to redact audit entries: %w", err)
+		}
+		for _, e := range redacted {
+			if e.Seq < seqs[0] {
+				continue
+			}
+			if err := s.insertAudit(ctx, tx, e); err != nil {
+				return 0, err
+			}
+		}
+		err = s.appendAudit(ctx, tx,
+			domain.NewRedactEntry(id, seqs, time.Now()))
+		if err != nil {
+			return 0, err
+		}
+		n += len(seqs)
+	}
+	return n, nil
+}
+
+func (s *Store) auditHead(ctx context.Context, accountID string,
+) (*domain.AuditHead, error) {
+	h := domain.AuditHead{AccountID: accountID}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT seq, hash, mac FROM audit_heads WHERE account_id = $1`,
+		accountID).Scan(&h.Seq, &h.Hash, &h.MAC)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit head: %w", err)
+	}
+	return &h, nil
+}
+
+// moveAuditHead signs h and stores it as the head of its chain. The
+// owner of the account is recorded along with it, so that the chain can
+// be erased with the data of the owner after the account was purged.
+func (s *Store) moveAuditHead(ctx context.Context, tx *sql.Tx,
+	h domain.AuditHead) error {
+	h = s.auditKey.Sign(h)
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO audit_heads (account_id, owner_id, seq, hash, mac)
+		 VALUES ($1, (SELECT owner_id FROM accounts WHERE id = $1), $2,
+		 $3, $4)
+		 ON CONFLICT (account_id) DO UPDATE
+		 SET seq = excluded.seq, hash = excluded.hash, mac = excluded.mac,
+		 owner_id = COALESCE(excluded.owner_id, audit_heads.owner_id)`,
+		h.AccountID, h.Seq, h.Hash, h.MAC)
+	if err != nil {
+		return fmt.Errorf("failed to move audit head: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) lastAudit(ctx context.Context, tx *sql.Tx,
+	accountID string) (*domain.AuditEntry, error) {
+	e, err := s.scanAudit(ctx, tx.QueryRowContext(ctx,
+		`SELECT `+auditColumns+` FROM audit_entries e
+		 WHERE e.account_id = $1 ORDER BY e.seq DESC LIMIT 1`,
+		accountID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit entry: %w", err)
+	}
+	return &e, nil
+}
+
+func (s *Store) insertAudit(ctx context.Context, tx *sql.Tx,
+	e domain.AuditEntry) error {
+	b, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+	k, err := s.newDataKey(ctx)
+	if err != nil {
+		return err
+	}
+	changes, err := k.seal(sql.NullString{String: string(b), Valid: true},
+		additionalData("audit_entries", "changes", e.AccountID, e.Seq))
+	if err != nil {
+		return err
+	}
+	member := sql.NullString{String: e.Member(), Valid: e.Member() != ""}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO audit_entries (account_id, seq, action, actor,
+		 member_id, trace_id, at, changes, data_key, key_version,
+		 prev_hash, hash)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		e.AccountID, e.Seq, string(e.Action), e.Actor, member, e.TraceID,
+		e.At, changes, k.wrapped, k.version, e.PrevHash, e.Hash)
+	if err != nil {
+		if s.dialect.IsUniqueViolation(err) {
+			return errAuditRace
+		}
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// querier runs queries in or outside of a transaction.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any,
+	) (*sql.Rows, error)
+}
+
+func (s *Store) queryAudit(ctx context.Context, q querier, query string,
+	args ...any) ([]domain.AuditEntry, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+	out := []domain.AuditEntry{}
+	for rows.Next() {
+		e, err := s.scanAudit(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// auditColumns lists the columns read by scanAudit.
+const auditColumns = `e.account_id, e.seq, e.action, e.actor, e.trace_id,
+	e.at, e.changes, e.data_key, e.key_version, e.prev_hash, e.hash`
+
+func (s *Store) scanAudit(ctx context.Context, row scanner,
+) (domain.AuditEntry, error) {
+	var (
+		e                   domain.AuditEntry
+		action              string
+		changes             sql.NullString
+		wrapped, keyVersion sql.NullString
+	)
+	err := row.Scan(&e.AccountID, &e.Seq, &action, &e.Actor, &e.TraceID,
+		&e.At, &changes, &wrapped, &keyVersion, &e.PrevHash, &e.Hash)
+	if err != nil {
+		return e, err
+	}
+	e.Action = domain.AuditAction(action)
+	k, err := s.openDataKey(ctx, wrapped, keyVersion)
+	if err != nil {
+		return e, err
+	}
+	changes, err = k.open(changes,
+		additionalData("audit_entries", "changes", e.AccountID, e.Seq))
+	if err != nil {
+		return e, err
+	}
+	err = json.Unmarshal([]byte(changes.String), &e.Changes)
+	if err != nil {
+		return e, fmt.Errorf("failed to decode audit changes: %w", err)
+	}
+	return e, nil
+}
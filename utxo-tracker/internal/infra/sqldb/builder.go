@@ -0,0 +1,36 @@
+package sqldb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxInArgs bounds the arguments of an IN list that grows with the
+// data, well below the 32766 parameters SQLite allows per statement.
+const maxInArgs = 500
+
+// queryBuilder collects the WHERE conditions and numbered arguments of a
+// query that is assembled at runtime.
+type queryBuilder struct {
+	conds []string
+	args  []any
+}
+
+// arg adds an argument and returns its placeholder.
+func (b *queryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// where adds a condition. All conditions must hold.
+func (b *queryBuilder) where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+// sql returns the WHERE clause, or an empty string without conditions.
+func (b *queryBuilder) sql() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
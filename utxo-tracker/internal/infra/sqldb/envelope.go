@@ -0,0 +1,331 @@
+package sqldb
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// sealedTable is a table whose sensitive columns are encrypted with a
+// data key per row. The data key is stored in the data_key column,
+// wrapped with the version of the key-encryption key in key_version.
+// Rows without data key are stored in plaintext.
+type sealedTable struct {
+	name string
+	// key lists the primary key columns
+	key []string
+	// columns lists the encrypted columns
+	columns []string
+}
+
+// sealedTables lists the tables with encrypted columns. The extended
+// keys and descriptors of accounts reveal all their addresses, as do the
+// audit entries of changes to them and the responses stored for
+// idempotency keys, which hold the accounts created. Labels are as
+// private as the wallets they were exported from.
+var sealedTables = []sealedTable{
+	{"accounts", []string{"id"}, []string{"derivation", "descriptors"}},
+	{"audit_entries", []string{"account_id", "seq"}, []string{"changes"}},
+	{"account_labels", []string{"account_id", "position"},
+		[]string{"record"}},
+	{"idempotency_keys", []string{"owner_id", "idempotency_key"},
+		[]string{"body"}},
+}
+
+// isSealed reports whether column of table is encrypted.
+func isSealed(table, column string) bool {
+	for _, t := range sealedTables {
+		if t.name == table {
+			return slices.Contains(t.columns, column)
+		}
+	}
+	return false
+}
+
+// dataKey encrypts the sealed columns of a row. The zero dataKey leaves
+// them in plaintext.
+type dataKey struct {
+	aead    cipher.AEAD
+	wrapped sql.NullString
+	version sql.NullString
+}
+
+// newDataKey returns a new data key wrapped with the current
+// key-encryption key, or the zero dataKey if no KMS is configured.
+func (s *Store) newDataKey(ctx context.Context) (dataKey, error) {
+	if s.kms == nil {
+		return dataKey{}, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return dataKey{}, err
+	}
+	wrapped, version, err := s.kms.Wrap(ctx, key)
+	if err != nil {
+		return dataKey{}, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	aead, err := newGCM(key)
+	return dataKey{
+		aead: aead,
+		wrapped: sql.NullString{
+			String: base64.StdEncoding.EncodeToString(wrapped),
+			Valid:  true,
+		},
+		version: sql.NullString{String: version, Valid: true},
+	}, err
+}
+
+// openDataKey unwraps the data key of a row read from the data_key and
+// key_version columns.
+func (s *Store) openDataKey(ctx context.Context, wrapped,
+	version sql.NullString) (dataKey, error) {
+	if !wrapped.Valid {
+		return dataKey{}, nil
+	}
+	if s.kms == nil {
+		return dataKey{}, errors.New(
+			"record is encrypted, but no KMS is configured")
+	}
+	b, err := base64.StdEncoding.DecodeString(wrapped.String)
+	if err != nil {
+		return dataKey{}, fmt.Errorf("failed to decode data key: %w", err)
+	}
+	key, err := s.kms.Unwrap(ctx, b, version.String)
+	if err != nil {
+		return dataKey{}, err
+	}
+	aead, err := newGCM(key)
+	return dataKey{aead: aead, wrapped: wrapped, version: version}, err
+}
+
+// seal encrypts the value of a column. NULL stays NULL. The additional
+// data binds the value to its row and column, so that it cannot be
+// moved elsewhere.
+func (k dataKey) seal(v sql.NullString, ad string) (sql.NullString, error) {
+	if k.aead == nil || !v.Valid {
+		return v, nil
+	}
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return v, err
+	}
+	b := k.aead.Seal(nonce, nonce, []byte(v.String), []byte(ad))
+	return sql.NullString{
+		String: base64.StdEncoding.EncodeToString(b),
+		Valid:  true,
+	}, nil
+}
+
+// open decrypts the value of a column sealed with the additional data
+// ad.
+func (k dataKey) open(v sql.NullString, ad string) (sql.NullString, error) {
+	if k.aead == nil || !v.Valid {
+		return v, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(v.String)
+	n := k.aead.NonceSize()
+	if err != nil || len(b) < n {
+		return v, errors.New("encrypted value is malformed")
+	}
+	b, err = k.aead.Open(nil, b[:n], b[n:], []byte(ad))
+	if err != nil {
+		return v, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// rotateBatchSize is the number of rows RotateDataKeys reads at a time.
+const rotateBatchSize = 100
+
+// RotateDataKeys wraps the data keys of all rows that are not wrapped
+// with the current key-encryption key with it, and encrypts the rows
+// written in plaintext. The encrypted columns of the others are left as
+// they are. It returns the number of rows changed.
+func (s *Store) RotateDataKeys(ctx context.Context) (int, error) {
+	if s.kms == nil {
+		return 0, errors.New("no KMS is configured")
+	}
+	total := 0
+	for _, t := range sealedTables {
+		var after []any
+		for {
+			rows, err := s.staleRows(ctx, t, after)
+			if err != nil {
+				return total, err
+			}
+			for _, r := range rows {
+				n, err := s.rotateRow(ctx, t, r)
+				if err != nil {
+					return total, err
+				}
+				total += n
+			}
+			if len(rows) < rotateBatchSize {
+				break
+			}
+			after = rows[len(rows)-1].key
+		}
+	}
+	return total, nil
+}
+
+// StaleRecords counts the rows of each table with encrypted columns that
+// are not encrypted under the current key-encryption key, including the
+// rows written in plaintext.
+func (s *Store) StaleRecords(ctx context.Context) (map[string]int, error) {
+	version := ""
+	if s.kms != nil {
+		version = s.kms.Version()
+	}
+	out := make(map[string]int, len(sealedTables))
+	for _, t := range sealedTables {
+		var n int
+		err := s.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM `+t.name+`
+			 WHERE data_key IS NULL OR key_version <> $1`,
+			version).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", t.name, err)
+		}
+		out[t.name] = n
+	}
+	return out, nil
+}
+
+// staleRow is a row read by staleRows.
+type staleRow struct {
+	key              []any
+	wrapped, version sql.NullString
+	columns          []sql.NullString
+}
+
+// staleRows reads the next batch of rows of t that are not encrypted
+// under the current key-encryption key, in the order of their primary
+// key, starting after the key after.
+func (s *Store) staleRows(ctx context.Context, t sealedTable,
+	after []any) ([]staleRow, error) {
+	var b queryBuilder
+	b.where(`(data_key IS NULL OR key_version <> ` +
+		b.arg(s.kms.Version()) + `)`)
+	if after != nil {
+		ps := make([]string, 0, len(after))
+		for _, v := range after {
+			ps = append(ps, b.arg(v))
+		}
+		b.where(`(` + strings.Join(t.key, ", ") + `) > (` +
+			strings.Join(ps, ", ") + `)`)
+	}
+	query := `SELECT ` + strings.Join(t.key, ", ") +
+		`, data_key, key_version, ` + strings.Join(t.columns, ", ") +
+		` FROM ` + t.name + b.sql() +
+		` ORDER BY ` + strings.Join(t.key, ", ") +
+		fmt.Sprintf(` LIMIT %d`, rotateBatchSize)
+	rows, err := s.db.QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", t.name, err)
+	}
+	defer rows.Close()
+	var out []staleRow
+	for rows.Next() {
+		r := staleRow{
+			key:     make([]any, len(t.key)),
+			columns: make([]sql.NullString, len(t.columns)),
+		}
+		dest := make([]any, 0, len(t.key)+2+len(t.columns))
+		for i := range r.key {
+			dest = append(dest, &r.key[i])
+		}
+		dest = append(dest, &r.wrapped, &r.version)
+		for i := range r.columns {
+			dest = append(dest, &r.columns[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", t.name, err)
+		}
+		for i, v := range r.key {
+			if b, ok := v.([]byte); ok {
+				r.key[i] = string(b)
+			}
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// rotateRow wraps the data key of a row with the current key-encryption
+// key, or encrypts the row if it was written in plaintext. Rows changed
+// since they were read got a new data key already and are skipped.
+func (s *Store) rotateRow(ctx context.Context, t sealedTable, r staleRow,
+) (int, error) {
+	var b queryBuilder
+	var set []string
+	if r.wrapped.Valid {
+		old, err := base64.StdEncoding.DecodeString(r.wrapped.String)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode data key: %w", err)
+		}
+		key, err := s.kms.Unwrap(ctx, old, r.version.String)
+		if err != nil {
+			return 0, err
+		}
+		wrapped, version, err := s.kms.Wrap(ctx, key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+		encoded := base64.StdEncoding.EncodeToString(wrapped)
+		set = append(set, `data_key = `+b.arg(encoded),
+			`key_version = `+b.arg(version))
+		b.where(`data_key = ` + b.arg(r.wrapped.String))
+	} else {
+		k, err := s.newDataKey(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for i, c := range t.columns {
+			v, err := k.seal(r.columns[i],
+				additionalData(t.name, c, r.key...))
+			if err != nil {
+				return 0, err
+			}
+			set = append(set, c+` = `+b.arg(v))
+		}
+		set = append(set, `data_key = `+b.arg(k.wrapped),
+			`key_version = `+b.arg(k.version))
+		b.where(`data_key IS NULL`)
+	}
+	for i, c := range t.key {
+		b.where(c + ` = ` + b.arg(r.key[i]))
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE `+t.name+` SET `+strings.Join(set, ", ")+b.sql(),
+		b.args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update %s: %w", t.name, err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// additionalData identifies a column of a row for seal and open.
+func additionalData(table, column string, key ...any) string {
+	parts := []string{table, column}
+	for _, k := range key {
+		parts = append(parts, fmt.Sprint(k))
+	}
+	return strings.Join(parts, "/")
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,285 @@
+package sqldb
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/address"
+	"github.com/hannesdejager/utxo-tracker/internal/domain/label"
+	"github.com/hannesdejager/utxo-tracker/internal/infra/kms"
+	_ "modernc.org/sqlite"
+)
+
+// The BIP84 account key of "abandon abandon … about" and its first
+// receive address.
+const (
+	testXpub    = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	testAddress = "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"
+)
+
+var testDialect = Dialect{IsUniqueViolation: func(error) bool {
+	return false
+}}
+
+// openSQLite returns a migrated SQLite database in a temporary
+// directory. The sqlite package cannot be imported here, as it imports
+// this one, so its migrations are read from its directory.
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite", "file:"+path+
+		"?_pragma=foreign_keys(1)&_time_format=sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	ms, err := LoadMigrations(os.DirFS("../sqlite"), "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(context.Background(), db, ms); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newKeys returns a key file with a random key for each version, the
+// last one being the current one.
+func newKeys(t *testing.T, versions ...string) map[string]string {
+	t.Helper()
+	keys := make(map[string]string)
+	for _, v := range versions {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		keys[v] = base64.StdEncoding.EncodeToString(b)
+	}
+	return keys
+}
+
+// openKeys writes the given versions of keys to a key file and opens it.
+func openKeys(t *testing.T, keys map[string]string,
+	versions ...string) *kms.File {
+	t.Helper()
+	var lines []string
+	for _, v := range versions {
+		lines = append(lines, v+" "+keys[v])
+	}
+	path := filepath.Join(t.TempDir(), "keys")
+	err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := kms.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func testAccount(t *testing.T, s *Store, name string) domain.Account {
+	t.Helper()
+	now := time.Now().UTC().Truncate(time.Second)
+	a := domain.Account{
+		ID:        domain.NewID(),
+		OwnerID:   "alice",
+		Name:      name,
+		Addresses: []string{testAddress},
+		Labels:    []label.Label{label.New(label.Addr, testAddress, "Salary")},
+		Chain:     address.Bitcoin,
+		Network:   address.Mainnet,
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Derivation: &domain.Derivation{
+			ExtendedKey: testXpub,
+			Purpose:     address.BIP84,
+			GapLimit:    20,
+			Addresses: []domain.DerivedAddress{
+				{Address: testAddress, Path: "m/84'/0'/0'/0/0"}},
+		},
+	}
+	e := domain.NewAuditEntry(a.ID, domain.AuditCreate, "alice", "",
+		[]domain.AuditChange{{Field: "derivation",
+			After: json.RawMessage(`"` + testXpub + `"`)}}, now)
+	if err := s.CreateAccount(context.Background(), a, e); err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	return a
+}
+
+// testIdempotencyKey stores the response of a request that created
+// account a under an idempotency key.
+func testIdempotencyKey(t *testing.T, s *Store, a domain.Account,
+) domain.IdempotencyRecord {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	rec := domain.IdempotencyRecord{
+		OwnerID:     a.OwnerID,
+		Key:         a.Name,
+		Fingerprint: "f",
+		ExpiresAt:   now.Add(time.Hour),
+	}
+	if _, err := s.ReserveIdempotencyKey(ctx, rec, now); err != nil {
+		t.Fatalf("ReserveIdempotencyKey: %v", err)
+	}
+	rec.Status = 201
+	rec.Header = map[string][]string{"Content-Type": {"application/json"}}
+	rec.Body = []byte(`{"derivation":{"extendedKey":"` + testXpub + `"}}`)
+	if err := s.CompleteIdempotencyKey(ctx, rec); err != nil {
+		t.Fatalf("CompleteIdempotencyKey: %v", err)
+	}
+	return rec
+}
+
+func TestSealOpen(t *testing.T) {
+	keys := newKeys(t, "v1")
+	s := NewStore(nil, testDialect, WithKMS(openKeys(t, keys, "v1")))
+	ctx := context.Background()
+	k, err := s.newDataKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := sql.NullString{String: testXpub, Valid: true}
+	ad := additionalData("accounts", "derivation", "a1")
+	sealed, err := k.seal(v, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed.String, testXpub) {
+		t.Fatal("sealed value holds the plaintext")
+	}
+	opened, err := s.openDataKey(ctx, k.wrapped, k.version)
+	if err != nil {
+		t.Fatalf("openDataKey: %v", err)
+	}
+	if got, err := opened.open(sealed, ad); err != nil || got != v {
+		t.Errorf("open = %v, %v, want %v", got, err, v)
+	}
+	other := additionalData("accounts", "derivation", "a2")
+	if _, err := opened.open(sealed, other); err == nil {
+		t.Error("opened a value moved to another row")
+	}
+	if got, _ := k.seal(sql.NullString{}, ad); got.Valid {
+		t.Errorf("seal(NULL) = %v", got)
+	}
+	if got, _ := (dataKey{}).seal(v, ad); got != v {
+		t.Errorf("seal without data key = %v, want %v", got, v)
+	}
+}
+
+func TestRotateDataKeys(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	keys := newKeys(t, "v1", "v2")
+	plainStore := NewStore(db, testDialect)
+	plain := testAccount(t, plainStore, "plain")
+	plainKey := testIdempotencyKey(t, plainStore, plain)
+	v1 := NewStore(db, testDialect, WithKMS(openKeys(t, keys, "v1")))
+	sealed := testAccount(t, v1, "sealed")
+	sealedKey := testIdempotencyKey(t, v1, sealed)
+
+	for _, q := range []struct{ query, plaintext string }{
+		{`SELECT derivation FROM accounts WHERE id = $1`, testXpub},
+		{`SELECT record FROM account_labels WHERE account_id = $1`,
+			"Salary"},
+		{`SELECT changes FROM audit_entries WHERE account_id = $1`,
+			testXpub},
+	} {
+		var v string
+		if err := db.QueryRow(q.query, sealed.ID).Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(v, q.plaintext) {
+			t.Fatalf("%s returned plaintext", q.query)
+		}
+	}
+	var body []byte
+	err := db.QueryRow(`SELECT body FROM idempotency_keys
+		WHERE idempotency_key = $1`, sealed.Name).Scan(&body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), testXpub) {
+		t.Fatal("idempotent response is stored in plaintext")
+	}
+
+	v2 := NewStore(db, testDialect,
+		WithKMS(openKeys(t, keys, "v1", "v2")))
+	stale, err := v2.StaleRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"accounts": 2, "audit_entries": 2,
+		"account_labels": 2, "idempotency_keys": 2}
+	if !reflect.DeepEqual(stale, want) {
+		t.Errorf("StaleRecords = %v, want %v", stale, want)
+	}
+	if n, err := v2.RotateDataKeys(ctx); err != nil || n != 8 {
+		t.Fatalf("RotateDataKeys = %d, %v, want 8", n, err)
+	}
+	if n, err := v2.RotateDataKeys(ctx); err != nil || n != 0 {
+		t.Errorf("second RotateDataKeys = %d, %v, want 0", n, err)
+	}
+	stale, _ = v2.StaleRecords(ctx)
+	want = map[string]int{"accounts": 0, "audit_entries": 0,
+		"account_labels": 0, "idempotency_keys": 0}
+	if !reflect.DeepEqual(stale, want) {
+		t.Errorf("StaleRecords after rotation = %v, want %v", stale, want)
+	}
+
+	// v1 can be removed once all records are rotated
+	only := NewStore(db, testDialect, WithKMS(openKeys(t, keys, "v2")))
+	for _, a := range []domain.Account{plain, sealed} {
+		got, err := only.GetAccount(ctx, a.OwnerID, a.ID)
+		if err != nil {
+			t.Fatalf("GetAccount(%s): %v", a.Name, err)
+		}
+		if !reflect.DeepEqual(got.Derivation, a.Derivation) {
+			t.Errorf("GetAccount(%s) derivation %+v, want %+v",
+				a.Name, got.Derivation, a.Derivation)
+		}
+		if !reflect.DeepEqual(got.Labels, a.Labels) {
+			t.Errorf("GetAccount(%s) labels %+v, want %+v",
+				a.Name, got.Labels, a.Labels)
+		}
+		es, _, err := only.ListAudit(ctx, a.ID)
+		if err != nil || len(es) != 1 {
+			t.Fatalf("ListAudit(%s) = %d entries, %v", a.Name, len(es),
+				err)
+		}
+		if after := string(es[0].Changes[0].After); !strings.Contains(
+			after, testXpub) {
+			t.Errorf("ListAudit(%s) change %s", a.Name, after)
+		}
+	}
+	for _, rec := range []domain.IdempotencyRecord{plainKey, sealedKey} {
+		got, err := only.ReserveIdempotencyKey(ctx, rec, time.Now())
+		if err != nil || got == nil {
+			t.Fatalf("ReserveIdempotencyKey(%s) = %v, %v", rec.Key, got,
+				err)
+		}
+		if string(got.Body) != string(rec.Body) {
+			t.Errorf("ReserveIdempotencyKey(%s) body %s, want %s",
+				rec.Key, got.Body, rec.Body)
+		}
+	}
+	_, err = v1.GetAccount(ctx, sealed.OwnerID, sealed.ID)
+	if !errors.Is(err, kms.ErrUnknownVersion) {
+		t.Errorf("GetAccount with v1 only = %v, want %v", err,
+			kms.ErrUnknownVersion)
+	}
+}
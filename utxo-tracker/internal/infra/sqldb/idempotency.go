@@ -0,0 +1,155 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+var _ domain.IdempotencyRepository = (*Store)(nil)
+
+// ReserveIdempotencyKey implements domain.IdempotencyRepository.
+func (s *Store) ReserveIdempotencyKey(ctx context.Context,
+	rec domain.IdempotencyRecord, now time.Time,
+) (*domain.IdempotencyRecord, error) {
+	var existing *domain.IdempotencyRecord
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM idempotency_keys
+			 WHERE owner_id = $1 AND idempotency_key = $2 AND expires_at <= $3`,
+			rec.OwnerID, rec.Key, now)
+		if err != nil {
+			return fmt.Errorf("failed to delete idempotency key: %w", err)
+		}
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO idempotency_keys
+			 (owner_id, idempotency_key, fingerprint, expires_at)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (owner_id, idempotency_key) DO NOTHING`,
+			rec.OwnerID, rec.Key, rec.Fingerprint, rec.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert idempotency key: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+		existing, err = s.readIdempotencyKey(ctx, tx, rec.OwnerID, rec.Key)
+		return err
+	})
+	return existing, err
+}
+
+// CompleteIdempotencyKey implements domain.IdempotencyRepository.
+func (s *Store) CompleteIdempotencyKey(ctx context.Context,
+	rec domain.IdempotencyRecord) error {
+	header, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+	k, err := s.newDataKey(ctx)
+	if err != nil {
+		return err
+	}
+	body := rec.Body
+	if k.aead != nil && body != nil {
+		v, err := k.seal(sql.NullString{String: string(body), Valid: true},
+			additionalData("idempotency_keys", "body", rec.OwnerID,
+				rec.Key))
+		if err != nil {
+			return err
+		}
+		body = []byte(v.String)
+	}
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE idempotency_keys
+		 SET status = $1, header = $2, body = $3, expires_at = $4,
+		 data_key = $5, key_version = $6
+		 WHERE owner_id = $7 AND idempotency_key = $8`,
+		rec.Status, string(header), body, rec.ExpiresAt, k.wrapped,
+		k.version, rec.OwnerID, rec.Key)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// ExtendIdempotencyKey implements domain.IdempotencyRepository.
+func (s *Store) ExtendIdempotencyKey(ctx context.Context,
+	rec domain.IdempotencyRecord) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET expires_at = $1
+		 WHERE owner_id = $2 AND idempotency_key = $3
+		 AND fingerprint = $4 AND status = 0`,
+		rec.ExpiresAt, rec.OwnerID, rec.Key, rec.Fingerprint)
+	if err != nil {
+		return fmt.Errorf("failed to extend idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey implements domain.IdempotencyRepository.
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context,
+	ownerID, key string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE owner_id = $1 AND idempotency_key = $2`,
+		ownerID, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys implements domain.IdempotencyRepository.
+func (s *Store) DeleteExpiredIdempotencyKeys(ctx context.Context,
+	now time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		return fmt.Errorf("failed to delete idempotency keys: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) readIdempotencyKey(ctx context.Context, tx *sql.Tx,
+	ownerID, key string) (*domain.IdempotencyRecord, error) {
+	rec := domain.IdempotencyRecord{OwnerID: ownerID, Key: key}
+	var (
+		header              string
+		wrapped, keyVersion sql.NullString
+	)
+	err := tx.QueryRowContext(ctx,
+		`SELECT fingerprint, status, header, body, data_key, key_version,
+		 expires_at
+		 FROM idempotency_keys WHERE owner_id = $1 AND idempotency_key = $2`,
+		ownerID, key).Scan(&rec.Fingerprint, &rec.Status, &header,
+		&rec.Body, &wrapped, &keyVersion, &rec.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released between the insert and this read
+		return nil, domain.ErrIdempotencyKeyInUse
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idempotency key: %w", err)
+	}
+	if err := json.Unmarshal([]byte(header), &rec.Header); err != nil {
+		return nil, fmt.Errorf("failed to decode stored header: %w", err)
+	}
+	if rec.Body == nil {
+		return &rec, nil
+	}
+	k, err := s.openDataKey(ctx, wrapped, keyVersion)
+	if err != nil {
+		return nil, err
+	}
+	body, err := k.open(sql.NullString{String: string(rec.Body), Valid: true},
+		additionalData("idempotency_keys", "body", ownerID, key))
+	if err != nil {
+		return nil, err
+	}
+	rec.Body = []byte(body.String)
+	return &rec, nil
+}
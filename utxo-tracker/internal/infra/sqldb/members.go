@@ -0,0 +1,166 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+var _ domain.MemberRepository = (*Store)(nil)
+
+// AddMember implements domain.MemberRepository.
+func (s *Store) AddMember(ctx context.Context, m domain.Member,
+	e domain.AuditEntry) error {
+	return s.auditedTx(ctx, e, func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRowContext(ctx,
+			`SELECT 1 FROM accounts WHERE id = $1 AND deleted_at IS NULL`,
+			m.AccountID).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrAccountNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read account: %w", err)
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO account_members (account_id, user_id, role,
+			 invited_by, invited_at, accepted_at)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			m.AccountID, m.UserID, string(m.Role), m.InvitedBy,
+			m.InvitedAt, m.AcceptedAt)
+		if err != nil {
+			if s.dialect.IsUniqueViolation(err) {
+				return domain.ErrDuplicateMember
+			}
+			return fmt.Errorf("failed to insert member: %w", err)
+		}
+		return nil
+	})
+}
+
+// AcceptInvitation implements domain.MemberRepository.
+func (s *Store) AcceptInvitation(ctx context.Context, m domain.Member,
+	e domain.AuditEntry) error {
+	return s.auditedTx(ctx, e, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE account_members SET accepted_at = $1
+			 WHERE account_id = $2 AND user_id = $3
+			 AND accepted_at IS NULL`,
+			m.AcceptedAt, m.AccountID, m.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to accept invitation: %w", err)
+		}
+		return affected(res, domain.ErrMemberNotFound)
+	})
+}
+
+// RemoveMember implements domain.MemberRepository.
+func (s *Store) RemoveMember(ctx context.Context, accountID,
+	userID string, e domain.AuditEntry) error {
+	return s.auditedTx(ctx, e, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`DELETE FROM account_members
+			 WHERE account_id = $1 AND user_id = $2`,
+			accountID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete member: %w", err)
+		}
+		return affected(res, domain.ErrMemberNotFound)
+	})
+}
+
+// ListMembers implements domain.MemberRepository.
+func (s *Store) ListMembers(ctx context.Context, accountID string,
+) ([]domain.Member, error) {
+	return s.queryMembers(ctx,
+		`SELECT `+memberColumns+` FROM account_members m
+		 WHERE m.account_id = $1 ORDER BY m.invited_at, m.user_id`,
+		accountID)
+}
+
+// ListMemberships implements domain.MemberRepository.
+func (s *Store) ListMemberships(ctx context.Context, userID string,
+) ([]domain.Member, error) {
+	return s.queryMembers(ctx,
+		`SELECT `+memberColumns+`
+		 FROM account_members m JOIN accounts a ON a.id = m.account_id
+		 WHERE m.user_id = $1 AND a.deleted_at IS NULL
+		 ORDER BY m.invited_at, m.account_id`,
+		userID)
+}
+
+// GetSharedAccount implements domain.MemberRepository.
+func (s *Store) GetSharedAccount(ctx context.Context, userID,
+	accountID string) (domain.Account, domain.Role, error) {
+	var role string
+	a, err := s.scanAccount(ctx, s.db.QueryRowContext(ctx,
+		`SELECT m.role, `+accountColumns+`
+		 FROM account_members m JOIN accounts a ON a.id = m.account_id
+		 WHERE m.account_id = $1 AND m.user_id = $2
+		 AND m.accepted_at IS NOT NULL AND a.deleted_at IS NULL`,
+		accountID, userID), &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Account{}, "", domain.ErrAccountNotFound
+	}
+	if err != nil {
+		return domain.Account{}, "", fmt.Errorf(
+			"failed to read account: %w", err)
+	}
+	as := []domain.Account{a}
+	if err := s.loadDetails(ctx, as); err != nil {
+		return domain.Account{}, "", err
+	}
+	return as[0], domain.Role(role), nil
+}
+
+// affected returns errNone if the statement behind res changed no row.
+func affected(res sql.Result, errNone error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNone
+	}
+	return nil
+}
+
+func (s *Store) queryMembers(ctx context.Context, query string,
+	args ...any) ([]domain.Member, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	defer rows.Close()
+	out := []domain.Member{}
+	for rows.Next() {
+		m, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// memberColumns lists the columns read by scanMember.
+const memberColumns = `m.account_id, m.user_id, m.role, m.invited_by,
+	m.invited_at, m.accepted_at`
+
+func scanMember(row scanner) (domain.Member, error) {
+	var (
+		m        domain.Member
+		role     string
+		accepted sql.NullTime
+	)
+	err := row.Scan(&m.AccountID, &m.UserID, &role, &m.InvitedBy,
+		&m.InvitedAt, &accepted)
+	m.Role = domain.Role(role)
+	if accepted.Valid {
+		m.AcceptedAt = &accepted.Time
+	}
+	return m, err
+}
@@ -0,0 +1,162 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+// Migration is a single versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// LoadMigrations reads the *.sql files in dir of fsys. File names
+// must start with a version number followed by an underscore, for
+// example 0001_create_accounts.sql. Migrations are returned in version
+// order.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	ms := make([]Migration, 0, len(files))
+	seen := make(map[int]string)
+	for _, f := range files {
+		name := strings.TrimSuffix(path.Base(f), ".sql")
+		num, _, ok := strings.Cut(name, "_")
+		v, err := strconv.Atoi(num)
+		if !ok || err != nil || v <= 0 {
+			return nil, fmt.Errorf(
+				"migration %s: name must start with a version", f)
+		}
+		if other, dup := seen[v]; dup {
+			return nil, fmt.Errorf(
+				"migrations %s and %s share version %d", other, f, v)
+		}
+		seen[v] = f
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, Migration{Version: v, Name: name, SQL: string(b)})
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		return ms[i].Version < ms[j].Version
+	})
+	return ms, nil
+}
+
+const createVersionTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+// Migrate applies the migrations that have not been recorded in the
+// schema_migrations table yet, in version order.
+//
+// Each migration is recorded in the same transaction as its SQL, so a
+// migration that fails or is interrupted is rolled back as a whole and
+// retried on the next run.
+func Migrate(ctx context.Context, db *sql.DB, ms []Migration) error {
+	if _, err := db.ExecContext(ctx, createVersionTable); err != nil {
+		return fmt.Errorf("failed to create version table: %w", err)
+	}
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, m := range ms {
+		if applied[m.Version] {
+			continue
+		}
+		if err := apply(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.Name, err)
+		}
+	}
+	return fillNameKeys(ctx, db)
+}
+
+// fillNameKeys folds the names of the accounts written before the
+// name_key column was added. This is done here rather than in SQL, so
+// that names are folded alike on every database.
+func fillNameKeys(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, name FROM accounts WHERE name_key IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to read account names: %w", err)
+	}
+	names := make(map[string]string)
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		names[id] = name
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, name := range names {
+		_, err := db.ExecContext(ctx,
+			`UPDATE accounts SET name_key = $1
+			 WHERE id = $2 AND name_key IS NULL`,
+			domain.FoldName(name), id)
+		if err != nil {
+			return fmt.Errorf("failed to fold account name: %w", err)
+		}
+	}
+	return nil
+}
+
+// appliedVersions returns the recorded versions.
+func appliedVersions(ctx context.Context, db *sql.DB) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	defer rows.Close()
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+func apply(ctx context.Context, db *sql.DB, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, applied_at)
+		 VALUES ($1, $2, $3)`,
+		m.Version, m.Name, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,219 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+var _ domain.PortfolioRepository = (*Store)(nil)
+
+// CreatePortfolio implements domain.PortfolioRepository.
+func (s *Store) CreatePortfolio(ctx context.Context, p domain.Portfolio,
+) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO portfolios (id, owner_id, name, version,
+			 created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+			p.ID, p.OwnerID, p.Name, p.Version, p.CreatedAt, p.UpdatedAt)
+		if err != nil {
+			if s.dialect.IsUniqueViolation(err) {
+				return domain.ErrDuplicatePortfolio
+			}
+			return fmt.Errorf("failed to insert portfolio: %w", err)
+		}
+		return insertMembers(ctx, tx, p)
+	})
+}
+
+// GetPortfolio implements domain.PortfolioRepository.
+func (s *Store) GetPortfolio(ctx context.Context, ownerID, id string,
+) (domain.Portfolio, error) {
+	p, err := scanPortfolio(s.db.QueryRowContext(ctx,
+		`SELECT `+portfolioColumns+` FROM portfolios p
+		 WHERE p.id = $1 AND p.owner_id = $2`,
+		id, ownerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Portfolio{}, domain.ErrPortfolioNotFound
+	}
+	if err != nil {
+		return domain.Portfolio{}, fmt.Errorf(
+			"failed to read portfolio: %w", err)
+	}
+	ps := []domain.Portfolio{p}
+	if err := s.loadMembers(ctx, ps); err != nil {
+		return domain.Portfolio{}, err
+	}
+	return ps[0], nil
+}
+
+// ListPortfolios implements domain.PortfolioRepository.
+func (s *Store) ListPortfolios(ctx context.Context, ownerID string,
+) ([]domain.Portfolio, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+portfolioColumns+` FROM portfolios p
+		 WHERE p.owner_id = $1 ORDER BY p.created_at, p.id`, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list portfolios: %w", err)
+	}
+	defer rows.Close()
+	out := []domain.Portfolio{}
+	for rows.Next() {
+		p, err := scanPortfolio(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, s.loadMembers(ctx, out)
+}
+
+// UpdatePortfolio implements domain.PortfolioRepository.
+func (s *Store) UpdatePortfolio(ctx context.Context, p domain.Portfolio,
+	version int64) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE portfolios SET name = $1, version = $2, updated_at = $3
+			 WHERE id = $4 AND owner_id = $5 AND version = $6`,
+			p.Name, p.Version, p.UpdatedAt, p.ID, p.OwnerID, version)
+		if err != nil {
+			if s.dialect.IsUniqueViolation(err) {
+				return domain.ErrDuplicatePortfolio
+			}
+			return fmt.Errorf("failed to update portfolio: %w", err)
+		}
+		err = portfolioVersionMatched(ctx, tx, res, p.OwnerID, p.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM portfolio_accounts WHERE portfolio_id = $1`, p.ID)
+		if err != nil {
+			return fmt.Errorf("failed to delete members: %w", err)
+		}
+		return insertMembers(ctx, tx, p)
+	})
+}
+
+// DeletePortfolio implements domain.PortfolioRepository.
+func (s *Store) DeletePortfolio(ctx context.Context, ownerID, id string,
+	version int64) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`DELETE FROM portfolios
+			 WHERE id = $1 AND owner_id = $2 AND version = $3`,
+			id, ownerID, version)
+		if err != nil {
+			return fmt.Errorf("failed to delete portfolio: %w", err)
+		}
+		return portfolioVersionMatched(ctx, tx, res, ownerID, id)
+	})
+}
+
+// portfolioVersionMatched is the versionMatched of portfolios.
+func portfolioVersionMatched(ctx context.Context, tx *sql.Tx,
+	res sql.Result, ownerID, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+	var exists int
+	err = tx.QueryRowContext(ctx,
+		`SELECT 1 FROM portfolios WHERE id = $1 AND owner_id = $2`,
+		id, ownerID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrPortfolioNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return domain.ErrVersionMismatch
+}
+
+// insertMembers stores the members of a portfolio after checking that
+// they are accounts of its owner.
+func insertMembers(ctx context.Context, tx *sql.Tx, p domain.Portfolio,
+) error {
+	if len(p.AccountIDs) == 0 {
+		return nil
+	}
+	var b queryBuilder
+	owner := b.arg(p.OwnerID)
+	ids := make([]string, 0, len(p.AccountIDs))
+	for _, id := range p.AccountIDs {
+		ids = append(ids, b.arg(id))
+	}
+	var n int
+	err := tx.QueryRowContext(ctx,
+		`SELECT count(*) FROM accounts WHERE owner_id = `+owner+`
+		 AND deleted_at IS NULL
+		 AND id IN (`+strings.Join(ids, ", ")+`)`,
+		b.args...).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("failed to check members: %w", err)
+	}
+	if n != len(p.AccountIDs) {
+		return domain.ErrUnknownMember
+	}
+	for i, id := range p.AccountIDs {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO portfolio_accounts
+			 (portfolio_id, account_id, position) VALUES ($1, $2, $3)`,
+			p.ID, id, i)
+		if err != nil {
+			return fmt.Errorf("failed to insert member: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadMembers fills in the members of the given portfolios.
+func (s *Store) loadMembers(ctx context.Context, ps []domain.Portfolio,
+) error {
+	if len(ps) == 0 {
+		return nil
+	}
+	var b queryBuilder
+	idx := make(map[string]int, len(ps))
+	ids := make([]string, 0, len(ps))
+	for i, p := range ps {
+		idx[p.ID] = i
+		ids = append(ids, b.arg(p.ID))
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT portfolio_id, account_id FROM portfolio_accounts
+		 WHERE portfolio_id IN (`+strings.Join(ids, ", ")+`)
+		 ORDER BY portfolio_id, position`, b.args...)
+	if err != nil {
+		return fmt.Errorf("failed to read members: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pid, aid string
+		if err := rows.Scan(&pid, &aid); err != nil {
+			return err
+		}
+		if i, ok := idx[pid]; ok {
+			ps[i].AccountIDs = append(ps[i].AccountIDs, aid)
+		}
+	}
+	return rows.Err()
+}
+
+// portfolioColumns lists the columns read by scanPortfolio.
+const portfolioColumns = `p.id, p.owner_id, p.name, p.version,
+	p.created_at, p.updated_at`
+
+func scanPortfolio(row scanner) (domain.Portfolio, error) {
+	p := domain.Portfolio{AccountIDs: []string{}}
+	err := row.Scan(&p.ID, &p.OwnerID, &p.Name, &p.Version,
+		&p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
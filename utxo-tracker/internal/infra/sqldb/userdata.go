@@ -0,0 +1,275 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hannesdejager/utxo-tracker/internal/domain"
+)
+
+var (
+	_ domain.UserDataRepository = (*Store)(nil)
+	_ domain.ErasureRepository  = (*Store)(nil)
+)
+
+// ExportUserData implements domain.UserDataRepository.
+func (s *Store) ExportUserData(ctx context.Context, userID string,
+) (domain.UserData, error) {
+	d := domain.UserData{Accounts: []domain.Account{}}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+accountColumns+` FROM accounts a
+		 WHERE a.owner_id = $1 ORDER BY a.created_at, a.id`, userID)
+	if err != nil {
+		return d, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a, err := s.scanAccount(ctx, rows)
+		if err != nil {
+			return d, err
+		}
+		d.Accounts = append(d.Accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+	if err := s.loadDetails(ctx, d.Accounts); err != nil {
+		return d, err
+	}
+	d.Members, err = s.queryMembers(ctx,
+		`SELECT `+memberColumns+`
+		 FROM account_members m JOIN accounts a ON a.id = m.account_id
+		 WHERE a.owner_id = $1 ORDER BY m.account_id, m.invited_at`,
+		userID)
+	if err != nil {
+		return d, err
+	}
+	d.Memberships, err = s.queryMembers(ctx,
+		`SELECT `+memberColumns+` FROM account_members m
+		 WHERE m.user_id = $1 ORDER BY m.invited_at, m.account_id`,
+		userID)
+	if err != nil {
+		return d, err
+	}
+	d.Portfolios, err = s.ListPortfolios(ctx, userID)
+	if err != nil {
+		return d, err
+	}
+	ids, err := s.auditedAccounts(ctx, userID)
+	if err != nil {
+		return d, err
+	}
+	d.Audit = []domain.AuditEntry{}
+	for _, id := range ids {
+		es, head, err := s.ListAudit(ctx, id)
+		if err != nil {
+			return d, err
+		}
+		d.Audit = append(d.Audit, es...)
+		if head != nil {
+			d.AuditHeads = append(d.AuditHeads, *head)
+		}
+	}
+	return d, nil
+}
+
+// auditedAccounts returns the IDs of the accounts of the owner with an
+// audit chain, purged ones included.
+func (s *Store) auditedAccounts(ctx context.Context, ownerID string,
+) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT h.account_id FROM audit_heads h
+		 LEFT JOIN accounts a ON a.id = h.account_id
+		 WHERE h.owner_id = $1
+		 ORDER BY a.created_at IS NULL, a.created_at, h.account_id`,
+		ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit chains: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to list audit chains: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// EraseUserData implements domain.UserDataRepository.
+func (s *Store) EraseUserData(ctx context.Context, userID string,
+) (domain.ErasedData, error) {
+	var (
+		d   domain.ErasedData
+		err error
+	)
+	// Entries appended to a chain being redacted fail the transaction
+	for range maxAuditAttempts {
+		err = s.inTx(ctx, func(tx *sql.Tx) error {
+			return s.eraseUserData(ctx, tx, userID, &d)
+		})
+		if !errors.Is(err, errAuditRace) {
+			break
+		}
+	}
+	if err != nil {
+		return domain.ErasedData{}, err
+	}
+	return d, nil
+}
+
+func (s *Store) eraseUserData(ctx context.Context, tx *sql.Tx,
+	userID string, d *domain.ErasedData) error {
+	// The audit chains are kept when accounts are purged, so they are
+	// found through the owner recorded in their heads
+	for _, t := range []string{"audit_entries", "audit_heads"} {
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM `+t+` WHERE account_id IN (
+			 SELECT account_id FROM audit_heads WHERE owner_id = $1
+			 UNION SELECT id FROM accounts WHERE owner_id = $1)`,
+			userID)
+		if err != nil {
+			return fmt.Errorf("failed to erase user data: %w", err)
+		}
+	}
+	// Addresses, labels, members and portfolio entries of the accounts
+	// go with the cascade.
+	for _, c := range []struct {
+		n     *int
+		query string
+	}{
+		{&d.Memberships, `DELETE FROM account_members WHERE user_id = $1`},
+		{&d.Portfolios, `DELETE FROM portfolios WHERE owner_id = $1`},
+		{&d.Accounts, `DELETE FROM accounts WHERE owner_id = $1`},
+		{&d.IdempotencyKeys,
+			`DELETE FROM idempotency_keys WHERE owner_id = $1`},
+	} {
+		res, err := tx.ExecContext(ctx, c.query, userID)
+		if err != nil {
+			return fmt.Errorf("failed to erase user data: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		*c.n = int(n)
+	}
+	var err error
+	d.AuditEntries, err = s.redactAudit(ctx, tx, userID)
+	return err
+}
+
+// CreateErasure implements domain.ErasureRepository.
+func (s *Store) CreateErasure(ctx context.Context, e domain.Erasure) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO erasures (id, user_id, status, requested_at)
+		 VALUES ($1, $2, $3, $4)`,
+		e.ID, e.UserID, string(e.Status), e.RequestedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert erasure: %w", err)
+	}
+	return nil
+}
+
+// UpdateErasure implements domain.ErasureRepository.
+func (s *Store) UpdateErasure(ctx context.Context, e domain.Erasure) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE erasures SET status = $1, started_at = $2,
+		 completed_at = $3, accounts = $4, portfolios = $5,
+		 memberships = $6, idempotency_keys = $7, audit_entries = $8
+		 WHERE id = $9 AND user_id = $10`,
+		string(e.Status), e.StartedAt, e.CompletedAt, e.Erased.Accounts,
+		e.Erased.Portfolios, e.Erased.Memberships,
+		e.Erased.IdempotencyKeys, e.Erased.AuditEntries, e.ID, e.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to update erasure: %w", err)
+	}
+	return affected(res, domain.ErrErasureNotFound)
+}
+
+// GetErasure implements domain.ErasureRepository.
+func (s *Store) GetErasure(ctx context.Context, userID, id string,
+) (domain.Erasure, error) {
+	e, err := scanErasure(s.db.QueryRowContext(ctx,
+		`SELECT `+erasureColumns+` FROM erasures
+		 WHERE id = $1 AND user_id = $2`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Erasure{}, domain.ErrErasureNotFound
+	}
+	if err != nil {
+		return domain.Erasure{}, fmt.Errorf(
+			"failed to read erasure: %w", err)
+	}
+	return e, nil
+}
+
+// ClaimErasure implements domain.ErasureRepository.
+func (s *Store) ClaimErasure(ctx context.Context, e domain.Erasure,
+	stale time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE erasures SET status = $1, started_at = $2
+		 WHERE id = $3 AND user_id = $4 AND (status = $5
+		 OR status = $1 AND started_at < $6)`,
+		string(domain.ErasureRunning), e.StartedAt, e.ID, e.UserID,
+		string(domain.ErasurePending), stale)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim erasure: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ListUnfinishedErasures implements domain.ErasureRepository.
+func (s *Store) ListUnfinishedErasures(ctx context.Context,
+) ([]domain.Erasure, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+erasureColumns+` FROM erasures
+		 WHERE status IN ($1, $2) ORDER BY requested_at`,
+		string(domain.ErasurePending), string(domain.ErasureRunning))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list erasures: %w", err)
+	}
+	defer rows.Close()
+	var out []domain.Erasure
+	for rows.Next() {
+		e, err := scanErasure(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read erasure: %w", err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// erasureColumns lists the columns read by scanErasure.
+const erasureColumns = `id, user_id, status, requested_at, started_at,
+	completed_at, accounts, portfolios, memberships, idempotency_keys,
+	audit_entries`
+
+func scanErasure(row scanner) (domain.Erasure, error) {
+	var (
+		e                  domain.Erasure
+		status             string
+		started, completed sql.NullTime
+	)
+	err := row.Scan(&e.ID, &e.UserID, &status, &e.RequestedAt, &started,
+		&completed, &e.Erased.Accounts, &e.Erased.Portfolios,
+		&e.Erased.Memberships, &e.Erased.IdempotencyKeys,
+		&e.Erased.AuditEntries)
+	if err != nil {
+		return e, err
+	}
+	e.Status = domain.ErasureStatus(status)
+	if started.Valid {
+		e.StartedAt = &started.Time
+	}
+	if completed.Valid {
+		e.CompletedAt = &completed.Time
+	}
+	return e, nil
+}
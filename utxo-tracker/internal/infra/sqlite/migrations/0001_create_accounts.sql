@@ -0,0 +1,17 @@
+CREATE TABLE accounts (
+	id         TEXT PRIMARY KEY,
+	owner_id   TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	UNIQUE (owner_id, name)
+);
+
+CREATE INDEX accounts_owner_created ON accounts (owner_id, created_at);
+
+CREATE TABLE account_addresses (
+	account_id TEXT NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	address    TEXT NOT NULL,
+	PRIMARY KEY (account_id, position)
+);
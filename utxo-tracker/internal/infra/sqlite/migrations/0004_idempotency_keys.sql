@@ -0,0 +1,12 @@
+CREATE TABLE idempotency_keys (
+	owner_id        TEXT NOT NULL,
+	idempotency_key TEXT NOT NULL,
+	fingerprint     TEXT NOT NULL,
+	status          INTEGER NOT NULL DEFAULT 0,
+	header          TEXT NOT NULL DEFAULT '{}',
+	body            BLOB,
+	expires_at      TIMESTAMP NOT NULL,
+	PRIMARY KEY (owner_id, idempotency_key)
+);
+
+CREATE INDEX idempotency_keys_expires ON idempotency_keys (expires_at);
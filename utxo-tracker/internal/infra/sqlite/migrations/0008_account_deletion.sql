@@ -0,0 +1,5 @@
+-- Deleted accounts are kept, along with their name, until they are
+-- purged after the retention period.
+ALTER TABLE accounts ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX accounts_deleted ON accounts (deleted_at);
@@ -0,0 +1,3 @@
+-- The extended key, purpose, gap limit and derived addresses of accounts
+-- that derive their addresses, as JSON.
+ALTER TABLE accounts ADD COLUMN derivation TEXT;
@@ -0,0 +1,13 @@
+-- The data keys that encrypt the extended keys and descriptors of
+-- accounts, the changes of audit entries, the records of labels and the
+-- responses stored for idempotency keys, wrapped with the version of the
+-- key-encryption key in key_version. Rows without data key are stored in
+-- plaintext.
+ALTER TABLE accounts ADD COLUMN data_key TEXT;
+ALTER TABLE accounts ADD COLUMN key_version TEXT;
+ALTER TABLE audit_entries ADD COLUMN data_key TEXT;
+ALTER TABLE audit_entries ADD COLUMN key_version TEXT;
+ALTER TABLE account_labels ADD COLUMN data_key TEXT;
+ALTER TABLE account_labels ADD COLUMN key_version TEXT;
+ALTER TABLE idempotency_keys ADD COLUMN data_key TEXT;
+ALTER TABLE idempotency_keys ADD COLUMN key_version TEXT;
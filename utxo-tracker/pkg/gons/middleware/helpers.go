@@ -12,3 +12,9 @@ func (p *ResponsePeeker) WriteHeader(code int) {
 	p.Status = code
 	p.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap gives http.ResponseController access to the wrapped writer so
+// that streaming handlers can flush through the peeker.
+func (p *ResponsePeeker) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}